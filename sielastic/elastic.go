@@ -34,6 +34,19 @@ func NewClient(client *elasticsearch.Client) *Client {
 	return &Client{client}
 }
 
+// HealthCheck pings the cluster.
+func (c *Client) HealthCheck(ctx context.Context) error {
+	res, err := c.Ping(c.Ping.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return errors.New("sielastic: ping failed, " + res.Status())
+	}
+	return nil
+}
+
 func (c *Client) IndexDocument(ctx context.Context, indexName string, body []byte) (map[string]interface{}, error) {
 	req := esapi.IndexRequest{
 		Index: indexName,
@@ -0,0 +1,282 @@
+package sihttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-wonk/si/v2/sicore"
+)
+
+const (
+	graphQLAccept = "application/graphql-response+json, application/json"
+
+	graphQLPersistedQueryNotFound         = "PersistedQueryNotFound"
+	graphQLPersistedQueryNotFoundCode     = "PERSISTED_QUERY_NOT_FOUND"
+	graphQLPersistedQueryNotSupported     = "PersistedQueryNotSupported"
+	graphQLPersistedQueryNotSupportedCode = "PERSISTED_QUERY_NOT_SUPPORTED"
+
+	// graphQLMaxCachedHashes bounds the hashes of queries cached by GraphQLClient.
+	graphQLMaxCachedHashes = 1024
+)
+
+// GraphQLRequest is the body of a GraphQL request.
+type GraphQLRequest struct {
+	Query         string         `json:"query,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+	OperationName string         `json:"operationName,omitempty"`
+	Extensions    map[string]any `json:"extensions,omitempty"`
+}
+
+// GraphQLLocation is a location in the query document an error is associated with.
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// GraphQLError is an entry of `errors` of a GraphQL response.
+type GraphQLError struct {
+	Message   string            `json:"message"`
+	Locations []GraphQLLocation `json:"locations,omitempty"`
+	// Path is the path of the response field the error occurred in, with strings for field names and integers for
+	// list indices.
+	Path       []any          `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+func (e *GraphQLError) Error() string {
+	if len(e.Path) == 0 {
+		return "graphql: " + e.Message
+	}
+	path := make([]string, len(e.Path))
+	for i, p := range e.Path {
+		path[i] = fmt.Sprint(p)
+	}
+	return "graphql: " + e.Message + " (path: " + strings.Join(path, ".") + ")"
+}
+
+// Code returns `extensions.code` of e, empty if it is not set.
+func (e *GraphQLError) Code() string {
+	code, _ := e.Extensions["code"].(string)
+	return code
+}
+
+// GraphQLErrors is `errors` of a GraphQL response. It is returned by GraphQLClient with the data decoded as much as
+// the server resolved, since GraphQL responses can be partially successful.
+type GraphQLErrors []*GraphQLError
+
+func (e GraphQLErrors) Error() string {
+	switch len(e) {
+	case 0:
+		return "graphql: no errors"
+	case 1:
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", e[0].Error(), len(e)-1)
+}
+
+// Unwrap returns each GraphQLError for errors.Is and errors.As.
+func (e GraphQLErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, v := range e {
+		errs[i] = v
+	}
+	return errs
+}
+
+func (e GraphQLErrors) has(message, code string) bool {
+	for _, v := range e {
+		if v.Message == message || v.Code() == code {
+			return true
+		}
+	}
+	return false
+}
+
+type graphQLResponse struct {
+	Data       json.RawMessage `json:"data"`
+	Errors     GraphQLErrors   `json:"errors"`
+	Extensions map[string]any  `json:"extensions"`
+}
+
+// GraphQLClient sends GraphQL requests over Client.
+type GraphQLClient struct {
+	client   *Client
+	endpoint string
+
+	persistedQueries bool
+	// persistedQueriesUnsupported is set when the server responds PersistedQueryNotSupported.
+	persistedQueriesUnsupported atomic.Bool
+	hashes                      sync.Map // query -> hash
+	cachedHashes                atomic.Int64
+
+	requestOpts []RequestOption
+}
+
+type GraphQLOption interface {
+	apply(c *GraphQLClient) error
+}
+
+type GraphQLOptionFunc func(c *GraphQLClient) error
+
+func (o GraphQLOptionFunc) apply(c *GraphQLClient) error {
+	return o(c)
+}
+
+// WithPersistedQueries enables automatic persisted queries. Requests are sent with the sha256 hash of the query
+// only, and the query is sent along with the hash when the server responds PersistedQueryNotFound.
+//
+// Hashes of the first 1024 distinct queries are cached and the others are hashed on every request, so queries
+// should be static with values passed in variables.
+func WithPersistedQueries() GraphQLOptionFunc {
+	return GraphQLOptionFunc(func(c *GraphQLClient) error {
+		c.persistedQueries = true
+		return nil
+	})
+}
+
+// WithGraphQLRequestOption applies opts to every request of GraphQLClient.
+func WithGraphQLRequestOption(opts ...RequestOption) GraphQLOptionFunc {
+	return GraphQLOptionFunc(func(c *GraphQLClient) error {
+		c.requestOpts = append(c.requestOpts, opts...)
+		return nil
+	})
+}
+
+// NewGraphQLClient returns GraphQLClient sending requests to endpoint, which is appended to the base url of client.
+func NewGraphQLClient(client *Client, endpoint string, opts ...GraphQLOption) (*GraphQLClient, error) {
+	c := &GraphQLClient{
+		client:   client,
+		endpoint: endpoint,
+	}
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if err := o.apply(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Do sends query with variables and decodes `data` of the response into res. If the response has `errors`,
+// GraphQLErrors is returned after decoding `data`.
+func (c *GraphQLClient) Do(ctx context.Context, query string, variables map[string]any, res any, opts ...RequestOption) error {
+	return c.DoRequest(ctx, &GraphQLRequest{Query: query, Variables: variables}, res, opts...)
+}
+
+// DoRequest sends req and decodes `data` of the response into res. If the response has `errors`, GraphQLErrors is
+// returned after decoding `data`.
+func (c *GraphQLClient) DoRequest(ctx context.Context, req *GraphQLRequest, res any, opts ...RequestOption) error {
+	if !c.persistedQueries || c.persistedQueriesUnsupported.Load() || req.Query == "" {
+		return c.send(ctx, req, res, opts)
+	}
+
+	hash := c.queryHash(req.Query)
+	persisted := *req
+	persisted.Query = ""
+	persisted.Extensions = withPersistedQuery(req.Extensions, hash)
+
+	err := c.send(ctx, &persisted, res, opts)
+	if gqlErrs, ok := err.(GraphQLErrors); ok {
+		switch {
+		case gqlErrs.has(graphQLPersistedQueryNotSupported, graphQLPersistedQueryNotSupportedCode):
+			c.persistedQueriesUnsupported.Store(true)
+			return c.send(ctx, req, res, opts)
+		case gqlErrs.has(graphQLPersistedQueryNotFound, graphQLPersistedQueryNotFoundCode):
+			// register the query with its hash
+			persisted.Query = req.Query
+			return c.send(ctx, &persisted, res, opts)
+		}
+	}
+	return err
+}
+
+func (c *GraphQLClient) queryHash(query string) string {
+	if h, ok := c.hashes.Load(query); ok {
+		return h.(string)
+	}
+	sum := sha256.Sum256([]byte(query))
+	h := hex.EncodeToString(sum[:])
+	if c.cachedHashes.Load() < graphQLMaxCachedHashes {
+		if _, loaded := c.hashes.LoadOrStore(query, h); !loaded {
+			c.cachedHashes.Add(1)
+		}
+	}
+	return h
+}
+
+func withPersistedQuery(extensions map[string]any, hash string) map[string]any {
+	ext := make(map[string]any, len(extensions)+1)
+	for k, v := range extensions {
+		ext[k] = v
+	}
+	ext["persistedQuery"] = map[string]any{
+		"version":    1,
+		"sha256Hash": hash,
+	}
+	return ext
+}
+
+func (c *GraphQLClient) send(ctx context.Context, req *GraphQLRequest, res any, opts []RequestOption) error {
+	w, buf := sicore.GetWriterAndBuffer(sicore.SetJsonEncoder())
+	defer sicore.PutWriterAndBuffer(w, buf)
+	if err := w.EncodeFlush(req); err != nil {
+		return err
+	}
+
+	reqOpts := make([]RequestOption, 0, len(c.requestOpts)+len(opts))
+	reqOpts = append(reqOpts, c.requestOpts...)
+	reqOpts = append(reqOpts, opts...)
+
+	header := http.Header{
+		"Content-Type": []string{"application/json"},
+		"Accept":       []string{graphQLAccept},
+	}
+	request, err := c.client.newRequest(ctx, http.MethodPost, c.client.baseUrl+c.endpoint, header, nil,
+		bytes.NewReader(buf.Bytes()), reqOpts...)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.roundTrip(request)
+	if err != nil {
+		return doError(err)
+	}
+	body, err := sicore.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return newTransportError(resp, body, err)
+	}
+
+	var gqlResp graphQLResponse
+	decodeErr := json.Unmarshal(body, &gqlResp)
+	if isErrorStatus(resp.StatusCode) {
+		// servers following GraphQL over HTTP respond request errors with 4xx and `errors`
+		if decodeErr == nil && len(gqlResp.Errors) > 0 {
+			return gqlResp.Errors
+		}
+		return c.client.newStatusError(resp, body)
+	}
+	if decodeErr != nil {
+		return newDecodeError(resp, body, decodeErr)
+	}
+
+	if res != nil && len(gqlResp.Data) > 0 && string(gqlResp.Data) != "null" {
+		if err := json.Unmarshal(gqlResp.Data, res); err != nil {
+			return newDecodeError(resp, body, err)
+		}
+	}
+	if len(gqlResp.Errors) > 0 {
+		return gqlResp.Errors
+	}
+	return nil
+}
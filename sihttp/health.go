@@ -0,0 +1,175 @@
+package sihttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHealthCheckTimeout = 5 * time.Second
+
+	HealthStatusUp   = "up"
+	HealthStatusDown = "down"
+)
+
+var ErrServerNotReady = errors.New("sihttp: server is not ready")
+
+// HealthChecker is implemented by components reporting their health, eg. sisql.SqlDB, sirabbitmq.Conn,
+// siwebsocket.Hub, sielastic.Client, sikafka producers and sikafka.ClientHealthChecker.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+type HealthCheckerFunc func(ctx context.Context) error
+
+func (f HealthCheckerFunc) HealthCheck(ctx context.Context) error {
+	return f(ctx)
+}
+
+// HealthCheckResult is the result of a check in HealthReport.
+type HealthCheckResult struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// HealthReport is the aggregated result of checks. Status is down if any of the checks is down.
+type HealthReport struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks,omitempty"`
+}
+
+type namedHealthChecker struct {
+	name    string
+	checker HealthChecker
+}
+
+// Health aggregates liveness and readiness checks of components. Checks run concurrently, each with its own
+// timeout.
+type Health struct {
+	timeout time.Duration
+
+	mu        sync.RWMutex
+	liveness  []namedHealthChecker
+	readiness []namedHealthChecker
+}
+
+// NewHealth returns Health running each check with timeout, 5 seconds if timeout is 0.
+func NewHealth(timeout time.Duration) *Health {
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	return &Health{timeout: timeout}
+}
+
+// AddLiveness registers checker to liveness checks. Liveness should fail only when the process needs restarting.
+func (h *Health) AddLiveness(name string, checker HealthChecker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.liveness = append(h.liveness, namedHealthChecker{name, checker})
+}
+
+// AddReadiness registers checker to readiness checks. Readiness fails when the process cannot serve requests,
+// eg. its database is unreachable.
+func (h *Health) AddReadiness(name string, checker HealthChecker) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.readiness = append(h.readiness, namedHealthChecker{name, checker})
+}
+
+// Live runs liveness checks.
+func (h *Health) Live(ctx context.Context) HealthReport {
+	h.mu.RLock()
+	checks := h.liveness
+	h.mu.RUnlock()
+	return h.run(ctx, checks)
+}
+
+// Ready runs liveness and readiness checks.
+func (h *Health) Ready(ctx context.Context) HealthReport {
+	h.mu.RLock()
+	checks := make([]namedHealthChecker, 0, len(h.liveness)+len(h.readiness))
+	checks = append(checks, h.liveness...)
+	checks = append(checks, h.readiness...)
+	h.mu.RUnlock()
+	return h.run(ctx, checks)
+}
+
+func (h *Health) run(ctx context.Context, checks []namedHealthChecker) HealthReport {
+	report := HealthReport{
+		Status: HealthStatusUp,
+		Checks: make(map[string]HealthCheckResult, len(checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c namedHealthChecker) {
+			defer wg.Done()
+			res := h.check(ctx, c.checker)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[c.name] = res
+			if res.Status != HealthStatusUp {
+				report.Status = HealthStatusDown
+			}
+		}(c)
+	}
+	wg.Wait()
+	return report
+}
+
+// check runs checker with the timeout. A checker not returning after the timeout is reported down without waiting
+// for it.
+func (h *Health) check(ctx context.Context, checker HealthChecker) HealthCheckResult {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- checker.HealthCheck(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	res := HealthCheckResult{Status: HealthStatusUp, Duration: time.Since(start).String()}
+	if err != nil {
+		res.Status = HealthStatusDown
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// LivenessHandler responds the result of Live, with 503 Service Unavailable if it is down.
+func (h *Health) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealthReport(w, h.Live(r.Context()))
+	})
+}
+
+// ReadinessHandler responds the result of Ready, with 503 Service Unavailable if it is down.
+func (h *Health) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealthReport(w, h.Ready(r.Context()))
+	})
+}
+
+func writeHealthReport(w http.ResponseWriter, report HealthReport) {
+	w.Header().Set("Cache-Control", "no-store")
+	status := http.StatusOK
+	if report.Status != HealthStatusUp {
+		status = http.StatusServiceUnavailable
+	}
+	WriteJSON(w, status, report)
+}
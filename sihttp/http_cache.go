@@ -0,0 +1,480 @@
+package sihttp
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultCacheCapacity = 1024
+
+	// maxHeuristicLifetime caps the freshness lifetime calculated from `Last-Modified`.
+	maxHeuristicLifetime = 24 * time.Hour
+
+	// maxCachedBodySize is the largest body stored. Larger bodies are passed through without being stored.
+	maxCachedBodySize = 8 << 20
+)
+
+type bypassCacheKey struct{}
+
+// withoutCache marks req to be sent without Cache, for streaming responses.
+func withoutCache(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), bypassCacheKey{}, true))
+}
+
+// CacheEntry is a response stored in CacheStore.
+type CacheEntry struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+
+	// RequestTime and ResponseTime are the times the request was sent and the response was received.
+	RequestTime  time.Time
+	ResponseTime time.Time
+
+	// Vary holds the request header values selected by the response's `Vary` header.
+	Vary http.Header
+}
+
+// CacheStore stores CacheEntry by key. Implementations must be safe for concurrent use.
+type CacheStore interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, entry *CacheEntry)
+	Delete(key string)
+}
+
+// LRUCacheStore is an in-memory CacheStore evicting the least recently used entry when it is full.
+type LRUCacheStore struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type lruItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+// NewLRUCacheStore returns LRUCacheStore holding at most capacity entries.
+func NewLRUCacheStore(capacity int) *LRUCacheStore {
+	if capacity <= 0 {
+		capacity = defaultCacheCapacity
+	}
+	return &LRUCacheStore{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (s *LRUCacheStore) Get(key string) (*CacheEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	s.ll.MoveToFront(e)
+	return e.Value.(*lruItem).entry, true
+}
+
+func (s *LRUCacheStore) Set(key string, entry *CacheEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.items[key]; ok {
+		e.Value.(*lruItem).entry = entry
+		s.ll.MoveToFront(e)
+		return
+	}
+
+	s.items[key] = s.ll.PushFront(&lruItem{key, entry})
+	for s.ll.Len() > s.capacity {
+		last := s.ll.Back()
+		s.ll.Remove(last)
+		delete(s.items, last.Value.(*lruItem).key)
+	}
+}
+
+func (s *LRUCacheStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.items[key]; ok {
+		s.ll.Remove(e)
+		delete(s.items, key)
+	}
+}
+
+// Len returns the number of entries.
+func (s *LRUCacheStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ll.Len()
+}
+
+// CacheStats is the statistics of Cache.
+type CacheStats struct {
+	// Hits is the number of responses served from the store without contacting the server.
+	Hits uint64
+	// Misses is the number of responses fetched from the server.
+	Misses uint64
+	// Revalidations is the number of stored responses validated with a `304 Not Modified`.
+	Revalidations uint64
+}
+
+// Cache is a private HTTP cache. It serves GET responses honoring `Cache-Control` and `Expires`, and revalidates
+// stale responses with `ETag` and `Last-Modified`.
+type Cache struct {
+	store CacheStore
+	now   func() time.Time
+
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	revalidations atomic.Uint64
+}
+
+// NewCache returns Cache backed by store. If store is nil, an LRUCacheStore is used.
+func NewCache(store CacheStore) *Cache {
+	if store == nil {
+		store = NewLRUCacheStore(defaultCacheCapacity)
+	}
+	return &Cache{
+		store: store,
+		now:   time.Now,
+	}
+}
+
+// Stats returns the current statistics.
+func (c *Cache) Stats() CacheStats {
+	return CacheStats{
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Revalidations: c.revalidations.Load(),
+	}
+}
+
+func (c *Cache) do(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	if req.Context().Value(bypassCacheKey{}) != nil {
+		return send(req)
+	}
+	key := cacheKey(req)
+
+	if req.Method != http.MethodGet {
+		resp, err := send(req)
+		if err == nil && isUnsafeMethod(req.Method) && resp.StatusCode < 400 {
+			c.store.Delete(key)
+		}
+		return resp, err
+	}
+
+	reqCC := parseCacheControl(req.Header)
+	if reqCC.has("no-store") || req.Header.Get("Range") != "" {
+		return send(req)
+	}
+
+	entry, ok := c.store.Get(key)
+	if ok && !entry.varyMatches(req) {
+		ok = false
+	}
+
+	if ok && !reqCC.has("no-cache") && entry.fresh(c.now()) {
+		c.hits.Add(1)
+		return entry.response(req, c.now()), nil
+	}
+
+	sendReq := req
+	if ok && entry.hasValidator() {
+		sendReq = req.Clone(req.Context())
+		if etag := entry.Header.Get("ETag"); etag != "" && sendReq.Header.Get("If-None-Match") == "" {
+			sendReq.Header.Set("If-None-Match", etag)
+		}
+		if lm := entry.Header.Get("Last-Modified"); lm != "" && sendReq.Header.Get("If-Modified-Since") == "" {
+			sendReq.Header.Set("If-Modified-Since", lm)
+		}
+	}
+
+	requestTime := c.now()
+	resp, err := send(sendReq)
+	if err != nil {
+		return nil, err
+	}
+	responseTime := c.now()
+
+	if ok && sendReq != req && resp.StatusCode == http.StatusNotModified {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		updated := *entry
+		updated.Header = entry.Header.Clone()
+		for k, v := range resp.Header {
+			updated.Header[k] = v
+		}
+		updated.RequestTime = requestTime
+		updated.ResponseTime = responseTime
+		c.store.Set(key, &updated)
+
+		c.revalidations.Add(1)
+		return updated.response(req, c.now()), nil
+	}
+
+	c.misses.Add(1)
+	if !isStorable(reqCC, resp) {
+		return resp, nil
+	}
+
+	if resp.ContentLength > maxCachedBodySize {
+		return resp, nil
+	}
+
+	entry = &CacheEntry{
+		StatusCode:   resp.StatusCode,
+		Header:       resp.Header.Clone(),
+		RequestTime:  requestTime,
+		ResponseTime: responseTime,
+		Vary:         varyHeader(req, resp.Header),
+	}
+	// the body is stored as it is read, so that the response is streamed to the caller
+	resp.Body = &cacheBody{ReadCloser: resp.Body, drain: resp.ContentLength >= 0, store: func(body []byte) {
+		entry.Body = body
+		c.store.Set(key, entry)
+	}}
+
+	return resp, nil
+}
+
+// cacheBody stores the body with store when it has been read to the end, unless it is larger than
+// maxCachedBodySize. If drain is true, the rest of the body is read on Close so that a body not read to the end
+// is stored as well. It is only set when the length of the body is known, so Close never waits on a stream.
+type cacheBody struct {
+	io.ReadCloser
+	drain bool
+	store func(body []byte)
+
+	buf  bytes.Buffer
+	done bool
+}
+
+func (b *cacheBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.done {
+		b.buf.Write(p[:n])
+		b.check(err)
+	}
+	return n, err
+}
+
+func (b *cacheBody) check(err error) {
+	switch {
+	case err == io.EOF:
+		b.done = true
+		b.store(bytes.Clone(b.buf.Bytes()))
+		b.buf = bytes.Buffer{}
+	case err != nil || b.buf.Len() > maxCachedBodySize:
+		b.done = true
+		b.buf = bytes.Buffer{}
+	}
+}
+
+func (b *cacheBody) Close() error {
+	if !b.done && b.drain {
+		_, err := io.Copy(&b.buf, io.LimitReader(b.ReadCloser, int64(maxCachedBodySize-b.buf.Len()+1)))
+		if err == nil && b.buf.Len() <= maxCachedBodySize {
+			err = io.EOF
+		}
+		b.check(err)
+	}
+	return b.ReadCloser.Close()
+}
+
+func cacheKey(req *http.Request) string {
+	return http.MethodGet + " " + req.URL.String()
+}
+
+func isUnsafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+	return true
+}
+
+func isCacheableStatus(code int) bool {
+	switch code {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent,
+		http.StatusMultipleChoices, http.StatusMovedPermanently,
+		http.StatusNotFound, http.StatusGone:
+		return true
+	}
+	return false
+}
+
+func isStorable(reqCC cacheControl, resp *http.Response) bool {
+	if !isCacheableStatus(resp.StatusCode) {
+		return false
+	}
+	respCC := parseCacheControl(resp.Header)
+	if respCC.has("no-store") {
+		return false
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt == "text/event-stream" {
+		return false
+	}
+	for _, v := range resp.Header.Values("Vary") {
+		if strings.TrimSpace(v) == "*" {
+			return false
+		}
+	}
+	if _, ok := respCC["max-age"]; ok {
+		return true
+	}
+	return respCC.has("no-cache") || resp.Header.Get("Expires") != "" ||
+		resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""
+}
+
+func varyHeader(req *http.Request, respHeader http.Header) http.Header {
+	var vary http.Header
+	for _, v := range respHeader.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if vary == nil {
+				vary = make(http.Header)
+			}
+			vary[http.CanonicalHeaderKey(name)] = req.Header.Values(name)
+		}
+	}
+	return vary
+}
+
+func (e *CacheEntry) varyMatches(req *http.Request) bool {
+	for name, values := range e.Vary {
+		if strings.Join(values, ",") != strings.Join(req.Header.Values(name), ",") {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *CacheEntry) hasValidator() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+// freshnessLifetime calculates the freshness lifetime of e as described in RFC 9111 section 4.2.1.
+func (e *CacheEntry) freshnessLifetime() time.Duration {
+	cc := parseCacheControl(e.Header)
+	if cc.has("no-cache") {
+		return 0
+	}
+	if v, ok := cc["max-age"]; ok {
+		sec, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0
+		}
+		return time.Duration(sec) * time.Second
+	}
+
+	date := e.date()
+	if v := e.Header.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			return 0
+		}
+		return expires.Sub(date)
+	}
+
+	if v := e.Header.Get("Last-Modified"); v != "" {
+		lm, err := http.ParseTime(v)
+		if err != nil || !lm.Before(date) {
+			return 0
+		}
+		lifetime := date.Sub(lm) / 10
+		if lifetime > maxHeuristicLifetime {
+			lifetime = maxHeuristicLifetime
+		}
+		return lifetime
+	}
+	return 0
+}
+
+// age calculates the current age of e as described in RFC 9111 section 4.2.3.
+func (e *CacheEntry) age(now time.Time) time.Duration {
+	apparentAge := e.ResponseTime.Sub(e.date())
+	if apparentAge < 0 {
+		apparentAge = 0
+	}
+	if v := e.Header.Get("Age"); v != "" {
+		if sec, err := strconv.ParseInt(v, 10, 64); err == nil {
+			if ageValue := time.Duration(sec)*time.Second + e.ResponseTime.Sub(e.RequestTime); ageValue > apparentAge {
+				apparentAge = ageValue
+			}
+		}
+	}
+	return apparentAge + now.Sub(e.ResponseTime)
+}
+
+func (e *CacheEntry) date() time.Time {
+	if v := e.Header.Get("Date"); v != "" {
+		if d, err := http.ParseTime(v); err == nil {
+			return d
+		}
+	}
+	return e.ResponseTime
+}
+
+func (e *CacheEntry) fresh(now time.Time) bool {
+	return e.freshnessLifetime() > e.age(now)
+}
+
+func (e *CacheEntry) response(req *http.Request, now time.Time) *http.Response {
+	header := e.Header.Clone()
+	header.Set("Age", strconv.FormatInt(int64(e.age(now)/time.Second), 10))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// cacheControl holds `Cache-Control` directives. Directives without value are stored with an empty string.
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, v := range header.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			d = strings.TrimSpace(d)
+			if d == "" {
+				continue
+			}
+			name, value, _ := strings.Cut(d, "=")
+			cc[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
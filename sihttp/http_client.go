@@ -1,10 +1,9 @@
 package sihttp
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"io"
-	"mime/multipart"
 	"net/http"
 	"os"
 	"time"
@@ -24,6 +23,19 @@ type Client struct {
 	requestOpts []RequestOption
 	writerOpts  []sicore.WriterOption
 	readerOpts  []sicore.ReaderOption
+
+	cache *Cache
+
+	tokenManager *TokenManager
+
+	decompression *decompression
+	hedging       *hedging
+
+	defaultTimeout time.Duration
+	deadlineHeader string
+
+	// errorBody returns a pointer to decode the body of error responses into.
+	errorBody func() any
 }
 
 // NewClient returns Client
@@ -45,17 +57,73 @@ func NewClient(client *http.Client, opts ...ClientOption) *Client {
 
 // Do is a wrapper of http.Client.Do
 func (hc *Client) Do(request *http.Request) (*http.Response, error) {
+	resp, err := hc.roundTrip(request)
+	var rt *roundTripError
+	if errors.As(err, &rt) {
+		return nil, rt.err
+	}
+	return resp, err
+}
+
+// roundTrip sends request like Do, but failures to send request or to receive the response are *roundTripError so
+// that they can be told from failures before sending such as fetching a token.
+func (hc *Client) roundTrip(request *http.Request) (*http.Response, error) {
 	hc.setDefaultHeader(request)
 
+	request, cancel := hc.withTimeout(request)
+	if cancel != nil {
+		resp, err := hc.doAuth(request)
+		return cancelOnClose(resp, err, cancel)
+	}
+	return hc.doAuth(request)
+}
+
+func (hc *Client) doAuth(request *http.Request) (*http.Response, error) {
+	if hc.tokenManager != nil && request.Header.Get("Authorization") == "" {
+		return hc.doWithToken(request)
+	}
+
+	return hc.do(request)
+}
+
+func (hc *Client) do(request *http.Request) (*http.Response, error) {
+	if hc.cache != nil {
+		return hc.cache.do(request, hc.send)
+	}
+
 	// return ctxhttp.Do(request.Context(), hc.client, request)
-	return hc.client.Do(request)
+	return hc.send(request)
+}
+
+// send sends request with the underlying http.Client. Responses are decompressed before they are cached.
+func (hc *Client) send(request *http.Request) (*http.Response, error) {
+	hc.propagateDeadline(request)
+
+	send := hc.clientDo
+	if hc.hedging != nil {
+		send = func(req *http.Request) (*http.Response, error) {
+			return hc.hedging.do(req, hc.clientDo)
+		}
+	}
+	if hc.decompression != nil {
+		return hc.decompression.do(request, send)
+	}
+	return send(request)
+}
+
+func (hc *Client) clientDo(request *http.Request) (*http.Response, error) {
+	resp, err := hc.client.Do(request)
+	if err != nil {
+		return nil, &roundTripError{err}
+	}
+	return resp, nil
 }
 
 // DoRead sends Do request and read all data from response.Body
 func (hc *Client) DoRead(request *http.Request) ([]byte, error) {
-	resp, err := hc.Do(request)
+	resp, err := hc.roundTrip(request)
 	if err != nil {
-		return nil, err
+		return nil, doError(err)
 	}
 
 	r := sicore.GetReader(resp.Body)
@@ -64,28 +132,27 @@ func (hc *Client) DoRead(request *http.Request) ([]byte, error) {
 	b, err := r.ReadAll()
 	resp.Body.Close()
 	if err != nil {
-		return nil, &Error{
-			Response: resp,
-			Body:     b,
-		}
+		return nil, newTransportError(resp, b, err)
 	}
-	if code := resp.StatusCode; code < 100 || code > 399 {
-		return nil, &Error{
-			Response: resp,
-			Body:     b,
-		}
+	if isErrorStatus(resp.StatusCode) {
+		return nil, hc.newStatusError(resp, b)
 	}
 	return b, nil
 }
 
 // DoDecode sends Do request and decode response.Body
 func (hc *Client) DoDecode(request *http.Request, res any) error {
-	resp, err := hc.Do(request)
+	resp, err := hc.roundTrip(request)
 	if err != nil {
-		return err
+		return doError(err)
+	}
+
+	if isErrorStatus(resp.StatusCode) {
+		return hc.newResponseError(resp)
 	}
 
 	bb := sicore.GetBytesBuffer(nil)
+	defer sicore.PutBytesBuffer(bb)
 	tr := io.TeeReader(resp.Body, bb)
 	r := sicore.GetReader(tr, hc.readerOpts...)
 	defer sicore.PutReader(r)
@@ -93,17 +160,9 @@ func (hc *Client) DoDecode(request *http.Request, res any) error {
 	err = r.Decode(res)
 	resp.Body.Close()
 	if err != nil {
-		return &Error{
-			Response: resp,
-			Body:     bb.Bytes(),
-		}
-	}
-
-	if code := resp.StatusCode; code < 100 || code > 399 {
-		return &Error{
-			Response: resp,
-			Body:     bb.Bytes(),
-		}
+		body := make([]byte, bb.Len())
+		copy(body, bb.Bytes())
+		return newDecodeError(resp, body, err)
 	}
 
 	return nil
@@ -351,39 +410,12 @@ func (hc *Client) PostFileContext(ctx context.Context, url string, header http.H
 	}
 	defer f.Close()
 
-	// create multipart.Writer
-	buf := bytes.NewBuffer(make([]byte, 0, 512))
-	mw := multipart.NewWriter(buf)
-	w, err := mw.CreateFormFile(fileFieldName, f.Name())
-	if err != nil {
-		return nil, err
-	}
-
-	// write file contents
-	sr := sicore.GetReader(f)
-	defer sicore.PutReader(sr)
-	_, err = sr.WriteTo(w)
-	if err != nil {
-		return nil, err
-	}
-
-	// set Content-Type, overwrite existing Content-Type
-	if header == nil {
-		header = make(http.Header)
-	}
-	header["Content-Type"] = []string{mw.FormDataContentType()}
-
-	// write params, this closes multipart.Writer
+	mb := NewMultipartBuilder().AddFile(fileFieldName, f.Name(), "", f)
 	for k, v := range params {
-		mw.WriteField(k, v)
-	}
-
-	// close multipart writer
-	if err = mw.Close(); err != nil {
-		return nil, err
+		mb.AddField(k, v)
 	}
 
-	return hc.request(ctx, http.MethodPost, hc.baseUrl+url, header, nil, buf)
+	return hc.RequestMultipartContext(ctx, http.MethodPost, url, header, mb)
 }
 
 // setDefaultHeader sets defaultHeaders to request. It doesn't replace headers that are already assigned to `request`
@@ -431,12 +463,9 @@ func (hc *Client) request(ctx context.Context, method string, url string,
 	setHeader(req, header)
 	setQueries(req, queries)
 
-	for _, v := range hc.requestOpts {
-		v.apply(req)
-	}
-
-	for _, v := range opts {
-		v.apply(req)
+	req, err = applyRequestOptions(req, hc.requestOpts, opts)
+	if err != nil {
+		return nil, err
 	}
 
 	respBody, err := hc.DoRead(req)
@@ -447,6 +476,27 @@ func (hc *Client) request(ctx context.Context, method string, url string,
 	return respBody, nil
 }
 
+// newRequest creates a request with `header`, `queries` and request options applied. Unlike `request`, body is
+// passed as is so that it can be streamed.
+func (hc *Client) newRequest(ctx context.Context, method string, url string,
+	header http.Header, queries map[string]string, body io.Reader, opts ...RequestOption) (*http.Request, error) {
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	setHeader(req, header)
+	setQueries(req, queries)
+
+	req, err = applyRequestOptions(req, hc.requestOpts, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
 func (hc *Client) requestDecode(ctx context.Context, method string, url string, header http.Header, queries map[string]string, body any, res any, opts ...RequestOption) error {
 
 	var req *http.Request
@@ -472,12 +522,9 @@ func (hc *Client) requestDecode(ctx context.Context, method string, url string,
 	setHeader(req, header)
 	setQueries(req, queries)
 
-	for _, v := range hc.requestOpts {
-		v.apply(req)
-	}
-
-	for _, v := range opts {
-		v.apply(req)
+	req, err = applyRequestOptions(req, hc.requestOpts, opts)
+	if err != nil {
+		return err
 	}
 
 	err = hc.DoDecode(req, res)
@@ -511,8 +558,10 @@ func setQueries(req *http.Request, queries map[string]string) {
 	}
 }
 
+// isRetryError returns true if err is 401 Unauthorized, unless the token manager has already retried it with a new
+// token.
 func (hc *Client) isRetryError(err error) bool {
-	if err == nil {
+	if err == nil || hc.tokenManager != nil {
 		return false
 	}
 	switch t := err.(type) {
@@ -0,0 +1,235 @@
+package sihttp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	EncodingGzip   = "gzip"
+	EncodingZstd   = "zstd"
+	EncodingBrotli = "br"
+
+	// acceptEncoding is sent by clients with decompression enabled.
+	acceptEncoding = "gzip, zstd, br"
+)
+
+// ErrDecompressedTooLarge is returned when reading a decompressed response body exceeding the limit of
+// WithDecompression.
+var ErrDecompressedTooLarge = errors.New("sihttp: decompressed body is too large")
+
+// WithRequestCompression compresses the body of a request with encoding, one of EncodingGzip, EncodingZstd and
+// EncodingBrotli, and sets Content-Encoding header. Requests without body or with Content-Encoding already set are
+// left as they are. The body is compressed in memory so that the request can be retried.
+func WithRequestCompression(encoding string) RequestOptionFunc {
+	return RequestOptionFunc(func(req *http.Request) error {
+		if req.Body == nil || req.Body == http.NoBody || req.Header.Get("Content-Encoding") != "" {
+			return nil
+		}
+
+		buf := &bytes.Buffer{}
+		w, err := newCompressWriter(buf, encoding)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(w, req.Body)
+		req.Body.Close()
+		if err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+
+		b := buf.Bytes()
+		req.Body = io.NopCloser(bytes.NewReader(b))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(b)), nil
+		}
+		req.ContentLength = int64(len(b))
+		req.Header.Set("Content-Encoding", encoding)
+		return nil
+	})
+}
+
+func newCompressWriter(w io.Writer, encoding string) (io.WriteCloser, error) {
+	switch encoding {
+	case EncodingGzip:
+		return gzip.NewWriter(w), nil
+	case EncodingZstd:
+		return zstd.NewWriter(w)
+	case EncodingBrotli:
+		return brotli.NewWriter(w), nil
+	}
+	return nil, fmt.Errorf("sihttp: unsupported content encoding %q", encoding)
+}
+
+// WithDecompression makes Client request and decompress gzip, zstd and brotli encoded responses. Reading a
+// decompressed body beyond maxBytes fails with ErrDecompressedTooLarge, no limit if maxBytes is 0. Responses that are
+// not decompressed are not limited.
+//
+// Accept-Encoding header is set unless it is already set by the request or the request has Range header, as a range
+// of an encoded body cannot be decompressed. Partial content responses are not decompressed either.
+func WithDecompression(maxBytes int64) ClientOptionFunc {
+	return ClientOptionFunc(func(c *Client) error {
+		c.decompression = &decompression{maxBytes: maxBytes}
+		return nil
+	})
+}
+
+type decompression struct {
+	maxBytes int64
+}
+
+// do sends req with send and replaces the body of the response with a decompressing reader.
+func (d *decompression) do(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" {
+		// setting Accept-Encoding disables transparent gzip of http.Transport, so gzip is decompressed here as well
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+
+	resp, err := send(req)
+	if err != nil {
+		return nil, err
+	}
+
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" || req.Method == http.MethodHead ||
+		resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified ||
+		resp.StatusCode == http.StatusPartialContent {
+		return resp, nil
+	}
+
+	body, err := newDecompressReader(resp.Body, encoding)
+	if err != nil {
+		// unknown encodings are passed through as they are
+		return resp, nil
+	}
+	resp.Body = d.limit(body)
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+func (d *decompression) limit(body io.ReadCloser) io.ReadCloser {
+	if d.maxBytes <= 0 {
+		return body
+	}
+	return &limitedBody{ReadCloser: body, remaining: d.maxBytes}
+}
+
+// limitedBody fails with ErrDecompressedTooLarge instead of returning io.EOF when the limit is reached, so that a
+// truncated body is never mistaken for a complete one.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrDecompressedTooLarge
+	}
+	// read one more byte than remaining to tell a body of exactly maxBytes from a larger one
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), ErrDecompressedTooLarge
+	}
+	return n, err
+}
+
+var (
+	gzipReaderPool  sync.Pool
+	zstdDecoderPool sync.Pool
+)
+
+// newDecompressReader returns a reader decompressing body. Decoders are returned to their pools on Close.
+func newDecompressReader(body io.ReadCloser, encoding string) (io.ReadCloser, error) {
+	switch encoding {
+	case EncodingGzip, "x-gzip":
+		return &lazyDecompressReader{body: body, init: func() (io.Reader, func(), error) {
+			zr, _ := gzipReaderPool.Get().(*gzip.Reader)
+			if zr == nil {
+				r, err := gzip.NewReader(body)
+				if err != nil {
+					return nil, nil, err
+				}
+				zr = r
+			} else if err := zr.Reset(body); err != nil {
+				gzipReaderPool.Put(zr)
+				return nil, nil, err
+			}
+			return zr, func() { gzipReaderPool.Put(zr) }, nil
+		}}, nil
+	case EncodingZstd:
+		return &lazyDecompressReader{body: body, init: func() (io.Reader, func(), error) {
+			zr, _ := zstdDecoderPool.Get().(*zstd.Decoder)
+			if zr == nil {
+				r, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1))
+				if err != nil {
+					return nil, nil, err
+				}
+				zr = r
+			} else if err := zr.Reset(body); err != nil {
+				zstdDecoderPool.Put(zr)
+				return nil, nil, err
+			}
+			return zr, func() {
+				zr.Reset(nil)
+				zstdDecoderPool.Put(zr)
+			}, nil
+		}}, nil
+	case EncodingBrotli:
+		return &lazyDecompressReader{body: body, init: func() (io.Reader, func(), error) {
+			return brotli.NewReader(body), nil, nil
+		}}, nil
+	}
+	return nil, fmt.Errorf("sihttp: unsupported content encoding %q", encoding)
+}
+
+// lazyDecompressReader creates its decoder on the first Read, since gzip reads the header on creation and the body
+// may never be read.
+type lazyDecompressReader struct {
+	body    io.ReadCloser
+	init    func() (io.Reader, func(), error)
+	r       io.Reader
+	release func()
+	err     error
+}
+
+func (l *lazyDecompressReader) Read(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	if l.r == nil {
+		l.r, l.release, l.err = l.init()
+		if l.err != nil {
+			return 0, l.err
+		}
+	}
+	return l.r.Read(p)
+}
+
+func (l *lazyDecompressReader) Close() error {
+	if l.release != nil {
+		l.release()
+		l.release = nil
+	}
+	l.err = http.ErrBodyReadAfterClose
+	return l.body.Close()
+}
@@ -2,13 +2,73 @@ package sihttp
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"mime"
+	"net"
 	"net/http"
+
+	"github.com/go-wonk/si/v2/sicore"
+)
+
+// ProblemContentType is the media type of RFC 7807 problem details.
+const ProblemContentType = "application/problem+json"
+
+// ErrorKind classifies Error.
+type ErrorKind int
+
+const (
+	ErrorKindUnknown ErrorKind = iota
+	// ErrorKindTransport is a failure to send a request or to receive a response.
+	ErrorKindTransport
+	// ErrorKindTimeout is a transport failure caused by a timeout or a context deadline.
+	ErrorKindTimeout
+	// ErrorKindDecode is a failure to decode a successful response.
+	ErrorKindDecode
+	// ErrorKindClient is a response with 4xx status.
+	ErrorKindClient
+	// ErrorKindServer is a response with 5xx status.
+	ErrorKindServer
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorKindTransport:
+		return "transport"
+	case ErrorKindTimeout:
+		return "timeout"
+	case ErrorKindDecode:
+		return "decode"
+	case ErrorKindClient:
+		return "client"
+	case ErrorKindServer:
+		return "server"
+	}
+	return "unknown"
+}
+
+// Sentinel errors matching Error of each kind with errors.Is.
+var (
+	ErrTransport    = errors.New("sihttp: transport error")
+	ErrTimeout      = errors.New("sihttp: timeout")
+	ErrDecode       = errors.New("sihttp: decode error")
+	ErrClientStatus = errors.New("sihttp: client error status")
+	ErrServerStatus = errors.New("sihttp: server error status")
 )
 
 type Error struct {
 	Response *http.Response
 	Body     []byte
+
+	Kind ErrorKind
+	// Err is the cause of transport, timeout and decode errors.
+	Err error
+	// Problem is decoded from Body when the response is `application/problem+json`.
+	Problem *Problem
+	// Decoded is Body decoded into the type registered with WithErrorBody.
+	Decoded any
 }
 
 // func NewError(status int, message string) *Error {
@@ -20,6 +80,14 @@ type Error struct {
 
 func (e Error) Error() string {
 	msg := bytes.Buffer{}
+	if e.Err != nil {
+		msg.WriteString(fmt.Sprintf("%s error: %s", e.Kind, e.Err.Error()))
+		if e.Response == nil {
+			return msg.String()
+		}
+		msg.WriteString(", ")
+	}
+
 	if e.Response == nil {
 		msg.WriteString("status: unknown")
 	} else {
@@ -35,6 +103,28 @@ func (e Error) Error() string {
 	return msg.String()
 }
 
+// Is reports whether target is the sentinel error of e's Kind.
+func (e Error) Is(target error) bool {
+	switch target {
+	case ErrTransport:
+		// timeout is a transport error as well
+		return e.Kind == ErrorKindTransport || e.Kind == ErrorKindTimeout
+	case ErrTimeout:
+		return e.Kind == ErrorKindTimeout
+	case ErrDecode:
+		return e.Kind == ErrorKindDecode
+	case ErrClientStatus:
+		return e.Kind == ErrorKindClient
+	case ErrServerStatus:
+		return e.Kind == ErrorKindServer
+	}
+	return false
+}
+
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
 func (e Error) GetStatusCode(defaultStatusCode int) int {
 	if e.Response != nil {
 		return e.Response.StatusCode
@@ -47,3 +137,186 @@ func (e Error) GetStatus(defaultStatusCode int) string {
 	}
 	return http.StatusText(defaultStatusCode)
 }
+
+// Problem is RFC 7807 problem details. Members other than the standard ones are kept in Extensions.
+type Problem struct {
+	Type     string
+	Title    string
+	Status   int
+	Detail   string
+	Instance string
+
+	Extensions map[string]any
+}
+
+type problemMembers struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+func (p *Problem) UnmarshalJSON(b []byte) error {
+	var m problemMembers
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	var ext map[string]any
+	if err := json.Unmarshal(b, &ext); err != nil {
+		return err
+	}
+	for _, k := range []string{"type", "title", "status", "detail", "instance"} {
+		delete(ext, k)
+	}
+	if len(ext) == 0 {
+		ext = nil
+	}
+
+	*p = Problem{m.Type, m.Title, m.Status, m.Detail, m.Instance, ext}
+	return nil
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	b, err := json.Marshal(problemMembers{p.Type, p.Title, p.Status, p.Detail, p.Instance})
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return json.Marshal(m)
+}
+
+func (p *Problem) Error() string {
+	msg := p.Title
+	if msg == "" {
+		msg = http.StatusText(p.Status)
+	}
+	if p.Detail != "" {
+		msg += ": " + p.Detail
+	}
+	return msg
+}
+
+// ErrorBodyAs returns the error body decoded into T by the client configured with WithErrorBody[T].
+func ErrorBodyAs[T any](err error) (*T, bool) {
+	var e *Error
+	if !errors.As(err, &e) {
+		return nil, false
+	}
+	v, ok := e.Decoded.(*T)
+	return v, ok
+}
+
+// isErrorStatus reports whether `code` is treated as a failure by Client.
+func isErrorStatus(code int) bool {
+	return code < 100 || code > 399
+}
+
+func statusErrorKind(code int) ErrorKind {
+	switch {
+	case code >= 400 && code < 500:
+		return ErrorKindClient
+	case code >= 500 && code < 600:
+		return ErrorKindServer
+	}
+	return ErrorKindUnknown
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// roundTripError is a failure to send a request or to receive a response.
+type roundTripError struct {
+	err error
+}
+
+func (e *roundTripError) Error() string {
+	return e.err.Error()
+}
+
+func (e *roundTripError) Unwrap() error {
+	return e.err
+}
+
+// doError returns an Error of ErrorKindTransport or ErrorKindTimeout if err is a *roundTripError, otherwise err as it
+// is, eg. a failure to fetch a token.
+func doError(err error) error {
+	var rt *roundTripError
+	if errors.As(err, &rt) {
+		return newTransportError(nil, nil, rt.err)
+	}
+	return err
+}
+
+// newTransportError returns an Error of ErrorKindTransport or ErrorKindTimeout.
+func newTransportError(resp *http.Response, body []byte, err error) *Error {
+	kind := ErrorKindTransport
+	if isTimeout(err) {
+		kind = ErrorKindTimeout
+	}
+	return &Error{
+		Response: resp,
+		Body:     body,
+		Kind:     kind,
+		Err:      err,
+	}
+}
+
+// newDecodeError returns an Error of ErrorKindDecode, or ErrorKindTimeout if reading body has timed out.
+func newDecodeError(resp *http.Response, body []byte, err error) *Error {
+	if isTimeout(err) {
+		return newTransportError(resp, body, err)
+	}
+	return &Error{
+		Response: resp,
+		Body:     body,
+		Kind:     ErrorKindDecode,
+		Err:      err,
+	}
+}
+
+// newStatusError returns an Error for a response with error status. It decodes body as Problem if the response is
+// `application/problem+json`, and into the error body type registered with WithErrorBody.
+func (hc *Client) newStatusError(resp *http.Response, body []byte) *Error {
+	e := &Error{
+		Response: resp,
+		Body:     body,
+		Kind:     statusErrorKind(resp.StatusCode),
+	}
+	if len(body) == 0 {
+		return e
+	}
+
+	if mt, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil && mt == ProblemContentType {
+		var p Problem
+		if err := json.Unmarshal(body, &p); err == nil {
+			e.Problem = &p
+		}
+	}
+
+	if hc.errorBody != nil {
+		v := hc.errorBody()
+		if err := json.Unmarshal(body, v); err == nil {
+			e.Decoded = v
+		}
+	}
+	return e
+}
+
+// newResponseError reads the rest of resp.Body and returns it as an Error. resp.Body is closed.
+func (hc *Client) newResponseError(resp *http.Response) *Error {
+	b, _ := sicore.ReadAll(resp.Body)
+	resp.Body.Close()
+	return hc.newStatusError(resp, b)
+}
@@ -0,0 +1,438 @@
+package sihttp
+
+import (
+	"context"
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-wonk/si/v2/sicore"
+)
+
+// Validator is implemented by request types of HandleJSON to validate themselves after binding. Errors are
+// responded with 422 Unprocessable Entity.
+type Validator interface {
+	Validate() error
+}
+
+// BindError is a failure to bind a request into the request type of HandleJSON. It is responded with 400 Bad
+// Request.
+type BindError struct {
+	// Source is one of `path`, `query`, `header` or `body`.
+	Source string
+	Field  string
+	Err    error
+}
+
+func (e *BindError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("invalid %s: %v", e.Source, e.Err)
+	}
+	return fmt.Sprintf("invalid %s %s: %v", e.Source, e.Field, e.Err)
+}
+
+func (e *BindError) Unwrap() error {
+	return e.Err
+}
+
+// FieldErrors maps field names to validation messages. Returned from Validate, it is responded with 422
+// Unprocessable Entity and the messages in `errors` member of the problem.
+type FieldErrors map[string]string
+
+func (e FieldErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for k, v := range e {
+		msgs = append(msgs, k+": "+v)
+	}
+	return strings.Join(msgs, ", ")
+}
+
+type handlerConfig struct {
+	successStatus int
+	errorMapper   func(r *http.Request, err error) *Problem
+	logger        *log.Logger
+}
+
+type HandlerOption interface {
+	apply(c *handlerConfig)
+}
+
+type HandlerOptionFunc func(c *handlerConfig)
+
+func (o HandlerOptionFunc) apply(c *handlerConfig) {
+	o(c)
+}
+
+// WithSuccessStatus sets the status of successful responses, 200 by default. The body is omitted for 204.
+func WithSuccessStatus(status int) HandlerOptionFunc {
+	return HandlerOptionFunc(func(c *handlerConfig) {
+		c.successStatus = status
+	})
+}
+
+// WithErrorMapper maps errors of handlers to problems. If mapper returns nil, the default mapping is used.
+func WithErrorMapper(mapper func(r *http.Request, err error) *Problem) HandlerOptionFunc {
+	return HandlerOptionFunc(func(c *handlerConfig) {
+		c.errorMapper = mapper
+	})
+}
+
+// WithHandlerLogger logs errors responded with 5xx status to logger, log.Default() if not set.
+func WithHandlerLogger(logger *log.Logger) HandlerOptionFunc {
+	return HandlerOptionFunc(func(c *handlerConfig) {
+		c.logger = logger
+	})
+}
+
+func newHandlerConfig(opts []HandlerOption) *handlerConfig {
+	c := &handlerConfig{
+		successStatus: http.StatusOK,
+		logger:        log.Default(),
+	}
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		o.apply(c)
+	}
+	return c
+}
+
+// HandleJSON adapts fn to http.Handler. The request is bound into Req from the JSON body and from fields tagged with
+// `path`, `query` and `header`, which take precedence over the body. If Req implements Validator, it is validated.
+// The result of fn is encoded as JSON, and errors are responded as problem details, see WriteError.
+//
+//	type GetStudentRequest struct {
+//		ID      int    `path:"id"`
+//		Verbose bool   `query:"verbose"`
+//		Tenant  string `header:"X-Tenant"`
+//	}
+func HandleJSON[Req, Resp any](fn func(ctx context.Context, req Req) (Resp, error), opts ...HandlerOption) http.Handler {
+	c := newHandlerConfig(opts)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := bindRequest[Req](r)
+		if err != nil {
+			c.writeError(w, r, err)
+			return
+		}
+
+		resp, err := fn(r.Context(), req)
+		if err != nil {
+			c.writeError(w, r, err)
+			return
+		}
+
+		if c.successStatus == http.StatusNoContent {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if err := WriteJSON(w, c.successStatus, resp); err != nil {
+			c.logger.Printf("sihttp: failed to write response of %s %s: %v", r.Method, r.URL.Path, err)
+		}
+	})
+}
+
+// HandleNoContent adapts fn to http.Handler like HandleJSON, responding 204 No Content on success.
+func HandleNoContent[Req any](fn func(ctx context.Context, req Req) error, opts ...HandlerOption) http.Handler {
+	c := newHandlerConfig(opts)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := bindRequest[Req](r)
+		if err != nil {
+			c.writeError(w, r, err)
+			return
+		}
+		if err := fn(r.Context(), req); err != nil {
+			c.writeError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// WriteJSON writes v encoded as JSON with status.
+func WriteJSON(w http.ResponseWriter, status int, v any) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	wr := sicore.GetWriter(w, sicore.SetJsonEncoder())
+	defer sicore.PutWriter(wr)
+	return wr.EncodeFlush(v)
+}
+
+// WriteError writes err as problem details. Errors are mapped as follows.
+//   - *Problem as it is, with status 500 if Status is not set
+//   - *Error from Client with the status of its response. Transport errors are 502 Bad Gateway and timeouts are
+//     504 Gateway Timeout.
+//   - *BindError 400 Bad Request
+//   - *http.MaxBytesError 413 Request Entity Too Large
+//   - FieldErrors and errors from Validate 422 Unprocessable Entity
+//   - others 500 Internal Server Error without details
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	newHandlerConfig(nil).writeError(w, r, err)
+}
+
+func (c *handlerConfig) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var p *Problem
+	if c.errorMapper != nil {
+		p = c.errorMapper(r, err)
+	}
+	if p == nil {
+		p = problemOf(err)
+	}
+	if p.Status == 0 {
+		p.Status = http.StatusInternalServerError
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.Status >= 500 {
+		c.logger.Printf("sihttp: %s %s: %v", r.Method, r.URL.Path, err)
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+
+	wr := sicore.GetWriter(w, sicore.SetJsonEncoder())
+	defer sicore.PutWriter(wr)
+	wr.EncodeFlush(p)
+}
+
+type validationError struct {
+	err error
+}
+
+func (e *validationError) Error() string {
+	return e.err.Error()
+}
+
+func (e *validationError) Unwrap() error {
+	return e.err
+}
+
+func problemOf(err error) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		cp := *p
+		return &cp
+	}
+
+	var he *Error
+	if errors.As(err, &he) {
+		switch he.Kind {
+		case ErrorKindClient, ErrorKindServer:
+			if he.Problem != nil {
+				cp := *he.Problem
+				cp.Status = he.Response.StatusCode
+				return &cp
+			}
+			return &Problem{Status: he.Response.StatusCode}
+		case ErrorKindTimeout:
+			return &Problem{Status: http.StatusGatewayTimeout}
+		}
+		return &Problem{Status: http.StatusBadGateway}
+	}
+
+	var fe FieldErrors
+	if errors.As(err, &fe) {
+		errs := make(map[string]any, len(fe))
+		for k, v := range fe {
+			errs[k] = v
+		}
+		return &Problem{
+			Status:     http.StatusUnprocessableEntity,
+			Detail:     "validation failed",
+			Extensions: map[string]any{"errors": errs},
+		}
+	}
+
+	var ve *validationError
+	if errors.As(err, &ve) {
+		return &Problem{Status: http.StatusUnprocessableEntity, Detail: ve.Error()}
+	}
+
+	var me *http.MaxBytesError
+	if errors.As(err, &me) {
+		return &Problem{Status: http.StatusRequestEntityTooLarge}
+	}
+
+	var be *BindError
+	if errors.As(err, &be) {
+		return &Problem{Status: http.StatusBadRequest, Detail: be.Error()}
+	}
+
+	return &Problem{Status: http.StatusInternalServerError}
+}
+
+// bindRequest binds r into a new Req. If Req is a pointer, a new value it points to is allocated.
+func bindRequest[Req any](r *http.Request) (Req, error) {
+	var req Req
+	rv := reflect.ValueOf(&req).Elem()
+	if rv.Kind() == reflect.Pointer {
+		rv.Set(reflect.New(rv.Type().Elem()))
+		rv = rv.Elem()
+	}
+
+	if r.Body != nil && r.Body != http.NoBody && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		rd := sicore.GetReader(r.Body, sicore.SetJsonDecoder())
+		err := rd.Decode(rv.Addr().Interface())
+		sicore.PutReader(rd)
+		if err != nil && err != io.EOF {
+			var me *http.MaxBytesError
+			if errors.As(err, &me) {
+				return req, err
+			}
+			return req, &BindError{Source: "body", Err: err}
+		}
+	}
+
+	if rv.Kind() == reflect.Struct {
+		if err := bindFields(r, rv); err != nil {
+			return req, err
+		}
+	}
+
+	var target any = req
+	if _, ok := target.(Validator); !ok && rv.CanAddr() {
+		target = rv.Addr().Interface()
+	}
+	if v, ok := target.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			var fe FieldErrors
+			var p *Problem
+			if errors.As(err, &fe) || errors.As(err, &p) {
+				return req, err
+			}
+			return req, &validationError{err}
+		}
+	}
+	return req, nil
+}
+
+func bindFields(r *http.Request, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		fv := rv.Field(i)
+
+		if sf.Anonymous && fv.Kind() == reflect.Struct {
+			if err := bindFields(r, fv); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var source, name string
+		var values []string
+		if name = sf.Tag.Get("path"); name != "" {
+			source = "path"
+			if v := PathParam(r, name); v != "" {
+				values = []string{v}
+			}
+		} else if name = sf.Tag.Get("query"); name != "" {
+			source = "query"
+			values = r.URL.Query()[name]
+		} else if name = sf.Tag.Get("header"); name != "" {
+			source = "header"
+			values = r.Header.Values(name)
+		} else {
+			continue
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		if err := setFieldValues(fv, values); err != nil {
+			return &BindError{Source: source, Field: name, Err: err}
+		}
+	}
+	return nil
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+func setFieldValues(fv reflect.Value, values []string) error {
+	if fv.Kind() == reflect.Slice && !fv.Type().Implements(textUnmarshalerType) &&
+		!reflect.PointerTo(fv.Type()).Implements(textUnmarshalerType) {
+		s := reflect.MakeSlice(fv.Type(), len(values), len(values))
+		for i, v := range values {
+			if err := setFieldValue(s.Index(i), v); err != nil {
+				return err
+			}
+		}
+		fv.Set(s)
+		return nil
+	}
+	return setFieldValue(fv, values[0])
+}
+
+func setFieldValue(fv reflect.Value, value string) error {
+	if fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		fv = fv.Elem()
+	}
+
+	if fv.CanAddr() {
+		if tu, ok := fv.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return tu.UnmarshalText([]byte(value))
+		}
+	}
+
+	if fv.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package sihttp
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	hedgingWindow     = 128
+	hedgingMinSamples = 10
+)
+
+// WithHedging sends a second attempt of GET and HEAD requests if the first one hasn't responded within the
+// percentile, eg. 95, of recent response latencies, and takes whichever responds first. The other attempt is
+// canceled. initialDelay is used until enough latencies are observed.
+//
+// Hedging trades extra load on the server for lower tail latency, so it should be enabled only for idempotent and
+// latency sensitive requests.
+func WithHedging(percentile float64, initialDelay time.Duration) ClientOptionFunc {
+	return ClientOptionFunc(func(c *Client) error {
+		if percentile <= 0 || percentile > 100 {
+			percentile = 95
+		}
+		c.hedging = &hedging{
+			percentile:   percentile,
+			initialDelay: initialDelay,
+		}
+		return nil
+	})
+}
+
+type hedging struct {
+	percentile   float64
+	initialDelay time.Duration
+
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+// delay returns the current delay before the second attempt.
+func (h *hedging) delay() time.Duration {
+	h.mu.Lock()
+	if len(h.samples) < hedgingMinSamples {
+		h.mu.Unlock()
+		return h.initialDelay
+	}
+	sorted := append([]time.Duration(nil), h.samples...)
+	h.mu.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(math.Ceil(h.percentile/100*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+func (h *hedging) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.samples) < hedgingWindow {
+		h.samples = append(h.samples, d)
+		return
+	}
+	h.samples[h.next] = d
+	h.next = (h.next + 1) % hedgingWindow
+}
+
+type hedgeResult struct {
+	resp  *http.Response
+	err   error
+	index int
+}
+
+func (h *hedging) do(req *http.Request, send func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return send(req)
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return send(req)
+	}
+
+	results := make(chan hedgeResult, 2)
+	var cancels []context.CancelFunc
+	attempt := func() error {
+		r := req.Clone(req.Context())
+		if req.GetBody != nil && req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return err
+			}
+			r.Body = body
+		}
+		ctx, cancel := context.WithCancel(req.Context())
+		cancels = append(cancels, cancel)
+		index := len(cancels) - 1
+		go func() {
+			resp, err := send(r.WithContext(ctx))
+			results <- hedgeResult{resp: resp, err: err, index: index}
+		}()
+		return nil
+	}
+
+	// latencies are observed from the first attempt, as a hedged response is not faster than that to the caller and
+	// observing its own latency would shrink the delay and hedge more and more requests
+	start := time.Now()
+	if err := attempt(); err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(h.delay())
+	defer timer.Stop()
+
+	received := 0
+	for {
+		select {
+		case <-timer.C:
+			if len(cancels) < 2 {
+				// the first attempt goes on alone if the body cannot be sent again
+				attempt()
+			}
+		case res := <-results:
+			received++
+			if res.err == nil {
+				h.observe(time.Since(start))
+				for i, cancel := range cancels {
+					if i != res.index {
+						cancel()
+					}
+				}
+				if pending := len(cancels) - received; pending > 0 {
+					go discardHedgeResults(results, pending)
+				}
+				return cancelOnClose(res.resp, nil, cancels[res.index])
+			}
+
+			cancels[res.index]()
+			if received == len(cancels) {
+				return nil, res.err
+			}
+		}
+	}
+}
+
+// discardHedgeResults closes the responses of the attempts that lost.
+func discardHedgeResults(results <-chan hedgeResult, n int) {
+	for i := 0; i < n; i++ {
+		res := <-results
+		if res.err == nil {
+			res.resp.Body.Close()
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package sihttp
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Algorithms of HTTP Message Signatures(RFC 9421).
+const (
+	SignatureAlgHmacSha256      = "hmac-sha256"
+	SignatureAlgEd25519         = "ed25519"
+	SignatureAlgRsaPssSha512    = "rsa-pss-sha512"
+	SignatureAlgRsaV15Sha256    = "rsa-v1_5-sha256"
+	SignatureAlgEcdsaP256Sha256 = "ecdsa-p256-sha256"
+)
+
+const defaultSignatureLabel = "sig1"
+
+var (
+	ErrUnsupportedSignatureAlg       = errors.New("sihttp: unsupported signature algorithm")
+	ErrUnsupportedSignatureComponent = errors.New("sihttp: unsupported signature component")
+	ErrInvalidSignatureKey           = errors.New("sihttp: invalid key for signature algorithm")
+)
+
+// HttpMessageSigner signs requests with HTTP Message Signatures(RFC 9421).
+type HttpMessageSigner struct {
+	// Label is the signature label, `sig1` by default.
+	Label string
+	KeyID string
+	// Algorithm is one of SignatureAlg constants.
+	Algorithm string
+	// Key is []byte for hmac-sha256, ed25519.PrivateKey, *rsa.PrivateKey or *ecdsa.PrivateKey.
+	Key any
+	// IncludeAlg adds `alg` parameter to the signature parameters.
+	IncludeAlg bool
+
+	// Components are covered components. Derived components start with `@`, eg. `@method`, `@authority`, `@path`,
+	// `@query`, `@target-uri`, `@request-target`, `@scheme`. Others are header names. If `content-digest` is
+	// covered and the request doesn't have it, `Content-Digest` is computed from the body with sha-256.
+	Components []string
+
+	// Expires sets `expires` parameter to created + Expires if it is greater than 0.
+	Expires time.Duration
+	Nonce   string
+	Tag     string
+}
+
+// Sign sets `Signature-Input` and `Signature` headers to req with `created` parameter set to created.
+func (s *HttpMessageSigner) Sign(req *http.Request, created time.Time) error {
+	label := s.Label
+	if label == "" {
+		label = defaultSignatureLabel
+	}
+
+	for _, c := range s.Components {
+		if strings.ToLower(c) == "content-digest" && req.Header.Get("Content-Digest") == "" {
+			body, err := readRequestBody(req)
+			if err != nil {
+				return err
+			}
+			sum := sha256.Sum256(body)
+			req.Header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+		}
+	}
+
+	params := s.signatureParams(created)
+	base, err := SignatureBase(req, s.Components, params)
+	if err != nil {
+		return err
+	}
+
+	sig, err := s.sign([]byte(base))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Add("Signature-Input", label+"="+params)
+	req.Header.Add("Signature", label+"=:"+base64.StdEncoding.EncodeToString(sig)+":")
+	return nil
+}
+
+func (s *HttpMessageSigner) signatureParams(created time.Time) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for i, c := range s.Components {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(strconv.Quote(strings.ToLower(c)))
+	}
+	b.WriteByte(')')
+
+	b.WriteString(";created=" + strconv.FormatInt(created.Unix(), 10))
+	if s.Expires > 0 {
+		b.WriteString(";expires=" + strconv.FormatInt(created.Add(s.Expires).Unix(), 10))
+	}
+	if s.KeyID != "" {
+		b.WriteString(";keyid=" + strconv.Quote(s.KeyID))
+	}
+	if s.IncludeAlg {
+		b.WriteString(";alg=" + strconv.Quote(s.Algorithm))
+	}
+	if s.Nonce != "" {
+		b.WriteString(";nonce=" + strconv.Quote(s.Nonce))
+	}
+	if s.Tag != "" {
+		b.WriteString(";tag=" + strconv.Quote(s.Tag))
+	}
+	return b.String()
+}
+
+func (s *HttpMessageSigner) sign(base []byte) ([]byte, error) {
+	switch s.Algorithm {
+	case SignatureAlgHmacSha256:
+		key, ok := s.Key.([]byte)
+		if !ok {
+			return nil, ErrInvalidSignatureKey
+		}
+		return hmacSha256(key, base), nil
+	case SignatureAlgEd25519:
+		key, ok := s.Key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, ErrInvalidSignatureKey
+		}
+		return ed25519.Sign(key, base), nil
+	case SignatureAlgRsaPssSha512:
+		key, ok := s.Key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, ErrInvalidSignatureKey
+		}
+		h := sha512.Sum512(base)
+		return rsa.SignPSS(rand.Reader, key, crypto.SHA512, h[:], &rsa.PSSOptions{SaltLength: 64})
+	case SignatureAlgRsaV15Sha256:
+		key, ok := s.Key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, ErrInvalidSignatureKey
+		}
+		h := sha256.Sum256(base)
+		return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, h[:])
+	case SignatureAlgEcdsaP256Sha256:
+		key, ok := s.Key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, ErrInvalidSignatureKey
+		}
+		h := sha256.Sum256(base)
+		r, ss, err := ecdsa.Sign(rand.Reader, key, h[:])
+		if err != nil {
+			return nil, err
+		}
+		// r and s are encoded as 32 bytes big-endian integers each
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		ss.FillBytes(sig[32:])
+		return sig, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedSignatureAlg, s.Algorithm)
+}
+
+// SignatureBase creates the signature base of req over components as described in RFC 9421 section 2.5.
+// params is the serialized signature parameters, eg. `("@method" "@path");created=1618884473;keyid="key"`.
+func SignatureBase(req *http.Request, components []string, params string) (string, error) {
+	var b strings.Builder
+	for _, c := range components {
+		name := strings.ToLower(c)
+		value, err := componentValue(req, name)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(strconv.Quote(name))
+		b.WriteString(": ")
+		b.WriteString(value)
+		b.WriteByte('\n')
+	}
+	b.WriteString(`"@signature-params": `)
+	b.WriteString(params)
+	return b.String(), nil
+}
+
+func componentValue(req *http.Request, name string) (string, error) {
+	switch name {
+	case "@method":
+		return req.Method, nil
+	case "@authority":
+		return requestHost(req), nil
+	case "@scheme":
+		return strings.ToLower(req.URL.Scheme), nil
+	case "@target-uri":
+		u := *req.URL
+		u.Host = requestHost(req)
+		return u.String(), nil
+	case "@request-target":
+		return req.URL.RequestURI(), nil
+	case "@path":
+		if p := req.URL.EscapedPath(); p != "" {
+			return p, nil
+		}
+		return "/", nil
+	case "@query":
+		return "?" + req.URL.RawQuery, nil
+	}
+	if strings.HasPrefix(name, "@") {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedSignatureComponent, name)
+	}
+
+	values := req.Header.Values(name)
+	if len(values) == 0 {
+		switch {
+		case name == "host":
+			return requestHost(req), nil
+		case name == "content-length" && req.ContentLength >= 0 && req.Body != nil:
+			return strconv.FormatInt(req.ContentLength, 10), nil
+		}
+		return "", fmt.Errorf("%w: header %s is missing", ErrUnsupportedSignatureComponent, name)
+	}
+	trimmed := make([]string, len(values))
+	for i, v := range values {
+		trimmed[i] = strings.TrimSpace(v)
+	}
+	return strings.Join(trimmed, ", "), nil
+}
+
+// WithHttpMessageSignature signs a request with signer at the current time.
+func WithHttpMessageSignature(signer *HttpMessageSigner) RequestOptionFunc {
+	return RequestOptionFunc(func(req *http.Request) error {
+		return signer.Sign(req, time.Now())
+	})
+}
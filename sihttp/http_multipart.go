@@ -0,0 +1,148 @@
+package sihttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	"github.com/go-wonk/si/v2/sicore"
+)
+
+type multipartPart struct {
+	fieldName   string
+	fileName    string
+	contentType string
+	value       string
+	r           io.Reader
+}
+
+// MultipartBuilder builds a multipart/form-data body from fields and files. The body is streamed through
+// io.Pipe instead of being buffered in memory, so a MultipartBuilder can be sent only once.
+//
+// Request options that need the whole body read it into memory before the request is sent: WithRequestCompression,
+// WithAwsSigV4 unless UnsignedPayload is set, and WithHttpMessageSignature covering `content-digest`, whichever
+// algorithm such as HMAC is used. WithHeaderHmac256 skips multipart bodies.
+type MultipartBuilder struct {
+	parts    []multipartPart
+	progress ProgressFunc
+}
+
+// NewMultipartBuilder returns an empty MultipartBuilder.
+func NewMultipartBuilder() *MultipartBuilder {
+	return &MultipartBuilder{}
+}
+
+// AddField adds a form field.
+func (mb *MultipartBuilder) AddField(name, value string) *MultipartBuilder {
+	mb.parts = append(mb.parts, multipartPart{fieldName: name, value: value})
+	return mb
+}
+
+// AddFile adds a file part read from r. If contentType is empty, `application/octet-stream` is used.
+// r is not closed by MultipartBuilder.
+func (mb *MultipartBuilder) AddFile(fieldName, fileName, contentType string, r io.Reader) *MultipartBuilder {
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	mb.parts = append(mb.parts, multipartPart{fieldName: fieldName, fileName: fileName, contentType: contentType, r: r})
+	return mb
+}
+
+// WithProgress sets progress to be called as the body is written. total is always -1.
+func (mb *MultipartBuilder) WithProgress(progress ProgressFunc) *MultipartBuilder {
+	mb.progress = progress
+	return mb
+}
+
+// Build starts writing the body in a goroutine and returns the read end of the pipe with its Content-Type.
+// The returned body must be consumed or closed.
+func (mb *MultipartBuilder) Build() (io.ReadCloser, string) {
+	pr, pw := io.Pipe()
+
+	var w io.Writer = pw
+	if mb.progress != nil {
+		w = &progressWriter{w: pw, total: -1, progress: mb.progress}
+	}
+	mw := multipart.NewWriter(w)
+
+	go func() {
+		pw.CloseWithError(mb.writeParts(mw))
+	}()
+
+	return pr, mw.FormDataContentType()
+}
+
+func (mb *MultipartBuilder) writeParts(mw *multipart.Writer) error {
+	for _, p := range mb.parts {
+		if p.r == nil {
+			if err := mw.WriteField(p.fieldName, p.value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition",
+			fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(p.fieldName), escapeQuotes(p.fileName)))
+		h.Set("Content-Type", p.contentType)
+		pw, err := mw.CreatePart(h)
+		if err != nil {
+			return err
+		}
+
+		sr := sicore.GetReader(p.r)
+		_, err = sr.WriteTo(pw)
+		sicore.PutReader(sr)
+		if err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+func (hc *Client) PostMultipart(url string, header http.Header, mb *MultipartBuilder, opts ...RequestOption) ([]byte, error) {
+	return hc.RequestMultipartContext(context.Background(), http.MethodPost, url, header, mb, opts...)
+}
+func (hc *Client) PostMultipartContext(ctx context.Context, url string, header http.Header, mb *MultipartBuilder, opts ...RequestOption) ([]byte, error) {
+	return hc.RequestMultipartContext(ctx, http.MethodPost, url, header, mb, opts...)
+}
+
+func (hc *Client) PutMultipart(url string, header http.Header, mb *MultipartBuilder, opts ...RequestOption) ([]byte, error) {
+	return hc.RequestMultipartContext(context.Background(), http.MethodPut, url, header, mb, opts...)
+}
+func (hc *Client) PutMultipartContext(ctx context.Context, url string, header http.Header, mb *MultipartBuilder, opts ...RequestOption) ([]byte, error) {
+	return hc.RequestMultipartContext(ctx, http.MethodPut, url, header, mb, opts...)
+}
+
+func (hc *Client) PatchMultipart(url string, header http.Header, mb *MultipartBuilder, opts ...RequestOption) ([]byte, error) {
+	return hc.RequestMultipartContext(context.Background(), http.MethodPatch, url, header, mb, opts...)
+}
+func (hc *Client) PatchMultipartContext(ctx context.Context, url string, header http.Header, mb *MultipartBuilder, opts ...RequestOption) ([]byte, error) {
+	return hc.RequestMultipartContext(ctx, http.MethodPatch, url, header, mb, opts...)
+}
+
+// RequestMultipartContext sends the body built by mb with `method`. Since the body is streamed, the request is not
+// retried.
+func (hc *Client) RequestMultipartContext(ctx context.Context, method string, url string, header http.Header, mb *MultipartBuilder, opts ...RequestOption) ([]byte, error) {
+	body, contentType := mb.Build()
+	defer body.Close()
+
+	// set Content-Type, overwrite existing Content-Type
+	h := header.Clone()
+	if h == nil {
+		h = make(http.Header)
+	}
+	h["Content-Type"] = []string{contentType}
+
+	return hc.request(ctx, method, hc.baseUrl+url, h, nil, body, opts...)
+}
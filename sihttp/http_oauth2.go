@@ -0,0 +1,173 @@
+package sihttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const defaultTokenRefreshBefore = 30 * time.Second
+
+var errTokenSourcePanic = errors.New("sihttp: token source panicked")
+
+// TokenManager caches a token from an oauth2.TokenSource and refreshes it before it expires. Concurrent refreshes
+// are deduplicated so that only one request is sent to the token endpoint. TokenManager implements
+// oauth2.TokenSource.
+type TokenManager struct {
+	source        oauth2.TokenSource
+	refreshBefore time.Duration
+	now           func() time.Time
+
+	mu    sync.Mutex
+	token *oauth2.Token
+	call  *tokenCall
+}
+
+type tokenCall struct {
+	done  chan struct{}
+	token *oauth2.Token
+	err   error
+}
+
+// NewTokenManager returns TokenManager fetching tokens from source. A token is refreshed when it expires within
+// refreshBefore, 30 seconds if refreshBefore is 0. source should fetch a new token on every call rather than
+// caching it.
+func NewTokenManager(source oauth2.TokenSource, refreshBefore time.Duration) *TokenManager {
+	if refreshBefore <= 0 {
+		refreshBefore = defaultTokenRefreshBefore
+	}
+	return &TokenManager{
+		source:        source,
+		refreshBefore: refreshBefore,
+		now:           time.Now,
+	}
+}
+
+// NewClientCredentialsTokenManager returns TokenManager fetching tokens with OAuth2 client credentials flow.
+func NewClientCredentialsTokenManager(ctx context.Context, conf *clientcredentials.Config, refreshBefore time.Duration) *TokenManager {
+	return NewTokenManager(tokenSourceFunc(func() (*oauth2.Token, error) {
+		return conf.Token(ctx)
+	}), refreshBefore)
+}
+
+type tokenSourceFunc func() (*oauth2.Token, error)
+
+func (f tokenSourceFunc) Token() (*oauth2.Token, error) {
+	return f()
+}
+
+// Token returns the cached token, or fetches a new one if it is missing or about to expire. If refreshing fails
+// while the cached token has not expired yet, the cached token is returned.
+func (m *TokenManager) Token() (*oauth2.Token, error) {
+	m.mu.Lock()
+	cur := m.token
+	if m.fresh(cur) {
+		m.mu.Unlock()
+		return cur, nil
+	}
+
+	if c := m.call; c != nil {
+		m.mu.Unlock()
+		<-c.done
+		return m.result(c, cur)
+	}
+
+	c := &tokenCall{done: make(chan struct{})}
+	m.call = c
+	m.mu.Unlock()
+
+	m.fetch(c)
+	return m.result(c, cur)
+}
+
+// fetch fetches a token for c. If the source panics, waiters of c get errTokenSourcePanic and the panic goes on.
+func (m *TokenManager) fetch(c *tokenCall) {
+	defer func() {
+		m.mu.Lock()
+		if c.err == nil {
+			m.token = c.token
+		}
+		m.call = nil
+		m.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.err = errTokenSourcePanic
+	c.token, c.err = m.source.Token()
+}
+
+func (m *TokenManager) result(c *tokenCall, cur *oauth2.Token) (*oauth2.Token, error) {
+	if c.err != nil {
+		if cur != nil && cur.Valid() {
+			return cur, nil
+		}
+		return nil, c.err
+	}
+	return c.token, nil
+}
+
+// Invalidate discards token if it is the cached one, so that the next call to Token fetches a new token.
+func (m *TokenManager) Invalidate(token *oauth2.Token) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.token != nil && token != nil && m.token.AccessToken == token.AccessToken {
+		m.token = nil
+	}
+}
+
+func (m *TokenManager) fresh(t *oauth2.Token) bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	if t.Expiry.IsZero() {
+		return true
+	}
+	return m.now().Add(m.refreshBefore).Before(t.Expiry)
+}
+
+// doWithToken sends a clone of request with a token of hc.tokenManager, leaving the header of request as it is so
+// that it can be sent again with a fresh token. On 401 Unauthorized, the token is invalidated and the request is
+// retried once with a new token if the request body can be sent again.
+func (hc *Client) doWithToken(request *http.Request) (*http.Response, error) {
+	token, err := hc.tokenManager.Token()
+	if err != nil {
+		return nil, err
+	}
+	authorized := request.Clone(request.Context())
+	token.SetAuthHeader(authorized)
+
+	resp, err := hc.do(authorized)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	if request.Body != nil && request.Body != http.NoBody && request.GetBody == nil {
+		return resp, nil
+	}
+
+	hc.tokenManager.Invalidate(token)
+	newToken, err := hc.tokenManager.Token()
+	if err != nil {
+		return resp, nil
+	}
+
+	retry := request.Clone(request.Context())
+	if request.GetBody != nil {
+		body, err := request.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+	newToken.SetAuthHeader(retry)
+
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	return hc.do(retry)
+}
@@ -10,15 +10,39 @@ import (
 )
 
 type RequestOption interface {
-	apply(c *http.Request) error
+	// apply returns c modified in place, or a request derived from c
+	apply(c *http.Request) (*http.Request, error)
 }
 
 type RequestOptionFunc func(c *http.Request) error
 
-func (o RequestOptionFunc) apply(c *http.Request) error {
+func (o RequestOptionFunc) apply(c *http.Request) (*http.Request, error) {
+	return c, o(c)
+}
+
+// requestDeriveFunc is a RequestOption returning a new request derived from the given one, eg. with another context.
+type requestDeriveFunc func(c *http.Request) (*http.Request, error)
+
+func (o requestDeriveFunc) apply(c *http.Request) (*http.Request, error) {
 	return o(c)
 }
 
+// applyRequestOptions applies options of optss to req in order and returns the request to send.
+func applyRequestOptions(req *http.Request, optss ...[]RequestOption) (*http.Request, error) {
+	for _, opts := range optss {
+		for _, o := range opts {
+			if o == nil {
+				continue
+			}
+			var err error
+			if req, err = o.apply(req); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return req, nil
+}
+
 func WithHeaderSet(key string, value string) RequestOptionFunc {
 	return RequestOptionFunc(func(req *http.Request) error {
 		header := req.Header
@@ -164,3 +188,33 @@ func WithRetryAttempts(attempts int) ClientOptionFunc {
 		return nil
 	})
 }
+
+// WithCache sets cache to Client. GET responses are served from cache when they are fresh and revalidated when
+// they are stale.
+func WithCache(cache *Cache) ClientOptionFunc {
+	return ClientOptionFunc(func(c *Client) error {
+		c.cache = cache
+		return nil
+	})
+}
+
+// WithErrorBody registers T as the type of error response bodies. The body of a response with error status is
+// decoded into *T and set to Error.Decoded, see ErrorBodyAs.
+func WithErrorBody[T any]() ClientOptionFunc {
+	return ClientOptionFunc(func(c *Client) error {
+		c.errorBody = func() any {
+			return new(T)
+		}
+		return nil
+	})
+}
+
+// WithTokenManager sets Authorization header of requests with a token from m unless the header is already set.
+// If the server responds with 401 Unauthorized, the request is retried once with a new token, instead of the retries
+// of WithRetryAttempts.
+func WithTokenManager(m *TokenManager) ClientOptionFunc {
+	return ClientOptionFunc(func(c *Client) error {
+		c.tokenManager = m
+		return nil
+	})
+}
@@ -0,0 +1,242 @@
+package sihttp
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-wonk/si/v2/sicore"
+)
+
+const (
+	awsSigV4Algorithm   = "AWS4-HMAC-SHA256"
+	awsAmzDateFormat    = "20060102T150405Z"
+	awsShortDateFormat  = "20060102"
+	awsUnsignedPayload  = "UNSIGNED-PAYLOAD"
+	awsServiceS3        = "s3"
+	awsScopeTermination = "aws4_request"
+)
+
+// AwsSigV4Signer signs requests with AWS Signature Version 4.
+type AwsSigV4Signer struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Region          string
+	Service         string
+
+	// UnsignedPayload signs `UNSIGNED-PAYLOAD` instead of the hash of the body. It is only supported by S3.
+	UnsignedPayload bool
+
+	// SignedHeaders are headers to sign in addition to host, content-type, content-md5 and x-amz-* headers.
+	SignedHeaders []string
+}
+
+// Sign sets `X-Amz-Date` and `Authorization` headers to req with signing time t. For S3, `X-Amz-Content-Sha256`
+// is set as well.
+func (s *AwsSigV4Signer) Sign(req *http.Request, t time.Time) error {
+	t = t.UTC()
+	amzDate := t.Format(awsAmzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	payloadHash := awsUnsignedPayload
+	if !s.UnsignedPayload {
+		body, err := readRequestBody(req)
+		if err != nil {
+			return err
+		}
+		payloadHash = sha256Hex(body)
+	}
+	if s.Service == awsServiceS3 {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	canonicalHeaders, signedHeaders := s.canonicalHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s.canonicalURI(req),
+		awsCanonicalQuery(req),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := strings.Join([]string{t.Format(awsShortDateFormat), s.Region, s.Service, awsScopeTermination}, "/")
+	stringToSign := strings.Join([]string{
+		awsSigV4Algorithm,
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSha256([]byte("AWS4"+s.SecretAccessKey), []byte(t.Format(awsShortDateFormat)))
+	key = hmacSha256(key, []byte(s.Region))
+	key = hmacSha256(key, []byte(s.Service))
+	key = hmacSha256(key, []byte(awsScopeTermination))
+	signature := hex.EncodeToString(hmacSha256(key, []byte(stringToSign)))
+
+	req.Header.Set("Authorization", awsSigV4Algorithm+
+		" Credential="+s.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+
+		", Signature="+signature)
+	return nil
+}
+
+// canonicalURI encodes each segment of the decoded path twice, or once for S3.
+func (s *AwsSigV4Signer) canonicalURI(req *http.Request) string {
+	uri := req.URL.EscapedPath()
+	if uri == "" {
+		return "/"
+	}
+	segments := strings.Split(uri, "/")
+	for i, seg := range segments {
+		// segments are decoded one by one so that an encoded '/' stays in its segment
+		if decoded, err := url.PathUnescape(seg); err == nil {
+			seg = decoded
+		}
+		seg = awsEscape(seg)
+		if s.Service != awsServiceS3 {
+			seg = awsEscape(seg)
+		}
+		segments[i] = seg
+	}
+	return strings.Join(segments, "/")
+}
+
+func (s *AwsSigV4Signer) canonicalHeaders(req *http.Request) (string, string) {
+	values := map[string][]string{
+		"host": {requestHost(req)},
+	}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if lk == "content-type" || lk == "content-md5" || strings.HasPrefix(lk, "x-amz-") {
+			values[lk] = v
+		}
+	}
+	for _, h := range s.SignedHeaders {
+		lk := strings.ToLower(h)
+		if v := req.Header.Values(h); len(v) > 0 {
+			values[lk] = v
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for k := range values {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		vs := make([]string, len(values[name]))
+		for i, v := range values[name] {
+			vs[i] = strings.Join(strings.Fields(v), " ")
+		}
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(strings.Join(vs, ","))
+		b.WriteByte('\n')
+	}
+	return b.String(), strings.Join(names, ";")
+}
+
+func awsCanonicalQuery(req *http.Request) string {
+	query := req.URL.Query()
+	pairs := make([]string, 0, len(query))
+	for k, vs := range query {
+		ek := awsEscape(k)
+		for _, v := range vs {
+			pairs = append(pairs, ek+"="+awsEscape(v))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent-encodes s except for unreserved characters.
+func awsEscape(s string) string {
+	const hexUpper = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexUpper[c>>4])
+		b.WriteByte(hexUpper[c&15])
+	}
+	return b.String()
+}
+
+// WithAwsSigV4 signs a request with signer at the current time.
+func WithAwsSigV4(signer *AwsSigV4Signer) RequestOptionFunc {
+	return RequestOptionFunc(func(req *http.Request) error {
+		return signer.Sign(req, time.Now())
+	})
+}
+
+// readRequestBody returns the body of req without consuming it. If req.GetBody is nil, the body is read into memory
+// and req.Body and req.GetBody are replaced.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.GetBody != nil {
+		r, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return sicore.ReadAll(r)
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := sicore.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, nil
+}
+
+// requestHost returns the host of req without the default port of its scheme.
+func requestHost(req *http.Request) string {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	switch {
+	case req.URL.Scheme == "http" && strings.HasSuffix(host, ":80"):
+		host = strings.TrimSuffix(host, ":80")
+	case req.URL.Scheme == "https" && strings.HasSuffix(host, ":443"):
+		host = strings.TrimSuffix(host, ":443")
+	}
+	return strings.ToLower(host)
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSha256(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
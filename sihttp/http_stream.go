@@ -0,0 +1,364 @@
+package sihttp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-wonk/si/v2/sicore"
+)
+
+const defaultSSERetry = 3 * time.Second
+
+// ErrResourceChanged is returned by Download when a resumed download is answered with the whole body because the
+// resource no longer matches `If-Range` header.
+var ErrResourceChanged = errors.New("sihttp: resource changed since the download started")
+
+// SSEEvent is an event dispatched from a Server-Sent Events stream.
+type SSEEvent struct {
+	ID    string
+	Event string
+	Data  string
+	Retry time.Duration
+}
+
+// SSEHandler is called with every event received by SubscribeSSE. Returning an error stops the subscription.
+type SSEHandler func(event *SSEEvent) error
+
+// SSEReader parses a `text/event-stream` body.
+type SSEReader struct {
+	br     *bufio.Reader
+	lastID string
+	retry  time.Duration
+}
+
+// NewSSEReader returns SSEReader reading from r.
+func NewSSEReader(r io.Reader) *SSEReader {
+	return &SSEReader{br: bufio.NewReader(r)}
+}
+
+// LastEventID returns the last event id received, it is sent as `Last-Event-ID` on reconnection.
+func (sr *SSEReader) LastEventID() string {
+	return sr.lastID
+}
+
+// Retry returns the reconnection time set by the server. It returns 0 if the server has not set it.
+func (sr *SSEReader) Retry() time.Duration {
+	return sr.retry
+}
+
+// Next reads until an event is dispatched. An incomplete event at the end of the stream is discarded and
+// io.EOF is returned.
+func (sr *SSEReader) Next() (*SSEEvent, error) {
+	var data bytes.Buffer
+	hasData := false
+	eventType := ""
+
+	for {
+		line, err := sr.br.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return nil, io.EOF
+			}
+			return nil, err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		if line == "" {
+			if !hasData {
+				eventType = ""
+				continue
+			}
+			if eventType == "" {
+				eventType = "message"
+			}
+			return &SSEEvent{
+				ID:    sr.lastID,
+				Event: eventType,
+				Data:  strings.TrimSuffix(data.String(), "\n"),
+				Retry: sr.retry,
+			}, nil
+		}
+
+		if line[0] == ':' {
+			// comment
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				sr.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseInt(value, 10, 64); err == nil && ms >= 0 {
+				sr.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+// SubscribeSSE connects to `url` and calls handler with every event received. When the connection fails or is lost,
+// it reconnects after the retry delay sent by the server(3 seconds by default) with `Last-Event-ID` header set.
+// It returns when ctx is done, handler returns an error, the server responds with an error status or
+// 204 No Content, or the request fails before it is sent, eg. fetching a token or applying opts fails. It also
+// returns ErrDecompressedTooLarge if an event exceeds the limit of WithDecompression.
+func (hc *Client) SubscribeSSE(ctx context.Context, url string, header http.Header, handler SSEHandler, opts ...RequestOption) error {
+	lastID := ""
+	retry := defaultSSERetry
+	for {
+		req, err := hc.newRequest(ctx, http.MethodGet, hc.baseUrl+url, header, nil, nil, opts...)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		req.Header.Set("Cache-Control", "no-cache")
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+
+		resp, err := hc.roundTrip(withoutCache(req))
+		if err != nil {
+			// only failures to send the request or to receive the response are retried
+			var rt *roundTripError
+			if !errors.As(err, &rt) {
+				return err
+			}
+		} else {
+			if resp.StatusCode == http.StatusNoContent {
+				resp.Body.Close()
+				return nil
+			}
+			if isErrorStatus(resp.StatusCode) {
+				return hc.newResponseError(resp)
+			}
+
+			sr := NewSSEReader(resp.Body)
+			for {
+				ev, rerr := sr.Next()
+				if sr.Retry() > 0 {
+					retry = sr.Retry()
+				}
+				lastID = sr.LastEventID()
+				if rerr != nil {
+					if errors.Is(rerr, ErrDecompressedTooLarge) {
+						resp.Body.Close()
+						return rerr
+					}
+					break
+				}
+				if herr := handler(ev); herr != nil {
+					resp.Body.Close()
+					return herr
+				}
+			}
+			resp.Body.Close()
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		t := time.NewTimer(retry)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// NDJSONReader decodes newline delimited json, one value per line.
+type NDJSONReader struct {
+	rc io.ReadCloser
+	r  *sicore.Reader
+}
+
+// NewNDJSONReader returns NDJSONReader reading from rc. Close must be called to release resources.
+func NewNDJSONReader(rc io.ReadCloser) *NDJSONReader {
+	return &NDJSONReader{
+		rc: rc,
+		r:  sicore.GetReader(rc),
+	}
+}
+
+// Next decodes the next line into v. Empty lines are skipped. It returns io.EOF when there is no more line.
+func (nr *NDJSONReader) Next(v any) error {
+	if nr.r == nil {
+		return io.EOF
+	}
+	for {
+		line, err := nr.r.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		return json.Unmarshal(line, v)
+	}
+}
+
+// Close closes underlying body.
+func (nr *NDJSONReader) Close() error {
+	if nr.r == nil {
+		return nil
+	}
+	sicore.PutReader(nr.r)
+	nr.r = nil
+	return nr.rc.Close()
+}
+
+// GetNDJSON sends a GET request and returns NDJSONReader iterating over the response body.
+func (hc *Client) GetNDJSON(ctx context.Context, url string, header http.Header, queries map[string]string, opts ...RequestOption) (*NDJSONReader, error) {
+	req, err := hc.newRequest(ctx, http.MethodGet, hc.baseUrl+url, header, queries, nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/x-ndjson")
+	}
+
+	resp, err := hc.roundTrip(withoutCache(req))
+	if err != nil {
+		return nil, doError(err)
+	}
+	if isErrorStatus(resp.StatusCode) {
+		return nil, hc.newResponseError(resp)
+	}
+
+	return NewNDJSONReader(resp.Body), nil
+}
+
+// ProgressFunc reports the number of bytes transferred so far and the expected total. total is -1 if unknown.
+type ProgressFunc func(transferred, total int64)
+
+type progressWriter struct {
+	w           io.Writer
+	transferred int64
+	total       int64
+	progress    ProgressFunc
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.transferred += int64(n)
+	if pw.progress != nil {
+		pw.progress(pw.transferred, pw.total)
+	}
+	return n, err
+}
+
+// Download sends a GET request and writes the response body to dst. If offset is greater than 0, the download
+// resumes from offset with `Range` header. When the server ignores `Range` and responds with the whole body,
+// the first offset bytes are discarded. It returns the number of bytes written to dst.
+//
+// A resumed download is only consistent if the resource has not changed since the first offset bytes were
+// downloaded. Set `If-Range` header in header to the `ETag` or `Last-Modified` of the first response, then the server
+// responds with the whole body if the resource has changed and Download fails with ErrResourceChanged without
+// writing to dst. Without `If-Range`, the parts of different versions are joined.
+func (hc *Client) Download(ctx context.Context, url string, header http.Header, dst io.Writer, offset int64, progress ProgressFunc, opts ...RequestOption) (int64, error) {
+	req, err := hc.newRequest(ctx, http.MethodGet, hc.baseUrl+url, header, nil, nil, opts...)
+	if err != nil {
+		return 0, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := hc.roundTrip(withoutCache(req))
+	if err != nil {
+		return 0, doError(err)
+	}
+	defer resp.Body.Close()
+
+	var total int64 = -1
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		if resp.ContentLength >= 0 {
+			total = offset + resp.ContentLength
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// already complete if the size of the resource equals to offset
+		if size, ok := contentRangeSize(resp.Header.Get("Content-Range")); ok && size == offset {
+			if progress != nil {
+				progress(offset, offset)
+			}
+			return 0, nil
+		}
+		return 0, hc.newResponseError(resp)
+	case isErrorStatus(resp.StatusCode):
+		return 0, hc.newResponseError(resp)
+	case offset > 0 && req.Header.Get("If-Range") != "":
+		return 0, ErrResourceChanged
+	default:
+		total = resp.ContentLength
+		if offset > 0 {
+			if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	pw := &progressWriter{w: dst, transferred: offset, total: total, progress: progress}
+	r := sicore.GetReader(resp.Body)
+	defer sicore.PutReader(r)
+
+	return r.WriteTo(pw)
+}
+
+// DownloadFile downloads to fileName. If fileName already exists, the download resumes from the end of the file, set
+// `If-Range` header as Download describes to detect a changed resource.
+func (hc *Client) DownloadFile(ctx context.Context, url string, header http.Header, fileName string, progress ProgressFunc, opts ...RequestOption) (int64, error) {
+	f, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return 0, err
+	}
+
+	n, err := hc.Download(ctx, url, header, f, st.Size(), progress, opts...)
+	if cerr := f.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// contentRangeSize parses the complete length of `Content-Range`. eg. `bytes */1234`, `bytes 0-9/1234`
+func contentRangeSize(contentRange string) (int64, bool) {
+	_, size, ok := strings.Cut(contentRange, "/")
+	if !ok || size == "*" {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
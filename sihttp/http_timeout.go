@@ -0,0 +1,131 @@
+package sihttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultDeadlineHeader carries the remaining time of the caller's deadline in milliseconds.
+const DefaultDeadlineHeader = "X-Request-Timeout"
+
+type requestTimeoutKey struct{}
+
+// WithRequestTimeout limits the time of a request to d, including reading the response body. The timeout applies
+// on top of the deadline of the request context, whichever is earlier.
+func WithRequestTimeout(d time.Duration) RequestOption {
+	return requestDeriveFunc(func(req *http.Request) (*http.Request, error) {
+		return req.WithContext(context.WithValue(req.Context(), requestTimeoutKey{}, d)), nil
+	})
+}
+
+// WithDefaultTimeout limits the time of requests to d if neither the request context has a deadline nor
+// WithRequestTimeout is set.
+func WithDefaultTimeout(d time.Duration) ClientOptionFunc {
+	return ClientOptionFunc(func(c *Client) error {
+		c.defaultTimeout = d
+		return nil
+	})
+}
+
+// WithDeadlinePropagation sets header, DefaultDeadlineHeader if empty, to the time remaining until the deadline of
+// the request context in milliseconds, so that the server can stop working on requests the client has given up on.
+// See Deadline for the server side.
+func WithDeadlinePropagation(header string) ClientOptionFunc {
+	return ClientOptionFunc(func(c *Client) error {
+		if header == "" {
+			header = DefaultDeadlineHeader
+		}
+		c.deadlineHeader = header
+		return nil
+	})
+}
+
+// withTimeout returns request with the timeout applied to its context. The returned cancel is nil if there is no
+// timeout.
+func (hc *Client) withTimeout(request *http.Request) (*http.Request, context.CancelFunc) {
+	ctx := request.Context()
+	timeout, ok := ctx.Value(requestTimeoutKey{}).(time.Duration)
+	if !ok {
+		if _, hasDeadline := ctx.Deadline(); hasDeadline || hc.defaultTimeout <= 0 {
+			return request, nil
+		}
+		timeout = hc.defaultTimeout
+	}
+	if timeout <= 0 {
+		return request, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return request.WithContext(ctx), cancel
+}
+
+// propagateDeadline sets the deadline header of request if the deadline propagation is enabled.
+func (hc *Client) propagateDeadline(request *http.Request) {
+	if hc.deadlineHeader == "" {
+		return
+	}
+	deadline, ok := request.Context().Deadline()
+	if !ok {
+		return
+	}
+	remaining := time.Until(deadline).Milliseconds()
+	if remaining < 0 {
+		remaining = 0
+	}
+	request.Header.Set(hc.deadlineHeader, strconv.FormatInt(remaining, 10))
+}
+
+// cancelOnClose cancels the context of a request when the body of its response is closed, since the body is read
+// after Do returns.
+func cancelOnClose(resp *http.Response, err error, cancel context.CancelFunc) (*http.Response, error) {
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// Deadline applies the deadline propagated by clients in header, DefaultDeadlineHeader if empty, to the request
+// context. The deadline is capped to max unless max is 0. Requests whose deadline has already passed are rejected
+// with 504 Gateway Timeout without calling the handler.
+func Deadline(header string, max time.Duration) Middleware {
+	if header == "" {
+		header = DefaultDeadlineHeader
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ms, err := strconv.ParseInt(r.Header.Get(header), 10, 64)
+			if err != nil || ms < 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if ms == 0 {
+				http.Error(w, http.StatusText(http.StatusGatewayTimeout), http.StatusGatewayTimeout)
+				return
+			}
+
+			timeout := time.Duration(ms) * time.Millisecond
+			if max > 0 && timeout > max {
+				timeout = max
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
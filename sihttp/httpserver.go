@@ -3,17 +3,42 @@ package sihttp
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/handlers"
 )
 
+const (
+	defaultShutdownTimeout = 30 * time.Second
+)
+
 type Server struct {
 	TLSConf *tls.Config
 	Server  *http.Server
 	pem     string
 	key     string
+
+	ready           atomic.Bool
+	shutdownTimeout time.Duration
+	drainDelay      time.Duration
+
+	middlewares []Middleware
+	cors        []handlers.CORSOption
+	endpoints   map[string]http.Handler
+
+	http2        bool
+	h2c          bool
+	clientCAs    *x509.CertPool
+	verifyClient func(cert *x509.Certificate) error
+	certReloader *CertReloader
 }
 
 func NewServer(handler http.Handler, tlsConfig *tls.Config,
@@ -30,51 +55,175 @@ func NewServerTls(handler http.Handler, tlsConfig *tls.Config,
 	return NewServerCors(handler, tlsConfig, addr, writeTimeout, readTimeout, pem, key, nil, nil, nil)
 
 }
+
+// NewServerCors creates Server with CORS allowed for allowedOrigins, allowedHeaders and allowedMethods if any is given.
+// It panics if the server cannot be configured, use NewServerWith to get the error instead.
 func NewServerCors(handler http.Handler, tlsConfig *tls.Config,
 	addr string, writeTimeout, readTimeout time.Duration,
 	pem string, key string,
 	allowedOrigins, allowedHeaders, allowedMethods []string) *Server {
 
-	var hs Server
-	hs.TLSConf = tlsConfig
-	hs.Server = &http.Server{
-		Addr:         addr,
-		TLSConfig:    hs.TLSConf,
-		TLSNextProto: make(map[string]func(*http.Server, *tls.Conn, http.Handler), 0),
-		WriteTimeout: writeTimeout,
-		ReadTimeout:  readTimeout,
+	opts := []ServerOption{
+		WithServerTLSConfig(tlsConfig),
+		WithServerWriteTimeout(writeTimeout),
+		WithServerReadTimeout(readTimeout),
+	}
+	if len(pem) > 0 || len(key) > 0 {
+		opts = append(opts, WithCertFiles(pem, key))
+	}
+	if len(allowedOrigins) > 0 || len(allowedHeaders) > 0 || len(allowedMethods) > 0 {
+		opts = append(opts, WithCors(allowedOrigins, allowedHeaders, allowedMethods))
+	}
+
+	hs, err := NewServerWith(handler, addr, opts...)
+	if err != nil {
+		panic("sihttp: " + err.Error())
+	}
+	return hs
+}
+
+// NewServerWith creates Server listening on addr. handler is wrapped with middlewares of WithMiddleware, in the
+// order they are given, and CORS of WithCors, which runs first so that preflight requests are answered before
+// other middlewares. Endpoints of WithHealth and WithMetrics are served before all of them.
+func NewServerWith(handler http.Handler, addr string, opts ...ServerOption) (*Server, error) {
+	hs := &Server{
+		Server: &http.Server{
+			Addr:         addr,
+			TLSNextProto: make(map[string]func(*http.Server, *tls.Conn, http.Handler), 0),
+		},
+		shutdownTimeout: defaultShutdownTimeout,
 	}
-	hs.pem = pem
-	hs.key = key
 
-	if len(allowedOrigins) == 0 && len(allowedHeaders) == 0 && len(allowedMethods) == 0 {
-		hs.Server.Handler = handler
-	} else {
-		corsOrigin := handlers.AllowedOrigins(allowedOrigins)
-		corsHeaders := handlers.AllowedHeaders(allowedHeaders)
-		corsMethods := handlers.AllowedMethods(allowedMethods)
-		// nr := handlers.CORS(corsOrigin, corsHeaders, corsMethods)(hs.Router)
-		cors := handlers.CORS(corsOrigin, corsHeaders, corsMethods)
-		corsHandler := cors(handler)
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if err := o.apply(hs); err != nil {
+			return nil, err
+		}
+	}
 
-		hs.Server.Handler = corsHandler
+	handler = Chain(handler, hs.middlewares...)
+	if len(hs.cors) > 0 {
+		handler = handlers.CORS(hs.cors...)(handler)
+	}
+	if len(hs.endpoints) > 0 {
+		handler = withEndpoints(handler, hs.endpoints)
 	}
+	hs.Server.Handler = hs.withH2C(handler)
 
-	return &hs
+	if err := hs.configureTLS(); err != nil {
+		return nil, err
+	}
+	return hs, nil
 }
 
+// withEndpoints serves requests to paths of endpoints with their handlers and others with next.
+func withEndpoints(next http.Handler, endpoints map[string]http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := endpoints[r.URL.Path]; ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Start listens on the address of the server and serves requests. TLS is used if cert files or a CertReloader are
+// set. It returns
+// http.ErrServerClosed after Shutdown or Stop.
 func (hs *Server) Start() error {
-	var err error
-	if len(hs.pem) > 0 || len(hs.key) > 0 {
-		err = hs.Server.ListenAndServeTLS(hs.pem, hs.key)
-	} else {
-		err = hs.Server.ListenAndServe()
+	addr := hs.Server.Addr
+	if addr == "" {
+		if hs.useTLS() {
+			addr = ":https"
+		} else {
+			addr = ":http"
+		}
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return hs.Serve(ln)
+}
+
+// Serve serves requests on ln. The server is ready until Shutdown is called.
+func (hs *Server) Serve(ln net.Listener) error {
+	hs.ready.Store(true)
+	defer hs.ready.Store(false)
+
+	if hs.useTLS() {
+		return hs.Server.ServeTLS(ln, hs.pem, hs.key)
+	}
+	return hs.Server.Serve(ln)
+}
+
+func (hs *Server) useTLS() bool {
+	return len(hs.pem) > 0 || len(hs.key) > 0 || hs.certReloader != nil
+}
+
+// IsReady reports whether the server is serving and not shutting down.
+func (hs *Server) IsReady() bool {
+	return hs.ready.Load()
+}
+
+// SetReady sets readiness of the server, eg. to take it out of a load balancer before maintenance.
+func (hs *Server) SetReady(ready bool) {
+	hs.ready.Store(ready)
+}
+
+// Shutdown marks the server not ready, waits for the drain delay so that load balancers stop sending new requests,
+// then gracefully shuts down the server. If ctx is done before in-flight requests complete, remaining connections
+// are closed and the error of ctx is returned.
+func (hs *Server) Shutdown(ctx context.Context) error {
+	hs.ready.Store(false)
+
+	if hs.drainDelay > 0 {
+		t := time.NewTimer(hs.drainDelay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+		}
+	}
+
+	err := hs.Server.Shutdown(ctx)
+	if err != nil {
+		hs.Server.Close()
 	}
 	return err
 }
 
+// Stop shuts down the server with the shutdown timeout, 30 seconds by default.
 func (hs *Server) Stop() error {
-	return hs.Server.Shutdown(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), hs.drainDelay+hs.shutdownTimeout)
+	defer cancel()
+	return hs.Shutdown(ctx)
+}
+
+// Run starts the server and blocks until ctx is done or SIGINT or SIGTERM is received, then stops the server. It
+// returns nil if the server was shut down gracefully.
+func (hs *Server) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- hs.Start()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	err := hs.Stop()
+	if startErr := <-errCh; startErr != nil && !errors.Is(startErr, http.ErrServerClosed) && err == nil {
+		err = startErr
+	}
+	return err
 }
 
 func CreateTLSConfigMinTls(minTlsVersion uint16) *tls.Config {
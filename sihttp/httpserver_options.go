@@ -0,0 +1,136 @@
+package sihttp
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/handlers"
+)
+
+type ServerOption interface {
+	apply(s *Server) error
+}
+
+type ServerOptionFunc func(s *Server) error
+
+func (o ServerOptionFunc) apply(s *Server) error {
+	return o(s)
+}
+
+func WithServerTLSConfig(tlsConfig *tls.Config) ServerOptionFunc {
+	return ServerOptionFunc(func(s *Server) error {
+		s.TLSConf = tlsConfig
+		return nil
+	})
+}
+
+// WithCertFiles serves TLS with the certificate and the key in pem and key files.
+func WithCertFiles(pem, key string) ServerOptionFunc {
+	return ServerOptionFunc(func(s *Server) error {
+		s.pem = pem
+		s.key = key
+		return nil
+	})
+}
+
+func WithServerReadTimeout(timeout time.Duration) ServerOptionFunc {
+	return ServerOptionFunc(func(s *Server) error {
+		s.Server.ReadTimeout = timeout
+		return nil
+	})
+}
+
+func WithServerReadHeaderTimeout(timeout time.Duration) ServerOptionFunc {
+	return ServerOptionFunc(func(s *Server) error {
+		s.Server.ReadHeaderTimeout = timeout
+		return nil
+	})
+}
+
+func WithServerWriteTimeout(timeout time.Duration) ServerOptionFunc {
+	return ServerOptionFunc(func(s *Server) error {
+		s.Server.WriteTimeout = timeout
+		return nil
+	})
+}
+
+func WithServerIdleTimeout(timeout time.Duration) ServerOptionFunc {
+	return ServerOptionFunc(func(s *Server) error {
+		s.Server.IdleTimeout = timeout
+		return nil
+	})
+}
+
+// WithMiddleware appends middlewares wrapping the handler of the server.
+func WithMiddleware(mws ...Middleware) ServerOptionFunc {
+	return ServerOptionFunc(func(s *Server) error {
+		s.middlewares = append(s.middlewares, mws...)
+		return nil
+	})
+}
+
+func WithCors(allowedOrigins, allowedHeaders, allowedMethods []string) ServerOptionFunc {
+	return ServerOptionFunc(func(s *Server) error {
+		s.cors = append(s.cors,
+			handlers.AllowedOrigins(allowedOrigins),
+			handlers.AllowedHeaders(allowedHeaders),
+			handlers.AllowedMethods(allowedMethods))
+		return nil
+	})
+}
+
+// WithShutdownTimeout sets how long Stop waits for in-flight requests before closing connections.
+func WithShutdownTimeout(timeout time.Duration) ServerOptionFunc {
+	return ServerOptionFunc(func(s *Server) error {
+		s.shutdownTimeout = timeout
+		return nil
+	})
+}
+
+// WithDrainDelay sets how long Shutdown waits after marking the server not ready before it stops accepting
+// connections.
+func WithDrainDelay(delay time.Duration) ServerOptionFunc {
+	return ServerOptionFunc(func(s *Server) error {
+		s.drainDelay = delay
+		return nil
+	})
+}
+
+// WithHealth serves liveness of h at `/healthz` and readiness at `/readyz`. The readiness of the server is added to
+// the readiness checks of h, so `/readyz` fails as soon as the server starts shutting down.
+func WithHealth(h *Health) ServerOptionFunc {
+	return ServerOptionFunc(func(s *Server) error {
+		h.AddReadiness("server", HealthCheckerFunc(func(ctx context.Context) error {
+			if !s.IsReady() {
+				return ErrServerNotReady
+			}
+			return nil
+		}))
+		s.addEndpoint("/healthz", h.LivenessHandler())
+		s.addEndpoint("/readyz", h.ReadinessHandler())
+		return nil
+	})
+}
+
+// WithMetrics serves metrics of r at `/metrics` and records requests to the server with MetricsMiddleware. It fails
+// if one of the names of MetricsMiddleware is registered in r as a different metric.
+func WithMetrics(r *MetricsRegistry) ServerOptionFunc {
+	return ServerOptionFunc(func(s *Server) error {
+		mw, err := newMetricsMiddleware(r)
+		if err != nil {
+			return err
+		}
+		s.middlewares = append([]Middleware{mw}, s.middlewares...)
+		s.addEndpoint("/metrics", r.Handler())
+		return nil
+	})
+}
+
+func (s *Server) addEndpoint(path string, h http.Handler) {
+	if s.endpoints == nil {
+		s.endpoints = make(map[string]http.Handler)
+	}
+	s.endpoints[path] = h
+}
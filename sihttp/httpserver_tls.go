@@ -0,0 +1,239 @@
+package sihttp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// WithHTTP2 enables HTTP/2 over TLS. Servers created by NewServer, NewServerTls and NewServerCors serve only
+// HTTP/1.1.
+func WithHTTP2() ServerOptionFunc {
+	return ServerOptionFunc(func(s *Server) error {
+		s.http2 = true
+		return nil
+	})
+}
+
+// WithH2C enables HTTP/2 over cleartext TCP(h2c) with prior knowledge or `Upgrade: h2c`. It is meant for internal
+// traffic, eg. behind a load balancer terminating TLS.
+func WithH2C() ServerOptionFunc {
+	return ServerOptionFunc(func(s *Server) error {
+		s.h2c = true
+		return nil
+	})
+}
+
+// WithMutualTLS requires clients to present certificates signed by clientCAs. If verify is not nil, it is called
+// with the leaf certificate of a verified client on every handshake, including resumed sessions, and the handshake
+// fails if it returns an error. The identity of the client is available to handlers with ClientIdentity.
+func WithMutualTLS(clientCAs *x509.CertPool, verify func(cert *x509.Certificate) error) ServerOptionFunc {
+	return ServerOptionFunc(func(s *Server) error {
+		if clientCAs == nil {
+			return errors.New("sihttp: client CA pool is nil")
+		}
+		s.clientCAs = clientCAs
+		s.verifyClient = verify
+		return nil
+	})
+}
+
+// WithCertReloader serves TLS with the certificate of reloader, which is reloaded when its files change.
+func WithCertReloader(reloader *CertReloader) ServerOptionFunc {
+	return ServerOptionFunc(func(s *Server) error {
+		s.certReloader = reloader
+		return nil
+	})
+}
+
+// configureTLS applies TLS related options after all options are applied, so that they don't depend on the order
+// of WithServerTLSConfig.
+func (hs *Server) configureTLS() error {
+	if hs.clientCAs != nil || hs.certReloader != nil {
+		if hs.TLSConf == nil {
+			hs.TLSConf = &tls.Config{MinVersion: tls.VersionTLS12}
+		} else {
+			hs.TLSConf = hs.TLSConf.Clone()
+		}
+	}
+
+	if hs.clientCAs != nil {
+		hs.TLSConf.ClientCAs = hs.clientCAs
+		hs.TLSConf.ClientAuth = tls.RequireAndVerifyClientCert
+		if verify := hs.verifyClient; verify != nil {
+			// VerifyConnection is called on resumed sessions as well, unlike VerifyPeerCertificate
+			next := hs.TLSConf.VerifyConnection
+			hs.TLSConf.VerifyConnection = func(cs tls.ConnectionState) error {
+				if len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+					return errors.New("sihttp: client certificate is not verified")
+				}
+				if err := verify(cs.VerifiedChains[0][0]); err != nil {
+					return err
+				}
+				if next != nil {
+					return next(cs)
+				}
+				return nil
+			}
+		}
+	}
+
+	if hs.certReloader != nil {
+		hs.TLSConf.GetCertificate = hs.certReloader.GetCertificate
+	}
+
+	hs.Server.TLSConfig = hs.TLSConf
+	if hs.http2 {
+		hs.Server.TLSNextProto = nil
+		if err := http2.ConfigureServer(hs.Server, &http2.Server{}); err != nil {
+			return err
+		}
+		hs.TLSConf = hs.Server.TLSConfig
+	}
+	return nil
+}
+
+// withH2C wraps h to serve h2c if it is enabled.
+func (hs *Server) withH2C(h http.Handler) http.Handler {
+	if !hs.h2c {
+		return h
+	}
+	return h2c.NewHandler(h, &http2.Server{})
+}
+
+// PeerIdentity is the identity of a client authenticated with mutual TLS.
+type PeerIdentity struct {
+	Subject        pkix.Name
+	CommonName     string
+	DNSNames       []string
+	EmailAddresses []string
+	// URIs includes SPIFFE IDs, eg. spiffe://example.org/service.
+	URIs        []*url.URL
+	Certificate *x509.Certificate
+}
+
+// ClientIdentity returns the identity of the client certificate of r.
+func ClientIdentity(r *http.Request) (*PeerIdentity, bool) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil, false
+	}
+	cert := r.TLS.PeerCertificates[0]
+	return &PeerIdentity{
+		Subject:        cert.Subject,
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		URIs:           cert.URIs,
+		Certificate:    cert,
+	}, true
+}
+
+// CertReloader loads a certificate and its key from files and reloads them when the files are modified. Changes are
+// checked at most once per interval during handshakes, so no goroutine is required.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mu          sync.RWMutex
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+	checkedAt   time.Time
+}
+
+// NewCertReloader loads certFile and keyFile and returns CertReloader checking them every interval, 1 minute if
+// interval is 0.
+func NewCertReloader(certFile, keyFile string, interval time.Duration) (*CertReloader, error) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the certificate and the key from the files. The current certificate is kept if loading fails.
+func (r *CertReloader) Reload() error {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return err
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.certModTime = certInfo.ModTime()
+	r.keyModTime = keyInfo.ModTime()
+	r.checkedAt = time.Now()
+	return nil
+}
+
+// Certificate returns the current certificate, reloading it first if the files have been modified.
+func (r *CertReloader) Certificate() *tls.Certificate {
+	r.mu.RLock()
+	cert := r.cert
+	due := time.Since(r.checkedAt) >= r.interval
+	r.mu.RUnlock()
+	if !due {
+		return cert
+	}
+
+	r.mu.Lock()
+	r.checkedAt = time.Now()
+	certModTime, keyModTime := r.certModTime, r.keyModTime
+	r.mu.Unlock()
+
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return cert
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return cert
+	}
+	if certInfo.ModTime().Equal(certModTime) && keyInfo.ModTime().Equal(keyModTime) {
+		return cert
+	}
+	// a half-written pair fails to load and is retried after the next interval
+	if err := r.Reload(); err != nil {
+		return cert
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// GetCertificate is for tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// GetClientCertificate is for tls.Config.GetClientCertificate of clients authenticating with mutual TLS.
+func (r *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
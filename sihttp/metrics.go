@@ -0,0 +1,398 @@
+package sihttp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsContentType is the media type of Prometheus text exposition format.
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultDurationBuckets are histogram buckets in seconds suitable for request durations.
+var DefaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type metricType string
+
+const (
+	metricCounter   metricType = "counter"
+	metricGauge     metricType = "gauge"
+	metricHistogram metricType = "histogram"
+)
+
+// MetricsRegistry holds metrics and writes them in Prometheus text exposition format.
+type MetricsRegistry struct {
+	mu      sync.RWMutex
+	metrics []*metric
+	names   map[string]struct{}
+}
+
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{
+		names: make(map[string]struct{}),
+	}
+}
+
+type metric struct {
+	name       string
+	help       string
+	typ        metricType
+	labelNames []string
+	buckets    []float64
+	fn         func() float64
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues []string
+	value       float64
+	// histogram only
+	counts []uint64
+	count  uint64
+}
+
+func (r *MetricsRegistry) register(m *metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.names[m.name]; ok {
+		panic("sihttp: metric " + m.name + " is already registered")
+	}
+	r.add(m)
+}
+
+// getOrRegister returns the metric registered with the name of m if it has the same type, labels and buckets,
+// otherwise registers m. It fails if the name is registered as a different metric.
+func (r *MetricsRegistry) getOrRegister(m *metric) (*metric, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.names[m.name]; !ok {
+		r.add(m)
+		return m, nil
+	}
+	for _, e := range r.metrics {
+		if e.name == m.name && e.fn == nil && e.typ == m.typ && equalSlices(e.labelNames, m.labelNames) &&
+			equalSlices(e.buckets, m.buckets) {
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("sihttp: metric %s is already registered as a different metric", m.name)
+}
+
+func (r *MetricsRegistry) add(m *metric) {
+	r.names[m.name] = struct{}{}
+	m.series = make(map[string]*metricSeries)
+	r.metrics = append(r.metrics, m)
+}
+
+func equalSlices[T comparable](a, b []T) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Counter is a metric that only increases.
+type Counter struct {
+	m *metric
+}
+
+// NewCounter registers a counter with labelNames. It panics if name is already registered.
+func (r *MetricsRegistry) NewCounter(name, help string, labelNames ...string) *Counter {
+	m := &metric{name: name, help: help, typ: metricCounter, labelNames: labelNames}
+	r.register(m)
+	return &Counter{m}
+}
+
+// Inc increments the counter of labelValues by 1.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increments the counter of labelValues by v. Negative v is ignored.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.m.update(labelValues, func(s *metricSeries) { s.value += v })
+}
+
+// Gauge is a metric that can go up and down.
+type Gauge struct {
+	m *metric
+}
+
+// NewGauge registers a gauge with labelNames. It panics if name is already registered.
+func (r *MetricsRegistry) NewGauge(name, help string, labelNames ...string) *Gauge {
+	m := &metric{name: name, help: help, typ: metricGauge, labelNames: labelNames}
+	r.register(m)
+	return &Gauge{m}
+}
+
+// NewGaugeFunc registers a gauge whose value is taken from fn on every scrape, eg. the number of open database
+// connections.
+func (r *MetricsRegistry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&metric{name: name, help: help, typ: metricGauge, fn: fn})
+}
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.m.update(labelValues, func(s *metricSeries) { s.value = v })
+}
+
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.m.update(labelValues, func(s *metricSeries) { s.value += v })
+}
+
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+// Histogram counts observations in buckets.
+type Histogram struct {
+	m *metric
+}
+
+// NewHistogram registers a histogram with upper bounds of buckets, DefaultDurationBuckets if buckets is empty. It
+// panics if name is already registered.
+func (r *MetricsRegistry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultDurationBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	m := &metric{name: name, help: help, typ: metricHistogram, labelNames: labelNames, buckets: sorted}
+	r.register(m)
+	return &Histogram{m}
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.m.update(labelValues, func(s *metricSeries) {
+		if s.counts == nil {
+			s.counts = make([]uint64, len(h.m.buckets))
+		}
+		for i, b := range h.m.buckets {
+			if v <= b {
+				s.counts[i]++
+			}
+		}
+		s.count++
+		s.value += v
+	})
+}
+
+func (m *metric) update(labelValues []string, fn func(s *metricSeries)) {
+	// missing label values are empty and extra ones are dropped so that series always match labelNames
+	values := make([]string, len(m.labelNames))
+	copy(values, labelValues)
+	key := strings.Join(values, "\xff")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.series[key]
+	if !ok {
+		s = &metricSeries{labelValues: values}
+		m.series[key] = s
+	}
+	fn(s)
+}
+
+// WriteTo writes all metrics to w in Prometheus text exposition format.
+func (r *MetricsRegistry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	metrics := append([]*metric(nil), r.metrics...)
+	r.mu.RUnlock()
+
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, m := range metrics {
+		m.write(cw)
+	}
+	if cw.err == nil {
+		cw.err = cw.w.(*bufio.Writer).Flush()
+	}
+	return cw.n, cw.err
+}
+
+// Handler serves the metrics of r.
+func (r *MetricsRegistry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", MetricsContentType)
+		r.WriteTo(w)
+	})
+}
+
+func (m *metric) write(w *countingWriter) {
+	if m.help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, escapeMetricHelp(m.help))
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.typ)
+
+	if m.fn != nil {
+		fmt.Fprintf(w, "%s %s\n", m.name, formatMetricValue(m.fn()))
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]string, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := m.series[k]
+		labels := formatMetricLabels(m.labelNames, s.labelValues, "", "")
+		if m.typ != metricHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, labels, formatMetricValue(s.value))
+			continue
+		}
+
+		for i, b := range m.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name,
+				formatMetricLabels(m.labelNames, s.labelValues, "le", formatMetricValue(b)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, formatMetricLabels(m.labelNames, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, labels, formatMetricValue(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", m.name, labels, s.count)
+	}
+}
+
+func formatMetricLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(n)
+		b.WriteString(`="`)
+		b.WriteString(escapeMetricLabel(values[i]))
+		b.WriteByte('"')
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extraName)
+		b.WriteString(`="`)
+		b.WriteString(extraValue)
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func formatMetricValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	metricHelpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	metricLabelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeMetricHelp(s string) string {
+	return metricHelpReplacer.Replace(s)
+}
+
+func escapeMetricLabel(s string) string {
+	return metricLabelReplacer.Replace(s)
+}
+
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
+
+// MetricsMiddleware records `http_requests_total` by method and status code, `http_request_duration_seconds` by
+// method and `http_requests_in_flight` in r. The metrics already registered in r by another MetricsMiddleware are
+// reused, so that servers sharing r record to the same metrics. It panics if one of the names is registered as a
+// different metric.
+func MetricsMiddleware(r *MetricsRegistry) Middleware {
+	mw, err := newMetricsMiddleware(r)
+	if err != nil {
+		panic(err.Error())
+	}
+	return mw
+}
+
+func newMetricsMiddleware(r *MetricsRegistry) (Middleware, error) {
+	requests, err := r.getOrRegister(&metric{name: "http_requests_total", help: "Total number of HTTP requests.",
+		typ: metricCounter, labelNames: []string{"method", "code"}})
+	if err != nil {
+		return nil, err
+	}
+	durations, err := r.getOrRegister(&metric{name: "http_request_duration_seconds",
+		help: "Duration of HTTP requests in seconds.", typ: metricHistogram, labelNames: []string{"method"},
+		buckets: append([]float64(nil), DefaultDurationBuckets...)})
+	if err != nil {
+		return nil, err
+	}
+	inFlight, err := r.getOrRegister(&metric{name: "http_requests_in_flight",
+		help: "Number of HTTP requests being served.", typ: metricGauge})
+	if err != nil {
+		return nil, err
+	}
+	return metricsMiddleware(&Counter{requests}, &Histogram{durations}, &Gauge{inFlight}), nil
+}
+
+func metricsMiddleware(requests *Counter, durations *Histogram, inFlight *Gauge) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			inFlight.Inc()
+			defer inFlight.Dec()
+
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, req)
+
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			requests.Inc(req.Method, strconv.Itoa(status))
+			durations.Observe(time.Since(start).Seconds(), req.Method)
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package sihttp
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Middleware wraps an http.Handler.
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h with mws. The first middleware is the outermost, so it runs first.
+func Chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		if mws[i] != nil {
+			h = mws[i](h)
+		}
+	}
+	return h
+}
+
+// Recovery recovers from panics in handlers, logs them with the stack trace and responds 500 Internal Server Error.
+// http.ErrAbortHandler is re-panicked so that net/http aborts the response.
+func Recovery(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+				logger.Printf("sihttp: panic serving %s %s: %v\n%s", r.Method, r.URL.Path, rec, debug.Stack())
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// DefaultRequestIDHeader is the header RequestID middleware reads and writes.
+const DefaultRequestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// RequestID takes the request ID from header or generates a new one, stores it in the request context and sets it
+// to the response header. If header is empty, DefaultRequestIDHeader is used.
+func RequestID(header string) Middleware {
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(header)
+			if id == "" {
+				id = uuid.NewString()
+			}
+			w.Header().Set(header, id)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+		})
+	}
+}
+
+// RequestIDFromContext returns the request ID stored by RequestID middleware.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// AccessLog logs a line per request with remote address, method, uri, protocol, status, response size, elapsed time
+// and request ID.
+func AccessLog(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			reqID := RequestIDFromContext(r.Context())
+			if reqID == "" {
+				reqID = "-"
+			}
+			logger.Printf("%s %s %s %s %d %d %s %s", r.RemoteAddr, r.Method, r.RequestURI, r.Proto,
+				status, rec.written, time.Since(start), reqID)
+		})
+	}
+}
+
+// Timeout responds 503 Service Unavailable if a handler doesn't finish within d, see http.TimeoutHandler. Requests
+// whose path matches one of except, patterns in the syntax of Router, are not timed out.
+//
+// Responses are buffered until the handler returns and the writer does not implement http.Flusher, so streaming
+// handlers such as event streams must not run under Timeout. Exclude their routes with except, or apply Timeout to
+// the other routes with Router.Handle rather than to the whole server.
+func Timeout(d time.Duration, except ...string) Middleware {
+	exempt := make([]*route, len(except))
+	for i, pattern := range except {
+		exempt[i] = &route{segments: parsePattern(pattern)}
+	}
+	return func(next http.Handler) http.Handler {
+		th := http.TimeoutHandler(next, d, http.StatusText(http.StatusServiceUnavailable))
+		if len(exempt) == 0 {
+			return th
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path := splitPath(r.URL.Path)
+			for _, rte := range exempt {
+				if _, ok := rte.match(path); ok {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			th.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BodyLimit limits the size of request bodies to n bytes. Requests with Content-Length greater than n are rejected
+// with 413 Request Entity Too Large, otherwise reading beyond n fails with *http.MaxBytesError.
+func BodyLimit(n int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > n {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = http.MaxBytesReader(w, r.Body, n)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Gzip compresses responses with gzip at level when the client accepts it. Responses already having
+// Content-Encoding and responses without a body are not compressed.
+func Gzip(level int) Middleware {
+	pool := &sync.Pool{
+		New: func() any {
+			gw, err := gzip.NewWriterLevel(io.Discard, level)
+			if err != nil {
+				gw, _ = gzip.NewWriterLevel(io.Discard, gzip.DefaultCompression)
+			}
+			return gw
+		},
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if !acceptsGzip(r) || r.Header.Get("Range") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			gw := &gzipResponseWriter{ResponseWriter: w, pool: pool}
+			defer gw.close()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, v := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(v), ";")
+		if strings.TrimSpace(coding) != "gzip" {
+			continue
+		}
+		return strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0"
+	}
+	return false
+}
+
+// statusRecorder records the status code and the number of bytes written.
+type statusRecorder struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(p)
+	rec.written += int64(n)
+	return n, err
+}
+
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := rec.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("sihttp: response writer does not support hijacking")
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	pool        *sync.Pool
+	gw          *gzip.Writer
+	wroteHeader bool
+}
+
+func (g *gzipResponseWriter) WriteHeader(code int) {
+	if g.wroteHeader {
+		return
+	}
+	// informational responses such as 103 Early Hints precede the final response
+	if code >= 100 && code < http.StatusOK {
+		g.ResponseWriter.WriteHeader(code)
+		return
+	}
+	g.wroteHeader = true
+
+	h := g.Header()
+	if h.Get("Content-Encoding") == "" && code != http.StatusNoContent && code != http.StatusNotModified {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		g.gw = g.pool.Get().(*gzip.Writer)
+		g.gw.Reset(g.ResponseWriter)
+	}
+	g.ResponseWriter.WriteHeader(code)
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !g.wroteHeader {
+		if g.Header().Get("Content-Type") == "" {
+			g.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.gw == nil {
+		return g.ResponseWriter.Write(p)
+	}
+	return g.gw.Write(p)
+}
+
+func (g *gzipResponseWriter) Flush() {
+	if g.gw != nil {
+		g.gw.Flush()
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+func (g *gzipResponseWriter) close() {
+	if g.gw == nil {
+		return
+	}
+	g.gw.Close()
+	g.gw.Reset(io.Discard)
+	g.pool.Put(g.gw)
+	g.gw = nil
+}
@@ -0,0 +1,532 @@
+package sihttp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrNoHealthyUpstream = errors.New("sihttp: no healthy upstream")
+
+// Upstream is a server Proxy forwards requests to.
+type Upstream struct {
+	URL *url.URL
+
+	healthy  atomic.Bool
+	inFlight atomic.Int64
+}
+
+func (u *Upstream) IsHealthy() bool {
+	return u.healthy.Load()
+}
+
+// InFlight returns the number of requests being forwarded to u.
+func (u *Upstream) InFlight() int64 {
+	return u.inFlight.Load()
+}
+
+// LoadBalancer picks an upstream among healthy ones, which is never empty.
+type LoadBalancer interface {
+	Next(upstreams []*Upstream) *Upstream
+}
+
+type roundRobin struct {
+	next atomic.Uint64
+}
+
+// RoundRobin returns LoadBalancer picking upstreams in turn.
+func RoundRobin() LoadBalancer {
+	return &roundRobin{}
+}
+
+func (b *roundRobin) Next(upstreams []*Upstream) *Upstream {
+	n := b.next.Add(1) - 1
+	return upstreams[n%uint64(len(upstreams))]
+}
+
+type leastConn struct {
+	rr roundRobin
+}
+
+// LeastConn returns LoadBalancer picking the upstream with the fewest in-flight requests. Ties are broken in turn.
+func LeastConn() LoadBalancer {
+	return &leastConn{}
+}
+
+func (b *leastConn) Next(upstreams []*Upstream) *Upstream {
+	start := int(b.rr.next.Add(1) % uint64(len(upstreams)))
+	var best *Upstream
+	for i := range upstreams {
+		u := upstreams[(start+i)%len(upstreams)]
+		if best == nil || u.InFlight() < best.InFlight() {
+			best = u
+		}
+	}
+	return best
+}
+
+type proxyHealthCheck struct {
+	path     string
+	interval time.Duration
+	timeout  time.Duration
+}
+
+// Proxy is a reverse proxy forwarding requests to upstreams. Mount a Proxy per route, eg. on Router with a `*`
+// pattern, to build a gateway.
+type Proxy struct {
+	upstreams []*Upstream
+	balancer  LoadBalancer
+	transport http.RoundTripper
+	timeout   time.Duration
+	retries   int
+
+	stripPrefix     string
+	preserveHost    bool
+	setReqHeaders   http.Header
+	delReqHeaders   []string
+	setRespHeaders  http.Header
+	delRespHeaders  []string
+	requestOpts     []RequestOption
+	healthCheck     *proxyHealthCheck
+	logger          *log.Logger
+	reverseProxy    *httputil.ReverseProxy
+	stopHealthCheck chan struct{}
+	closeOnce       sync.Once
+}
+
+type ProxyOption interface {
+	apply(p *Proxy) error
+}
+
+type ProxyOptionFunc func(p *Proxy) error
+
+func (o ProxyOptionFunc) apply(p *Proxy) error {
+	return o(p)
+}
+
+// WithLoadBalancer sets the load balancer, RoundRobin by default.
+func WithLoadBalancer(b LoadBalancer) ProxyOptionFunc {
+	return ProxyOptionFunc(func(p *Proxy) error {
+		p.balancer = b
+		return nil
+	})
+}
+
+// WithProxyTransport sets the transport to upstreams, the transport of DefaultStandardClient(nil) by default.
+func WithProxyTransport(transport http.RoundTripper) ProxyOptionFunc {
+	return ProxyOptionFunc(func(p *Proxy) error {
+		p.transport = transport
+		return nil
+	})
+}
+
+// WithProxyTLSConfig connects to upstreams with the transport of DefaultStandardClient(tlsConfig).
+func WithProxyTLSConfig(tlsConfig *tls.Config) ProxyOptionFunc {
+	return ProxyOptionFunc(func(p *Proxy) error {
+		p.transport = DefaultStandardClient(tlsConfig).Transport
+		return nil
+	})
+}
+
+// WithProxyRequestOption applies opts to requests to upstreams, eg. WithBearerToken or WithAwsSigV4.
+func WithProxyRequestOption(opts ...RequestOption) ProxyOptionFunc {
+	return ProxyOptionFunc(func(p *Proxy) error {
+		p.requestOpts = append(p.requestOpts, opts...)
+		return nil
+	})
+}
+
+// WithProxyTimeout limits the time to forward a request including retries. Requests timed out are responded with
+// 504 Gateway Timeout.
+func WithProxyTimeout(timeout time.Duration) ProxyOptionFunc {
+	return ProxyOptionFunc(func(p *Proxy) error {
+		p.timeout = timeout
+		return nil
+	})
+}
+
+// WithProxyRetries retries idempotent requests without body on other upstreams up to retries times when they fail
+// to connect or respond with 502, 503 or 504.
+func WithProxyRetries(retries int) ProxyOptionFunc {
+	return ProxyOptionFunc(func(p *Proxy) error {
+		p.retries = retries
+		return nil
+	})
+}
+
+// WithStripPrefix removes prefix from request paths before forwarding.
+func WithStripPrefix(prefix string) ProxyOptionFunc {
+	return ProxyOptionFunc(func(p *Proxy) error {
+		p.stripPrefix = prefix
+		return nil
+	})
+}
+
+// WithPreserveHost forwards the Host header of incoming requests instead of the host of upstreams.
+func WithPreserveHost() ProxyOptionFunc {
+	return ProxyOptionFunc(func(p *Proxy) error {
+		p.preserveHost = true
+		return nil
+	})
+}
+
+// WithProxyRequestHeader sets header key to value on requests to upstreams.
+func WithProxyRequestHeader(key, value string) ProxyOptionFunc {
+	return ProxyOptionFunc(func(p *Proxy) error {
+		p.setReqHeaders.Set(key, value)
+		return nil
+	})
+}
+
+// WithProxyRemoveRequestHeader removes headers from requests to upstreams.
+func WithProxyRemoveRequestHeader(keys ...string) ProxyOptionFunc {
+	return ProxyOptionFunc(func(p *Proxy) error {
+		p.delReqHeaders = append(p.delReqHeaders, keys...)
+		return nil
+	})
+}
+
+// WithProxyResponseHeader sets header key to value on responses from upstreams.
+func WithProxyResponseHeader(key, value string) ProxyOptionFunc {
+	return ProxyOptionFunc(func(p *Proxy) error {
+		p.setRespHeaders.Set(key, value)
+		return nil
+	})
+}
+
+// WithProxyRemoveResponseHeader removes headers from responses from upstreams.
+func WithProxyRemoveResponseHeader(keys ...string) ProxyOptionFunc {
+	return ProxyOptionFunc(func(p *Proxy) error {
+		p.delRespHeaders = append(p.delRespHeaders, keys...)
+		return nil
+	})
+}
+
+// WithProxyHealthCheck sends GET requests to path of each upstream every interval. Upstreams responding other than
+// 2xx or not responding within timeout are taken out of load balancing until they pass again. It fails if interval
+// or timeout is not positive.
+func WithProxyHealthCheck(path string, interval, timeout time.Duration) ProxyOptionFunc {
+	return ProxyOptionFunc(func(p *Proxy) error {
+		if interval <= 0 || timeout <= 0 {
+			return errors.New("sihttp: health check interval and timeout must be positive")
+		}
+		p.healthCheck = &proxyHealthCheck{path, interval, timeout}
+		return nil
+	})
+}
+
+func WithProxyLogger(logger *log.Logger) ProxyOptionFunc {
+	return ProxyOptionFunc(func(p *Proxy) error {
+		p.logger = logger
+		return nil
+	})
+}
+
+// NewProxy returns Proxy forwarding to targets, eg. `http://10.0.0.1:8080`. If health check is enabled, call Close
+// to stop it.
+func NewProxy(targets []string, opts ...ProxyOption) (*Proxy, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("sihttp: no upstream")
+	}
+
+	p := &Proxy{
+		balancer:       RoundRobin(),
+		setReqHeaders:  make(http.Header),
+		setRespHeaders: make(http.Header),
+		logger:         log.Default(),
+	}
+	for _, t := range targets {
+		u, err := url.Parse(t)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, errors.New("sihttp: invalid upstream " + t)
+		}
+		up := &Upstream{URL: u}
+		up.healthy.Store(true)
+		p.upstreams = append(p.upstreams, up)
+	}
+
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if err := o.apply(p); err != nil {
+			return nil, err
+		}
+	}
+	if p.transport == nil {
+		p.transport = DefaultStandardClient(nil).Transport
+	}
+
+	p.reverseProxy = &httputil.ReverseProxy{
+		Rewrite:        p.rewrite,
+		Transport:      proxyTransport{p},
+		ModifyResponse: p.modifyResponse,
+		ErrorHandler:   p.handleError,
+		ErrorLog:       p.logger,
+	}
+
+	if p.healthCheck != nil {
+		p.stopHealthCheck = make(chan struct{})
+		go p.runHealthCheck()
+	}
+	return p, nil
+}
+
+// Upstreams returns the upstreams of p.
+func (p *Proxy) Upstreams() []*Upstream {
+	return p.upstreams
+}
+
+// HealthCheck returns ErrNoHealthyUpstream if all upstreams are unhealthy.
+func (p *Proxy) HealthCheck(ctx context.Context) error {
+	if len(p.healthyUpstreams(nil)) == 0 {
+		return ErrNoHealthyUpstream
+	}
+	return nil
+}
+
+// Close stops health checks.
+func (p *Proxy) Close() {
+	p.closeOnce.Do(func() {
+		if p.stopHealthCheck != nil {
+			close(p.stopHealthCheck)
+		}
+	})
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), p.timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+	p.reverseProxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) rewrite(pr *httputil.ProxyRequest) {
+	pr.SetXForwarded()
+	if p.stripPrefix != "" {
+		pr.Out.URL.Path = ensureLeadingSlash(strings.TrimPrefix(pr.Out.URL.Path, p.stripPrefix))
+		pr.Out.URL.RawPath = ""
+	}
+	if !p.preserveHost {
+		pr.Out.Host = ""
+	}
+	for _, k := range p.delReqHeaders {
+		pr.Out.Header.Del(k)
+	}
+	for k, v := range p.setReqHeaders {
+		pr.Out.Header[k] = v
+	}
+}
+
+func (p *Proxy) modifyResponse(resp *http.Response) error {
+	for _, k := range p.delRespHeaders {
+		resp.Header.Del(k)
+	}
+	for k, v := range p.setRespHeaders {
+		resp.Header[k] = v
+	}
+	return nil
+}
+
+func (p *Proxy) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusBadGateway
+	switch {
+	case errors.Is(err, ErrNoHealthyUpstream):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusGatewayTimeout
+	}
+	// a canceled request means the client has gone away, which is not an error of the proxy
+	if !errors.Is(err, context.Canceled) {
+		p.logger.Printf("sihttp: proxy %s %s: %v", r.Method, r.URL.Path, err)
+	}
+	w.WriteHeader(status)
+}
+
+func (p *Proxy) healthyUpstreams(exclude map[*Upstream]bool) []*Upstream {
+	healthy := make([]*Upstream, 0, len(p.upstreams))
+	for _, u := range p.upstreams {
+		if u.IsHealthy() && !exclude[u] {
+			healthy = append(healthy, u)
+		}
+	}
+	return healthy
+}
+
+// proxyTransport picks an upstream for each attempt and retries idempotent requests on other upstreams.
+type proxyTransport struct {
+	p *Proxy
+}
+
+func (t proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	p := t.p
+	retryable := isIdempotentMethod(req.Method) && (req.Body == nil || req.Body == http.NoBody)
+	attempts := 1
+	if retryable {
+		attempts += p.retries
+	}
+
+	tried := make(map[*Upstream]bool)
+	var lastErr error
+	var lastResp *http.Response
+	for i := 0; i < attempts; i++ {
+		candidates := p.healthyUpstreams(tried)
+		if len(candidates) == 0 {
+			// every healthy upstream has been tried, try them again
+			candidates = p.healthyUpstreams(nil)
+		}
+		if len(candidates) == 0 {
+			break
+		}
+		u := p.balancer.Next(candidates)
+		tried[u] = true
+
+		if lastResp != nil {
+			io.Copy(io.Discard, lastResp.Body)
+			lastResp.Body.Close()
+			lastResp = nil
+		}
+
+		resp, err := p.forward(req, u)
+		if err == nil && !(retryable && isRetryableProxyStatus(resp.StatusCode)) {
+			return resp, nil
+		}
+		if err != nil {
+			lastErr = err
+			if req.Context().Err() != nil {
+				return nil, err
+			}
+			continue
+		}
+		lastResp = resp
+	}
+
+	if lastResp != nil {
+		return lastResp, nil
+	}
+	if lastErr == nil {
+		lastErr = ErrNoHealthyUpstream
+	}
+	return nil, lastErr
+}
+
+func (p *Proxy) forward(req *http.Request, u *Upstream) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.URL.Scheme = u.URL.Scheme
+	out.URL.Host = u.URL.Host
+	out.URL.Path = joinURLPath(u.URL.Path, req.URL.Path)
+	out.URL.RawPath = ""
+	if u.URL.RawQuery != "" {
+		if out.URL.RawQuery == "" {
+			out.URL.RawQuery = u.URL.RawQuery
+		} else {
+			out.URL.RawQuery = u.URL.RawQuery + "&" + out.URL.RawQuery
+		}
+	}
+
+	out, err := applyRequestOptions(out, p.requestOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	u.inFlight.Add(1)
+	resp, err := p.transport.RoundTrip(out)
+	if err != nil {
+		u.inFlight.Add(-1)
+		return nil, err
+	}
+	resp.Body = &inFlightBody{ReadCloser: resp.Body, u: u}
+	return resp, nil
+}
+
+// inFlightBody decrements in-flight requests of u when the response body is closed.
+type inFlightBody struct {
+	io.ReadCloser
+	u    *Upstream
+	once sync.Once
+}
+
+func (b *inFlightBody) Close() error {
+	b.once.Do(func() { b.u.inFlight.Add(-1) })
+	return b.ReadCloser.Close()
+}
+
+func (p *Proxy) runHealthCheck() {
+	hc := p.healthCheck
+	client := &http.Client{Transport: p.transport, Timeout: hc.timeout}
+	check := func() {
+		var wg sync.WaitGroup
+		for _, u := range p.upstreams {
+			wg.Add(1)
+			go func(u *Upstream) {
+				defer wg.Done()
+				healthy := false
+				resp, err := client.Get(joinURLPath(u.URL.Scheme+"://"+u.URL.Host+u.URL.Path, hc.path))
+				if err == nil {
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+					healthy = resp.StatusCode >= 200 && resp.StatusCode < 300
+				}
+				if u.healthy.Swap(healthy) != healthy {
+					p.logger.Printf("sihttp: upstream %s healthy: %t", u.URL, healthy)
+				}
+			}(u)
+		}
+		wg.Wait()
+	}
+
+	check()
+	ticker := time.NewTicker(hc.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stopHealthCheck:
+			return
+		case <-ticker.C:
+			check()
+		}
+	}
+}
+
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func isRetryableProxyStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+func joinURLPath(a, b string) string {
+	switch {
+	case a == "":
+		return ensureLeadingSlash(b)
+	case b == "":
+		return a
+	}
+	return strings.TrimSuffix(a, "/") + "/" + strings.TrimPrefix(b, "/")
+}
+
+func ensureLeadingSlash(p string) string {
+	if !strings.HasPrefix(p, "/") {
+		return "/" + p
+	}
+	return p
+}
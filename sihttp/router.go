@@ -0,0 +1,217 @@
+package sihttp
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type pathParamsKey struct{}
+
+// PathParam returns the value of the path parameter `name` matched by Router. For a trailing `*` segment, name is
+// `*`.
+func PathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(pathParamsKey{}).(map[string]string)
+	return params[name]
+}
+
+type segmentKind int
+
+const (
+	segmentWildcard segmentKind = iota
+	segmentParam
+	segmentStatic
+)
+
+type routeSegment struct {
+	kind  segmentKind
+	value string
+}
+
+type route struct {
+	method   string
+	segments []routeSegment
+	handler  http.Handler
+}
+
+// Router is an http.Handler routing requests by method and path. Patterns consist of static segments, parameter
+// segments such as `{id}` and an optional trailing `*` matching the rest of the path, eg. `/students/{id}/files/*`.
+// When several routes match, static segments take precedence over parameters and parameters over `*`.
+type Router struct {
+	routes      []*route
+	middlewares []Middleware
+	notFound    http.Handler
+
+	// handler is route wrapped with middlewares, built when they are registered
+	handler http.Handler
+}
+
+// NewRouter returns an empty Router.
+func NewRouter() *Router {
+	rt := &Router{
+		notFound: http.NotFoundHandler(),
+	}
+	rt.handler = http.HandlerFunc(rt.route)
+	return rt
+}
+
+// Use appends middlewares applied to every route.
+func (rt *Router) Use(mws ...Middleware) {
+	rt.middlewares = append(rt.middlewares, mws...)
+	rt.handler = Chain(http.HandlerFunc(rt.route), rt.middlewares...)
+}
+
+// NotFound sets h to handle requests not matching any route.
+func (rt *Router) NotFound(h http.Handler) {
+	rt.notFound = h
+}
+
+// Handle registers h for method and pattern with middlewares applied only to this route.
+func (rt *Router) Handle(method, pattern string, h http.Handler, mws ...Middleware) {
+	rt.routes = append(rt.routes, &route{
+		method:   strings.ToUpper(method),
+		segments: parsePattern(pattern),
+		handler:  Chain(h, mws...),
+	})
+}
+
+func (rt *Router) HandleFunc(method, pattern string, h http.HandlerFunc, mws ...Middleware) {
+	rt.Handle(method, pattern, h, mws...)
+}
+
+func (rt *Router) Get(pattern string, h http.HandlerFunc, mws ...Middleware) {
+	rt.Handle(http.MethodGet, pattern, h, mws...)
+}
+func (rt *Router) Post(pattern string, h http.HandlerFunc, mws ...Middleware) {
+	rt.Handle(http.MethodPost, pattern, h, mws...)
+}
+func (rt *Router) Put(pattern string, h http.HandlerFunc, mws ...Middleware) {
+	rt.Handle(http.MethodPut, pattern, h, mws...)
+}
+func (rt *Router) Patch(pattern string, h http.HandlerFunc, mws ...Middleware) {
+	rt.Handle(http.MethodPatch, pattern, h, mws...)
+}
+func (rt *Router) Delete(pattern string, h http.HandlerFunc, mws ...Middleware) {
+	rt.Handle(http.MethodDelete, pattern, h, mws...)
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.handler.ServeHTTP(w, r)
+}
+
+func (rt *Router) route(w http.ResponseWriter, r *http.Request) {
+	path := splitPath(r.URL.Path)
+
+	var best *route
+	var bestParams map[string]string
+	var allowed []string
+	for _, rte := range rt.routes {
+		params, ok := rte.match(path)
+		if !ok {
+			continue
+		}
+		if rte.method != r.Method && !(r.Method == http.MethodHead && rte.method == http.MethodGet) {
+			allowed = append(allowed, rte.method)
+			continue
+		}
+		if best == nil || rte.moreSpecific(best) {
+			best, bestParams = rte, params
+		}
+	}
+
+	if best == nil {
+		if len(allowed) > 0 {
+			sort.Strings(allowed)
+			w.Header().Set("Allow", strings.Join(uniqueSorted(allowed), ", "))
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		rt.notFound.ServeHTTP(w, r)
+		return
+	}
+
+	if len(bestParams) > 0 {
+		r = r.WithContext(context.WithValue(r.Context(), pathParamsKey{}, bestParams))
+	}
+	best.handler.ServeHTTP(w, r)
+}
+
+// uniqueSorted removes duplicates from sorted ss in place.
+func uniqueSorted(ss []string) []string {
+	res := ss[:0]
+	for i, s := range ss {
+		if i == 0 || s != ss[i-1] {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func (rte *route) match(path []string) (map[string]string, bool) {
+	var params map[string]string
+	for i, seg := range rte.segments {
+		if seg.kind == segmentWildcard {
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params["*"] = strings.Join(path[i:], "/")
+			return params, true
+		}
+		if i >= len(path) {
+			return nil, false
+		}
+		switch seg.kind {
+		case segmentStatic:
+			if seg.value != path[i] {
+				return nil, false
+			}
+		case segmentParam:
+			if path[i] == "" {
+				return nil, false
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[seg.value] = path[i]
+		}
+	}
+	if len(path) != len(rte.segments) {
+		return nil, false
+	}
+	return params, true
+}
+
+// moreSpecific compares segments from the first one, a static segment is more specific than a parameter.
+func (rte *route) moreSpecific(other *route) bool {
+	for i := 0; i < len(rte.segments) && i < len(other.segments); i++ {
+		if rte.segments[i].kind != other.segments[i].kind {
+			return rte.segments[i].kind > other.segments[i].kind
+		}
+	}
+	return len(rte.segments) > len(other.segments)
+}
+
+func parsePattern(pattern string) []routeSegment {
+	parts := splitPath(pattern)
+	segments := make([]routeSegment, 0, len(parts))
+	for _, p := range parts {
+		switch {
+		case p == "*":
+			segments = append(segments, routeSegment{kind: segmentWildcard})
+		case strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}"):
+			segments = append(segments, routeSegment{kind: segmentParam, value: p[1 : len(p)-1]})
+		default:
+			segments = append(segments, routeSegment{kind: segmentStatic, value: p})
+		}
+	}
+	return segments
+}
+
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
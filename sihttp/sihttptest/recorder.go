@@ -0,0 +1,287 @@
+package sihttptest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"unicode/utf8"
+)
+
+// Mode is the mode of Recorder.
+type Mode int
+
+const (
+	// ModeReplay replies from the golden file and never sends requests.
+	ModeReplay Mode = iota
+	// ModeRecord sends requests with the underlying transport and records interactions to be saved with Save.
+	ModeRecord
+)
+
+var ErrInteractionNotFound = errors.New("sihttptest: no recorded interaction matches the request")
+
+// RecordedBody is a request or response body in a golden file. Bodies which are not valid UTF-8 are base64 encoded.
+type RecordedBody struct {
+	Encoding string `json:"encoding,omitempty"`
+	Data     string `json:"data"`
+}
+
+func newRecordedBody(b []byte) RecordedBody {
+	if utf8.Valid(b) {
+		return RecordedBody{Data: string(b)}
+	}
+	return RecordedBody{Encoding: "base64", Data: base64.StdEncoding.EncodeToString(b)}
+}
+
+func (b RecordedBody) Bytes() ([]byte, error) {
+	if b.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(b.Data)
+	}
+	return []byte(b.Data), nil
+}
+
+type InteractionRequest struct {
+	Method string       `json:"method"`
+	URL    string       `json:"url"`
+	Header http.Header  `json:"header,omitempty"`
+	Body   RecordedBody `json:"body"`
+}
+
+type InteractionResponse struct {
+	StatusCode int          `json:"status_code"`
+	Header     http.Header  `json:"header,omitempty"`
+	Body       RecordedBody `json:"body"`
+}
+
+// Interaction is a request and its response stored in a golden file.
+type Interaction struct {
+	Request  InteractionRequest  `json:"request"`
+	Response InteractionResponse `json:"response"`
+}
+
+// Matcher reports whether recorded matches req with body. By default method, URL and body must be equal.
+type Matcher func(req *http.Request, body []byte, recorded *Interaction) bool
+
+// DefaultMatcher matches method, URL and body.
+func DefaultMatcher(req *http.Request, body []byte, recorded *Interaction) bool {
+	if req.Method != recorded.Request.Method || req.URL.String() != recorded.Request.URL {
+		return false
+	}
+	rb, err := recorded.Request.Body.Bytes()
+	return err == nil && bytes.Equal(body, rb)
+}
+
+// Recorder is an http.RoundTripper recording interactions to a golden file, or replaying them from it. In replay
+// mode, each recorded interaction is replayed once in the order they were recorded.
+type Recorder struct {
+	file      string
+	mode      Mode
+	transport http.RoundTripper
+	matcher   Matcher
+	redact    []string
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+}
+
+type RecorderOption interface {
+	apply(r *Recorder)
+}
+
+type RecorderOptionFunc func(r *Recorder)
+
+func (o RecorderOptionFunc) apply(r *Recorder) {
+	o(r)
+}
+
+// WithTransport sets the transport sending requests in record mode, http.DefaultTransport by default.
+func WithTransport(transport http.RoundTripper) RecorderOptionFunc {
+	return RecorderOptionFunc(func(r *Recorder) {
+		r.transport = transport
+	})
+}
+
+// WithMatcher replaces DefaultMatcher.
+func WithMatcher(matcher Matcher) RecorderOptionFunc {
+	return RecorderOptionFunc(func(r *Recorder) {
+		r.matcher = matcher
+	})
+}
+
+// WithRedactHeaders replaces values of headers with `REDACTED` in the golden file. Authorization, Cookie and
+// Set-Cookie are always redacted.
+func WithRedactHeaders(names ...string) RecorderOptionFunc {
+	return RecorderOptionFunc(func(r *Recorder) {
+		r.redact = append(r.redact, names...)
+	})
+}
+
+// NewRecorder returns Recorder for golden file. In replay mode, the file is loaded and must exist.
+func NewRecorder(file string, mode Mode, opts ...RecorderOption) (*Recorder, error) {
+	r := &Recorder{
+		file:      file,
+		mode:      mode,
+		transport: http.DefaultTransport,
+		matcher:   DefaultMatcher,
+		redact:    []string{"Authorization", "Cookie", "Set-Cookie"},
+	}
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		o.apply(r)
+	}
+
+	if mode == ModeReplay {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, &r.interactions); err != nil {
+			return nil, fmt.Errorf("sihttptest: invalid golden file %s: %w", file, err)
+		}
+		r.used = make([]bool, len(r.interactions))
+	}
+	return r, nil
+}
+
+// Client returns http.Client using r as its transport.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.mode == ModeRecord {
+		return r.record(req, body)
+	}
+	return r.replay(req, body)
+}
+
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, it := range r.interactions {
+		if r.used[i] || !r.matcher(req, body, it) {
+			continue
+		}
+		respBody, err := it.Response.Body.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		r.used[i] = true
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", it.Response.StatusCode, http.StatusText(it.Response.StatusCode)),
+			StatusCode:    it.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        it.Response.Header.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(respBody)),
+			ContentLength: int64(len(respBody)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrInteractionNotFound, req.Method, req.URL)
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	if body == nil {
+		out.Body = nil
+	}
+
+	resp, err := r.transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	it := &Interaction{
+		Request: InteractionRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: r.redactHeader(req.Header),
+			Body:   newRecordedBody(body),
+		},
+		Response: InteractionResponse{
+			StatusCode: resp.StatusCode,
+			Header:     r.redactHeader(resp.Header),
+			Body:       newRecordedBody(respBody),
+		},
+	}
+	r.mu.Lock()
+	r.interactions = append(r.interactions, it)
+	r.mu.Unlock()
+	return resp, nil
+}
+
+func (r *Recorder) redactHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range r.redact {
+		if _, ok := h[http.CanonicalHeaderKey(name)]; ok {
+			h.Set(name, "REDACTED")
+		}
+	}
+	return h
+}
+
+// Interactions returns recorded or loaded interactions.
+func (r *Recorder) Interactions() []*Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Interaction(nil), r.interactions...)
+}
+
+// Unused returns interactions of the golden file which have not been replayed.
+func (r *Recorder) Unused() []*Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unused []*Interaction
+	for i, it := range r.interactions {
+		if i < len(r.used) && !r.used[i] {
+			unused = append(unused, it)
+		}
+	}
+	return unused
+}
+
+// Save writes recorded interactions to the golden file. It does nothing in replay mode.
+func (r *Recorder) Save() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+	r.mu.Lock()
+	b, err := json.MarshalIndent(r.interactions, "", "  ")
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.file), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(r.file, append(b, '\n'), 0644)
+}
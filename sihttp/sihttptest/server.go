@@ -0,0 +1,349 @@
+// Package sihttptest provides a programmable mock server and a record/replay transport for testing code built on
+// sihttp.
+package sihttptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TestingT is the subset of testing.TB used by Server.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// RecordedRequest is a request received by Server.
+type RecordedRequest struct {
+	Method   string
+	Path     string
+	RawQuery string
+	Header   http.Header
+	Body     []byte
+}
+
+// Server is a mock server replying to requests with routes registered by On. Requests not matching any route are
+// responded with 404 Not Found and reported by AssertExpectations.
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	routes    []*Route
+	requests  []*RecordedRequest
+	unmatched []*RecordedRequest
+}
+
+// NewServer starts a mock server over HTTP.
+func NewServer() *Server {
+	s := &Server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// NewTLSServer starts a mock server over HTTPS. Use Client() of the server to trust its certificate.
+func NewTLSServer() *Server {
+	s := &Server{}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// On registers a route for method and path. If path ends with `*`, it matches paths starting with the rest of it.
+// Routes are matched in the order they are registered, skipping routes used up with Times.
+func (s *Server) On(method, path string) *Route {
+	rt := &Route{
+		mu:     &s.mu,
+		method: strings.ToUpper(method),
+		path:   path,
+		status: http.StatusOK,
+		header: make(http.Header),
+		expect: -1,
+	}
+	s.mu.Lock()
+	s.routes = append(s.routes, rt)
+	s.mu.Unlock()
+	return rt
+}
+
+// Requests returns all requests received so far.
+func (s *Server) Requests() []*RecordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*RecordedRequest(nil), s.requests...)
+}
+
+// Reset removes routes and recorded requests.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes = nil
+	s.requests = nil
+	s.unmatched = nil
+}
+
+// AssertExpectations reports routes not called as many times as set with Expect and requests not matching any
+// route.
+func (s *Server) AssertExpectations(t TestingT) bool {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ok := true
+	for _, rt := range s.routes {
+		if rt.expect >= 0 && rt.calls != rt.expect {
+			t.Errorf("sihttptest: %s %s was called %d times, expected %d", rt.method, rt.path, rt.calls, rt.expect)
+			ok = false
+		}
+	}
+	for _, r := range s.unmatched {
+		t.Errorf("sihttptest: unexpected request %s %s", r.Method, r.Path)
+		ok = false
+	}
+	return ok
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	rec := &RecordedRequest{
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		RawQuery: r.URL.RawQuery,
+		Header:   r.Header.Clone(),
+		Body:     body,
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, rec)
+	var matched *Route
+	for _, rt := range s.routes {
+		if rt.exhausted() || !rt.match(r, body) {
+			continue
+		}
+		matched = rt.snapshot()
+		rt.calls++
+		break
+	}
+	if matched == nil {
+		s.unmatched = append(s.unmatched, rec)
+	}
+	s.mu.Unlock()
+
+	if matched == nil {
+		http.Error(w, fmt.Sprintf("sihttptest: no route for %s %s", r.Method, r.URL.Path), http.StatusNotFound)
+		return
+	}
+	matched.serve(w, r)
+}
+
+// Route is a canned reply of Server. Its methods may be called while the server is serving requests.
+type Route struct {
+	// mu is the lock of the server
+	mu *sync.Mutex
+
+	method string
+	path   string
+
+	headers map[string]string
+	queries map[string]string
+	bodyFn  func(body []byte) bool
+
+	status  int
+	header  http.Header
+	body    []byte
+	handler http.HandlerFunc
+	latency time.Duration
+	reset   bool
+
+	times  int
+	expect int
+	calls  int
+}
+
+// MatchHeader matches requests with header key set to value.
+func (rt *Route) MatchHeader(key, value string) *Route {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.headers == nil {
+		rt.headers = make(map[string]string)
+	}
+	rt.headers[key] = value
+	return rt
+}
+
+// MatchQuery matches requests with query parameter key set to value.
+func (rt *Route) MatchQuery(key, value string) *Route {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.queries == nil {
+		rt.queries = make(map[string]string)
+	}
+	rt.queries[key] = value
+	return rt
+}
+
+// MatchBody matches requests whose body satisfies fn.
+func (rt *Route) MatchBody(fn func(body []byte) bool) *Route {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.bodyFn = fn
+	return rt
+}
+
+// Reply responds with status and body.
+func (rt *Route) Reply(status int, body []byte) *Route {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.status = status
+	rt.body = body
+	return rt
+}
+
+// ReplyJSON responds with status and v encoded as JSON. It panics if v cannot be encoded.
+func (rt *Route) ReplyJSON(status int, v any) *Route {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic("sihttptest: " + err.Error())
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.header.Set("Content-Type", "application/json")
+	rt.status = status
+	rt.body = b
+	return rt
+}
+
+// ReplyHeader adds a response header.
+func (rt *Route) ReplyHeader(key, value string) *Route {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.header.Add(key, value)
+	return rt
+}
+
+// ReplyFunc responds with fn instead of a canned response.
+func (rt *Route) ReplyFunc(fn http.HandlerFunc) *Route {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.handler = fn
+	return rt
+}
+
+// WithLatency delays the response by d, or until the request is canceled.
+func (rt *Route) WithLatency(d time.Duration) *Route {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.latency = d
+	return rt
+}
+
+// ResetConnection closes the connection without a response, with RST on TCP connections.
+func (rt *Route) ResetConnection() *Route {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.reset = true
+	return rt
+}
+
+// Times limits the route to be matched n times. Later requests fall through to the next routes.
+func (rt *Route) Times(n int) *Route {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.times = n
+	return rt
+}
+
+// Expect makes AssertExpectations check that the route is called exactly n times.
+func (rt *Route) Expect(n int) *Route {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.expect = n
+	return rt
+}
+
+// snapshot returns a copy of rt serving a request, so that rt can be changed meanwhile.
+func (rt *Route) snapshot() *Route {
+	c := *rt
+	c.header = rt.header.Clone()
+	return &c
+}
+
+func (rt *Route) exhausted() bool {
+	return rt.times > 0 && rt.calls >= rt.times
+}
+
+func (rt *Route) match(r *http.Request, body []byte) bool {
+	if rt.method != "" && rt.method != r.Method {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(rt.path, "*"); ok {
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			return false
+		}
+	} else if rt.path != r.URL.Path {
+		return false
+	}
+	for k, v := range rt.headers {
+		if r.Header.Get(k) != v {
+			return false
+		}
+	}
+	query := r.URL.Query()
+	for k, v := range rt.queries {
+		if query.Get(k) != v {
+			return false
+		}
+	}
+	return rt.bodyFn == nil || rt.bodyFn(body)
+}
+
+func (rt *Route) serve(w http.ResponseWriter, r *http.Request) {
+	if rt.latency > 0 {
+		t := time.NewTimer(rt.latency)
+		select {
+		case <-t.C:
+		case <-r.Context().Done():
+			t.Stop()
+			return
+		}
+	}
+
+	if rt.reset {
+		resetConnection(w)
+		return
+	}
+
+	if rt.handler != nil {
+		rt.handler(w, r)
+		return
+	}
+	for k, v := range rt.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(rt.status)
+	w.Write(rt.body)
+}
+
+func resetConnection(w http.ResponseWriter) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		panic(http.ErrAbortHandler)
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	if tc, ok := conn.(*net.TCPConn); ok {
+		tc.SetLinger(0)
+	}
+	conn.Close()
+}
@@ -0,0 +1,127 @@
+package sihttp_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-wonk/si/v2/sihttp"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+)
+
+type graphQLStudent struct {
+	Student struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	} `json:"student"`
+}
+
+func TestGraphQLClient_Do(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req sihttp.GraphQLRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		assert.Equal(t, "/graphql", r.URL.Path)
+		assert.Equal(t, "Bearer abc", r.Header.Get("Authorization"))
+		assert.Equal(t, "wonk", req.Variables["name"])
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":{"student":{"name":"wonk","age":0}},"errors":[{"message":"age is hidden",
+"locations":[{"line":1,"column":30}],"path":["student","age"],"extensions":{"code":"FORBIDDEN"}}]}`))
+	}))
+	defer ts.Close()
+
+	client, err := sihttp.NewGraphQLClient(sihttp.NewClient(sihttp.DefaultStandardClient(nil), sihttp.WithBaseUrl(ts.URL)),
+		"/graphql", sihttp.WithGraphQLRequestOption(sihttp.WithBearerToken("abc")))
+	siutils.AssertNilFail(t, err)
+
+	var res graphQLStudent
+	err = client.Do(context.Background(), `query($name: String!) { student(name: $name) { name age } }`,
+		map[string]any{"name": "wonk"}, &res)
+	assert.Equal(t, "wonk", res.Student.Name)
+
+	var gqlErrs sihttp.GraphQLErrors
+	if !assert.True(t, errors.As(err, &gqlErrs)) {
+		t.FailNow()
+	}
+	assert.Len(t, gqlErrs, 1)
+	assert.Equal(t, []any{"student", "age"}, gqlErrs[0].Path)
+	assert.Equal(t, []sihttp.GraphQLLocation{{Line: 1, Column: 30}}, gqlErrs[0].Locations)
+	assert.Equal(t, "FORBIDDEN", gqlErrs[0].Code())
+	assert.Equal(t, "graphql: age is hidden (path: student.age)", err.Error())
+
+	var gqlErr *sihttp.GraphQLError
+	assert.True(t, errors.As(err, &gqlErr))
+}
+
+func TestGraphQLClient_statusError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/invalid" {
+			w.Header().Set("Content-Type", "application/graphql-response+json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"errors":[{"message":"syntax error"}]}`))
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer ts.Close()
+
+	c := sihttp.NewClient(sihttp.DefaultStandardClient(nil), sihttp.WithBaseUrl(ts.URL))
+	invalid, _ := sihttp.NewGraphQLClient(c, "/invalid")
+	err := invalid.Do(context.Background(), "{", nil, nil)
+	var gqlErrs sihttp.GraphQLErrors
+	assert.True(t, errors.As(err, &gqlErrs))
+
+	down, _ := sihttp.NewGraphQLClient(c, "/down")
+	err = down.Do(context.Background(), "{ a }", nil, nil)
+	assert.True(t, errors.Is(err, sihttp.ErrServerStatus))
+}
+
+func TestGraphQLClient_persistedQueries(t *testing.T) {
+	var mu sync.Mutex
+	stored := map[string]string{}
+	var requests []sihttp.GraphQLRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req sihttp.GraphQLRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		defer mu.Unlock()
+		requests = append(requests, req)
+
+		hash := req.Extensions["persistedQuery"].(map[string]any)["sha256Hash"].(string)
+		if req.Query != "" {
+			stored[hash] = req.Query
+		}
+		if _, ok := stored[hash]; !ok {
+			w.Write([]byte(`{"errors":[{"message":"PersistedQueryNotFound","extensions":{"code":"PERSISTED_QUERY_NOT_FOUND"}}]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"student":{"name":"wonk","age":20}}}`))
+	}))
+	defer ts.Close()
+
+	client, err := sihttp.NewGraphQLClient(sihttp.NewClient(sihttp.DefaultStandardClient(nil), sihttp.WithBaseUrl(ts.URL)),
+		"", sihttp.WithPersistedQueries())
+	siutils.AssertNilFail(t, err)
+
+	query := `{ student { name age } }`
+	for i := 0; i < 2; i++ {
+		var res graphQLStudent
+		siutils.AssertNilFail(t, client.Do(context.Background(), query, nil, &res))
+		assert.Equal(t, 20, res.Student.Age)
+	}
+
+	// miss, register, hit
+	assert.Len(t, requests, 3)
+	assert.Empty(t, requests[0].Query)
+	assert.Equal(t, query, requests[1].Query)
+	assert.Empty(t, requests[2].Query)
+	sum := sha256.Sum256([]byte(query))
+	assert.Equal(t, hex.EncodeToString(sum[:]), requests[0].Extensions["persistedQuery"].(map[string]any)["sha256Hash"])
+}
@@ -0,0 +1,143 @@
+package sihttp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-wonk/si/v2/sihttp"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth(t *testing.T) {
+	h := sihttp.NewHealth(50 * time.Millisecond)
+	h.AddLiveness("ok", sihttp.HealthCheckerFunc(func(ctx context.Context) error { return nil }))
+	h.AddReadiness("db", sihttp.HealthCheckerFunc(func(ctx context.Context) error { return errors.New("connection refused") }))
+	h.AddReadiness("slow", sihttp.HealthCheckerFunc(func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}))
+
+	w := httptest.NewRecorder()
+	h.LivenessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	start := time.Now()
+	w = httptest.NewRecorder()
+	h.ReadinessHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	var report sihttp.HealthReport
+	siutils.AssertNilFail(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, sihttp.HealthStatusDown, report.Status)
+	assert.Equal(t, sihttp.HealthStatusUp, report.Checks["ok"].Status)
+	assert.Equal(t, "connection refused", report.Checks["db"].Error)
+	assert.Equal(t, context.DeadlineExceeded.Error(), report.Checks["slow"].Error)
+}
+
+func TestMetricsRegistry(t *testing.T) {
+	r := sihttp.NewMetricsRegistry()
+	c := r.NewCounter("jobs_total", "Total jobs.", "queue")
+	c.Inc("a")
+	c.Add(2, "a")
+	c.Inc(`b"`)
+	g := r.NewGauge("workers", "")
+	g.Set(3)
+	hist := r.NewHistogram("job_seconds", "Job duration.", []float64{1, 0.1})
+	hist.Observe(0.05)
+	hist.Observe(0.5)
+	r.NewGaugeFunc("connections", "Open connections.", func() float64 { return 7 })
+
+	var b strings.Builder
+	_, err := r.WriteTo(&b)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, `# HELP jobs_total Total jobs.
+# TYPE jobs_total counter
+jobs_total{queue="a"} 3
+jobs_total{queue="b\""} 1
+# TYPE workers gauge
+workers 3
+# HELP job_seconds Job duration.
+# TYPE job_seconds histogram
+job_seconds_bucket{le="0.1"} 1
+job_seconds_bucket{le="1"} 2
+job_seconds_bucket{le="+Inf"} 2
+job_seconds_sum 0.55
+job_seconds_count 2
+# HELP connections Open connections.
+# TYPE connections gauge
+connections 7
+`, b.String())
+
+	assert.Panics(t, func() { r.NewGauge("workers", "") })
+}
+
+func TestServer_healthAndMetrics(t *testing.T) {
+	h := sihttp.NewHealth(0)
+	reg := sihttp.NewMetricsRegistry()
+	hs, err := sihttp.NewServerWith(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}), "", sihttp.WithHealth(h), sihttp.WithMetrics(reg))
+	siutils.AssertNilFail(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	siutils.AssertNilFail(t, err)
+	go hs.Serve(ln)
+	defer hs.Stop()
+	base := "http://" + ln.Addr().String()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(base + path)
+		siutils.AssertNilFail(t, err)
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	code, _ := get("/hello")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = get("/readyz")
+	assert.Equal(t, http.StatusOK, code)
+	code, body := get("/metrics")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, `http_requests_total{method="GET",code="200"} 1`)
+
+	hs.SetReady(false)
+	code, body = get("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, sihttp.ErrServerNotReady.Error())
+	code, _ = get("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestWithMetrics_sharedRegistry(t *testing.T) {
+	reg := sihttp.NewMetricsRegistry()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for i := 0; i < 2; i++ {
+		_, err := sihttp.NewServerWith(handler, "", sihttp.WithMetrics(reg))
+		siutils.AssertNilFail(t, err)
+	}
+
+	mw := sihttp.MetricsMiddleware(reg)(handler)
+	mw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	var b strings.Builder
+	_, err := reg.WriteTo(&b)
+	siutils.AssertNilFail(t, err)
+	assert.Contains(t, b.String(), `http_requests_total{method="GET",code="200"} 1`)
+
+	reg = sihttp.NewMetricsRegistry()
+	reg.NewGauge("http_requests_total", "")
+	hs, err := sihttp.NewServerWith(handler, "", sihttp.WithMetrics(reg))
+	assert.NotNil(t, err)
+	assert.Nil(t, hs)
+	assert.Panics(t, func() { sihttp.MetricsMiddleware(reg) })
+}
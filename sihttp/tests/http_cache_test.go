@@ -0,0 +1,114 @@
+package sihttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-wonk/si/v2/sihttp"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func cacheTestServer(calls *int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(calls, 1)
+		switch r.URL.Path {
+		case "/max-age":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Write([]byte(`{"name":"max-age"}`))
+		case "/etag":
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Write([]byte(`{"name":"etag"}`))
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+			w.Write([]byte(`{"name":"no-store"}`))
+		case "/vary":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "Accept-Language")
+			w.Write([]byte(r.Header.Get("Accept-Language")))
+		}
+	}))
+}
+
+func TestClient_Cache(t *testing.T) {
+	var calls int64
+	ts := cacheTestServer(&calls)
+	defer ts.Close()
+
+	cache := sihttp.NewCache(nil)
+	client := sihttp.NewClient(ts.Client(), sihttp.WithBaseUrl(ts.URL), sihttp.WithCache(cache))
+
+	type res struct {
+		Name string `json:"name"`
+	}
+
+	t.Run("max-age", func(t *testing.T) {
+		atomic.StoreInt64(&calls, 0)
+		for i := 0; i < 3; i++ {
+			b, err := client.Get("/max-age", nil, nil)
+			siutils.AssertNilFail(t, err)
+			assert.Equal(t, `{"name":"max-age"}`, string(b))
+		}
+		assert.EqualValues(t, 1, atomic.LoadInt64(&calls))
+	})
+
+	t.Run("etag", func(t *testing.T) {
+		atomic.StoreInt64(&calls, 0)
+		for i := 0; i < 3; i++ {
+			b, err := client.Get("/etag", nil, nil)
+			siutils.AssertNilFail(t, err)
+			assert.Equal(t, `{"name":"etag"}`, string(b))
+		}
+		assert.EqualValues(t, 3, atomic.LoadInt64(&calls))
+	})
+
+	t.Run("no-store", func(t *testing.T) {
+		atomic.StoreInt64(&calls, 0)
+		for i := 0; i < 2; i++ {
+			_, err := client.Get("/no-store", nil, nil)
+			siutils.AssertNilFail(t, err)
+		}
+		assert.EqualValues(t, 2, atomic.LoadInt64(&calls))
+	})
+
+	t.Run("vary", func(t *testing.T) {
+		atomic.StoreInt64(&calls, 0)
+		for _, lang := range []string{"en", "ko", "en"} {
+			header := http.Header{"Accept-Language": []string{lang}}
+			b, err := client.Get("/vary", header, nil)
+			siutils.AssertNilFail(t, err)
+			assert.Equal(t, lang, string(b))
+		}
+		assert.EqualValues(t, 3, atomic.LoadInt64(&calls))
+	})
+
+	stats := cache.Stats()
+	assert.EqualValues(t, 2, stats.Hits)
+	assert.EqualValues(t, 2, stats.Revalidations)
+	assert.EqualValues(t, 7, stats.Misses)
+}
+
+func TestLRUCacheStore(t *testing.T) {
+	s := sihttp.NewLRUCacheStore(2)
+	s.Set("a", &sihttp.CacheEntry{Body: []byte("a")})
+	s.Set("b", &sihttp.CacheEntry{Body: []byte("b")})
+	_, ok := s.Get("a")
+	assert.True(t, ok)
+
+	s.Set("c", &sihttp.CacheEntry{Body: []byte("c")})
+	_, ok = s.Get("b")
+	assert.False(t, ok)
+	_, ok = s.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 2, s.Len())
+
+	s.Delete("a")
+	assert.Equal(t, 1, s.Len())
+}
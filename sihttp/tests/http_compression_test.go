@@ -0,0 +1,146 @@
+package sihttp_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/go-wonk/si/v2/sihttp"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func compressTestBody(t *testing.T, encoding string, b []byte) []byte {
+	buf := &bytes.Buffer{}
+	var w io.WriteCloser
+	switch encoding {
+	case sihttp.EncodingGzip:
+		w = gzip.NewWriter(buf)
+	case sihttp.EncodingZstd:
+		zw, err := zstd.NewWriter(buf)
+		siutils.AssertNilFail(t, err)
+		w = zw
+	case sihttp.EncodingBrotli:
+		w = brotli.NewWriter(buf)
+	}
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+func decompressTestBody(encoding string, r io.Reader) ([]byte, error) {
+	switch encoding {
+	case sihttp.EncodingGzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(zr)
+	case sihttp.EncodingZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	case sihttp.EncodingBrotli:
+		return io.ReadAll(brotli.NewReader(r))
+	}
+	return io.ReadAll(r)
+}
+
+func compressionTestServer(t *testing.T, payload []byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			// echo the decompressed request body
+			b, err := decompressTestBody(r.Header.Get("Content-Encoding"), r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write(b)
+			return
+		}
+
+		encoding := r.URL.Query().Get("encoding")
+		if encoding == "" || !strings.Contains(r.Header.Get("Accept-Encoding"), encoding) {
+			w.Write(payload)
+			return
+		}
+		w.Header().Set("Content-Encoding", encoding)
+		w.Write(compressTestBody(t, encoding, payload))
+	}))
+}
+
+func TestClient_requestCompression(t *testing.T) {
+	ts := compressionTestServer(t, nil)
+	defer ts.Close()
+
+	client := sihttp.NewClient(sihttp.DefaultStandardClient(nil), sihttp.WithBaseUrl(ts.URL))
+	for _, encoding := range []string{sihttp.EncodingGzip, sihttp.EncodingZstd, sihttp.EncodingBrotli} {
+		body := []byte(strings.Repeat(`{"name":"wonk"}`, 100))
+		b, err := client.Post("/", nil, body, sihttp.WithRequestCompression(encoding))
+		siutils.AssertNilFail(t, err)
+		assert.Equal(t, body, b, encoding)
+	}
+
+	_, err := client.Post("/", nil, []byte("a"), sihttp.WithRequestCompression("lz4"))
+	assert.Error(t, err)
+}
+
+func TestClient_decompression(t *testing.T) {
+	payload := []byte(strings.Repeat(`{"name":"wonk"}`, 100))
+	ts := compressionTestServer(t, payload)
+	defer ts.Close()
+
+	client := sihttp.NewClient(sihttp.DefaultStandardClient(nil), sihttp.WithBaseUrl(ts.URL),
+		sihttp.WithDecompression(int64(len(payload))))
+	for _, encoding := range []string{sihttp.EncodingGzip, sihttp.EncodingZstd, sihttp.EncodingBrotli} {
+		b, err := client.Get("/", nil, map[string]string{"encoding": encoding})
+		siutils.AssertNilFail(t, err)
+		assert.Equal(t, payload, b, encoding)
+	}
+}
+
+func TestClient_decompressionLimit(t *testing.T) {
+	payload := bytes.Repeat([]byte{'0'}, 1<<20)
+	ts := compressionTestServer(t, payload)
+	defer ts.Close()
+
+	client := sihttp.NewClient(sihttp.DefaultStandardClient(nil), sihttp.WithBaseUrl(ts.URL),
+		sihttp.WithDecompression(1024))
+	for _, encoding := range []string{sihttp.EncodingGzip, sihttp.EncodingZstd, sihttp.EncodingBrotli} {
+		_, err := client.Get("/", nil, map[string]string{"encoding": encoding})
+		assert.True(t, errors.Is(err, sihttp.ErrDecompressedTooLarge), encoding)
+	}
+
+	// uncompressed responses are not limited
+	b, err := client.Get("/", nil, nil)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, payload, b)
+}
+
+func TestClient_decompressionRange(t *testing.T) {
+	payload := []byte(strings.Repeat(`{"name":"wonk"}`, 100))
+	var acceptEncoding string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(payload))
+	}))
+	defer ts.Close()
+
+	client := sihttp.NewClient(sihttp.DefaultStandardClient(nil), sihttp.WithBaseUrl(ts.URL),
+		sihttp.WithDecompression(0))
+	b, err := client.Get("/", http.Header{"Range": []string{"bytes=5-"}}, nil)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, payload[5:], b)
+	assert.Empty(t, acceptEncoding)
+}
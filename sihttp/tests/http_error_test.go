@@ -0,0 +1,166 @@
+package sihttp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-wonk/si/v2/sicore"
+	"github.com/go-wonk/si/v2/sihttp"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func errorTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/problem":
+			w.Header().Set("Content-Type", sihttp.ProblemContentType)
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"type":"https://example.com/not-found","title":"Not Found","status":404,"detail":"no such student","student_id":3}`))
+		case "/api-error":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"code":"E001","message":"maintenance"}`))
+		case "/invalid-json":
+			w.Write([]byte(`{"name":`))
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte(`{}`))
+		}
+	}))
+}
+
+func TestError_problem(t *testing.T) {
+	ts := errorTestServer()
+	defer ts.Close()
+
+	client := sihttp.NewClient(ts.Client(), sihttp.WithBaseUrl(ts.URL))
+	_, err := client.Get("/problem", nil, nil)
+	siutils.AssertNotNilFail(t, err)
+
+	assert.True(t, errors.Is(err, sihttp.ErrClientStatus))
+	assert.False(t, errors.Is(err, sihttp.ErrServerStatus))
+
+	var e *sihttp.Error
+	if !assert.True(t, errors.As(err, &e)) {
+		t.FailNow()
+	}
+	assert.Equal(t, sihttp.ErrorKindClient, e.Kind)
+	siutils.AssertNotNilFail(t, e.Problem)
+	assert.Equal(t, "Not Found", e.Problem.Title)
+	assert.Equal(t, 404, e.Problem.Status)
+	assert.Equal(t, "no such student", e.Problem.Detail)
+	assert.EqualValues(t, 3, e.Problem.Extensions["student_id"])
+
+	b, err := json.Marshal(e.Problem)
+	siutils.AssertNilFail(t, err)
+	assert.JSONEq(t, `{"type":"https://example.com/not-found","title":"Not Found","status":404,"detail":"no such student","student_id":3}`, string(b))
+}
+
+func TestError_errorBody(t *testing.T) {
+	ts := errorTestServer()
+	defer ts.Close()
+
+	client := sihttp.NewClient(ts.Client(), sihttp.WithBaseUrl(ts.URL),
+		sihttp.WithErrorBody[apiError]())
+
+	var res map[string]any
+	err := client.GetDecode("/api-error", nil, nil, &res)
+	siutils.AssertNotNilFail(t, err)
+	assert.True(t, errors.Is(err, sihttp.ErrServerStatus))
+
+	ae, ok := sihttp.ErrorBodyAs[apiError](err)
+	if !assert.True(t, ok) {
+		t.FailNow()
+	}
+	assert.Equal(t, apiError{"E001", "maintenance"}, *ae)
+}
+
+func TestError_decode(t *testing.T) {
+	ts := errorTestServer()
+	defer ts.Close()
+
+	client := sihttp.NewClient(ts.Client(), sihttp.WithBaseUrl(ts.URL),
+		sihttp.WithReaderOpt(sicore.SetJsonDecoder()))
+
+	var res map[string]any
+	err := client.GetDecode("/invalid-json", nil, nil, &res)
+	siutils.AssertNotNilFail(t, err)
+	assert.True(t, errors.Is(err, sihttp.ErrDecode))
+	assert.False(t, errors.Is(err, sihttp.ErrClientStatus))
+
+	var e *sihttp.Error
+	if !assert.True(t, errors.As(err, &e)) {
+		t.FailNow()
+	}
+	assert.Equal(t, http.StatusOK, e.GetStatusCode(0))
+	assert.Equal(t, `{"name":`, string(e.Body))
+}
+
+func TestError_transport(t *testing.T) {
+	ts := errorTestServer()
+	defer ts.Close()
+
+	client := sihttp.NewClient(ts.Client(), sihttp.WithBaseUrl(ts.URL))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.GetContext(ctx, "/slow", nil, nil)
+	siutils.AssertNotNilFail(t, err)
+	assert.True(t, errors.Is(err, sihttp.ErrTimeout))
+	assert.True(t, errors.Is(err, sihttp.ErrTransport))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	closed := sihttp.NewClient(ts.Client())
+	_, err = closed.Get("http://127.0.0.1:1/", nil, nil)
+	siutils.AssertNotNilFail(t, err)
+	assert.True(t, errors.Is(err, sihttp.ErrTransport))
+	assert.False(t, errors.Is(err, sihttp.ErrTimeout))
+}
+
+func TestError_tokenIsNotTransport(t *testing.T) {
+	ts := errorTestServer()
+	defer ts.Close()
+
+	errToken := errors.New("token endpoint is down")
+	tm := sihttp.NewTokenManager(tokenSourceFunc(func() (*oauth2.Token, error) {
+		return nil, errToken
+	}), 0)
+	client := sihttp.NewClient(ts.Client(), sihttp.WithBaseUrl(ts.URL), sihttp.WithTokenManager(tm))
+
+	_, err := client.Get("/invalid-json", nil, nil)
+	siutils.AssertNotNilFail(t, err)
+	assert.ErrorIs(t, err, errToken)
+	assert.False(t, errors.Is(err, sihttp.ErrTransport))
+
+	var res map[string]any
+	err = client.GetDecode("/invalid-json", nil, nil, &res)
+	siutils.AssertNotNilFail(t, err)
+	assert.ErrorIs(t, err, errToken)
+	assert.False(t, errors.Is(err, sihttp.ErrTransport))
+
+	// Do returns the error of http.Client.Do as it is
+	req, err := http.NewRequest(http.MethodGet, "http://127.0.0.1:1/", nil)
+	siutils.AssertNilFail(t, err)
+	_, err = sihttp.NewClient(ts.Client()).Do(req)
+	var urlErr *url.Error
+	assert.ErrorAs(t, err, &urlErr)
+}
+
+type tokenSourceFunc func() (*oauth2.Token, error)
+
+func (f tokenSourceFunc) Token() (*oauth2.Token, error) {
+	return f()
+}
@@ -0,0 +1,146 @@
+package sihttp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-wonk/si/v2/sihttp"
+	"github.com/stretchr/testify/assert"
+)
+
+type updateStudentRequest struct {
+	ID     int      `path:"id"`
+	Tags   []string `query:"tag"`
+	Tenant string   `header:"X-Tenant"`
+	Name   string   `json:"name"`
+	Age    int      `json:"age"`
+}
+
+func (r *updateStudentRequest) Validate() error {
+	if r.Name == "" {
+		return sihttp.FieldErrors{"name": "required"}
+	}
+	if r.Age < 0 {
+		return errors.New("age must not be negative")
+	}
+	return nil
+}
+
+type studentResponse struct {
+	ID     int      `json:"id"`
+	Name   string   `json:"name"`
+	Tags   []string `json:"tags"`
+	Tenant string   `json:"tenant"`
+}
+
+var errStudentNotFound = &sihttp.Problem{Status: http.StatusNotFound, Title: "student not found"}
+
+func newStudentHandler() http.Handler {
+	rt := sihttp.NewRouter()
+	rt.Handle(http.MethodPut, "/students/{id}", sihttp.HandleJSON(
+		func(ctx context.Context, req updateStudentRequest) (studentResponse, error) {
+			switch req.ID {
+			case 404:
+				return studentResponse{}, errStudentNotFound
+			case 500:
+				return studentResponse{}, errors.New("database is down")
+			}
+			return studentResponse{ID: req.ID, Name: req.Name, Tags: req.Tags, Tenant: req.Tenant}, nil
+		}, sihttp.WithHandlerLogger(log.New(io.Discard, "", 0))))
+	return rt
+}
+
+func serveStudent(h http.Handler, path, body string) (*httptest.ResponseRecorder, map[string]any) {
+	r := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+	r.Header.Set("X-Tenant", "school")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	var m map[string]any
+	json.Unmarshal(w.Body.Bytes(), &m)
+	return w, m
+}
+
+func TestHandleJSON(t *testing.T) {
+	h := newStudentHandler()
+
+	w, m := serveStudent(h, "/students/3?tag=a&tag=b", `{"name":"wonk","age":20}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, map[string]any{"id": 3.0, "name": "wonk", "tags": []any{"a", "b"}, "tenant": "school"}, m)
+}
+
+func TestHandleJSON_errors(t *testing.T) {
+	h := newStudentHandler()
+
+	tests := []struct {
+		path   string
+		body   string
+		status int
+		detail string
+	}{
+		{"/students/abc", `{"name":"wonk"}`, http.StatusBadRequest, `invalid path id: strconv.ParseInt: parsing "abc": invalid syntax`},
+		{"/students/3", `{"name":`, http.StatusBadRequest, "invalid body: unexpected EOF"},
+		{"/students/3", `{"name":""}`, http.StatusUnprocessableEntity, "validation failed"},
+		{"/students/3", `{"name":"wonk","age":-1}`, http.StatusUnprocessableEntity, "age must not be negative"},
+		{"/students/404", `{"name":"wonk"}`, http.StatusNotFound, ""},
+		{"/students/500", `{"name":"wonk"}`, http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		w, m := serveStudent(h, tt.path, tt.body)
+		assert.Equal(t, tt.status, w.Code, tt.path)
+		assert.Equal(t, sihttp.ProblemContentType, w.Header().Get("Content-Type"))
+		assert.EqualValues(t, tt.status, m["status"])
+		if tt.detail != "" {
+			assert.Equal(t, tt.detail, m["detail"], tt.path)
+		} else {
+			assert.Nil(t, m["detail"])
+		}
+	}
+
+	_, m := serveStudent(h, "/students/3", `{"name":""}`)
+	assert.Equal(t, map[string]any{"name": "required"}, m["errors"])
+	_, m = serveStudent(h, "/students/404", `{"name":"wonk"}`)
+	assert.Equal(t, "student not found", m["title"])
+	assert.Equal(t, "/students/404", m["instance"])
+}
+
+func TestHandleJSON_clientError(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", sihttp.ProblemContentType)
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`{"title":"duplicated","detail":"student exists"}`))
+	}))
+	defer upstream.Close()
+	client := sihttp.NewClient(upstream.Client(), sihttp.WithBaseUrl(upstream.URL))
+
+	h := sihttp.HandleNoContent(func(ctx context.Context, req struct{}) error {
+		_, err := client.PostContext(ctx, "/students", nil, []byte(`{}`))
+		return err
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.JSONEq(t, `{"title":"duplicated","detail":"student exists","status":409,"instance":"/"}`, w.Body.String())
+}
+
+func TestHandleJSON_successStatus(t *testing.T) {
+	h := sihttp.HandleJSON(func(ctx context.Context, req *struct {
+		Page int `query:"page"`
+	}) (map[string]int, error) {
+		return map[string]int{"page": req.Page}, nil
+	}, sihttp.WithSuccessStatus(http.StatusCreated))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/?page=2", nil))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"page":2}`, w.Body.String())
+}
@@ -0,0 +1,99 @@
+package sihttp_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-wonk/si/v2/sihttp"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+)
+
+type receivedPart struct {
+	Name        string `json:"name"`
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	Data        string `json:"data"`
+}
+
+func multipartEchoServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		parts := []receivedPart{{Name: "method", Data: r.Method}}
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			b, _ := io.ReadAll(p)
+			parts = append(parts, receivedPart{
+				Name:        p.FormName(),
+				FileName:    p.FileName(),
+				ContentType: p.Header.Get("Content-Type"),
+				Data:        string(b),
+			})
+		}
+		json.NewEncoder(w).Encode(parts)
+	}))
+}
+
+func TestClient_PutMultipart(t *testing.T) {
+	ts := multipartEchoServer()
+	defer ts.Close()
+
+	client := sihttp.NewClient(ts.Client(), sihttp.WithBaseUrl(ts.URL))
+
+	var transferred int64
+	mb := sihttp.NewMultipartBuilder().
+		AddField("title", "report").
+		AddFile("file1", "a.csv", "text/csv", strings.NewReader("a,b\n1,2\n")).
+		AddFile("file2", "b.bin", "", strings.NewReader("binary")).
+		WithProgress(func(n, total int64) {
+			transferred = n
+			assert.EqualValues(t, -1, total)
+		})
+
+	b, err := client.PutMultipartContext(context.Background(), "/upload", nil, mb)
+	siutils.AssertNilFail(t, err)
+
+	var parts []receivedPart
+	siutils.AssertNilFail(t, json.Unmarshal(b, &parts))
+	assert.Equal(t, []receivedPart{
+		{Name: "method", Data: http.MethodPut},
+		{Name: "title", Data: "report"},
+		{Name: "file1", FileName: "a.csv", ContentType: "text/csv", Data: "a,b\n1,2\n"},
+		{Name: "file2", FileName: "b.bin", ContentType: "application/octet-stream", Data: "binary"},
+	}, parts)
+	assert.Greater(t, transferred, int64(0))
+}
+
+func TestClient_PostFile_streamed(t *testing.T) {
+	ts := multipartEchoServer()
+	defer ts.Close()
+
+	client := sihttp.NewClient(ts.Client(), sihttp.WithBaseUrl(ts.URL))
+
+	b, err := client.PostFile("/upload", nil, map[string]string{"k": "v"}, "file", "./data/testfile.txt")
+	siutils.AssertNilFail(t, err)
+
+	var parts []receivedPart
+	siutils.AssertNilFail(t, json.Unmarshal(b, &parts))
+	assert.Len(t, parts, 3)
+	assert.Equal(t, "file", parts[1].Name)
+	assert.Equal(t, "testfile.txt", parts[1].FileName)
+	assert.Equal(t, receivedPart{Name: "k", Data: "v"}, parts[2])
+}
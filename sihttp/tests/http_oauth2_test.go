@@ -0,0 +1,214 @@
+package sihttp_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-wonk/si/v2/sihttp"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+type oauth2TestServer struct {
+	*httptest.Server
+	issued  int64
+	revoked string
+	revoke  func(token string)
+}
+
+func newOauth2TestServer(expiresIn int) *oauth2TestServer {
+	s := &oauth2TestServer{}
+	var mu sync.Mutex
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			id, secret, _ := r.BasicAuth()
+			if id != "client" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+			n := atomic.AddInt64(&s.issued, 1)
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":%d}`, n, expiresIn)
+		case "/resource":
+			mu.Lock()
+			revoked := s.revoked
+			mu.Unlock()
+			auth := r.Header.Get("Authorization")
+			if !strings.HasPrefix(auth, "Bearer token-") || auth == "Bearer "+revoked {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(strings.TrimPrefix(auth, "Bearer ")))
+		}
+	}))
+	s.revoke = func(token string) {
+		mu.Lock()
+		s.revoked = token
+		mu.Unlock()
+	}
+	return s
+}
+
+func (s *oauth2TestServer) config() *clientcredentials.Config {
+	return &clientcredentials.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		TokenURL:     s.URL + "/token",
+		AuthStyle:    oauth2.AuthStyleInHeader,
+	}
+}
+
+func TestTokenManager_singleFlight(t *testing.T) {
+	ts := newOauth2TestServer(3600)
+	defer ts.Close()
+
+	tm := sihttp.NewClientCredentialsTokenManager(context.Background(), ts.config(), 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tok, err := tm.Token()
+			assert.Nil(t, err)
+			assert.Equal(t, "token-1", tok.AccessToken)
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, atomic.LoadInt64(&ts.issued))
+}
+
+type panickingTokenSource struct {
+	calls   int64
+	release chan struct{}
+}
+
+func (s *panickingTokenSource) Token() (*oauth2.Token, error) {
+	if atomic.AddInt64(&s.calls, 1) == 1 {
+		<-s.release
+		panic("token endpoint")
+	}
+	return &oauth2.Token{AccessToken: "token"}, nil
+}
+
+func TestTokenManager_sourcePanics(t *testing.T) {
+	source := &panickingTokenSource{release: make(chan struct{})}
+	tm := sihttp.NewTokenManager(source, 0)
+
+	panicked := make(chan any)
+	go func() {
+		defer func() { panicked <- recover() }()
+		tm.Token()
+	}()
+	for atomic.LoadInt64(&source.calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// a caller waiting for the panicking call gets an error
+	waited := make(chan error)
+	go func() {
+		_, err := tm.Token()
+		waited <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(source.release)
+	assert.NotNil(t, <-panicked)
+	assert.NotNil(t, <-waited)
+
+	tok, err := tm.Token()
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "token", tok.AccessToken)
+}
+
+func TestTokenManager_refreshBeforeExpiry(t *testing.T) {
+	ts := newOauth2TestServer(10)
+	defer ts.Close()
+
+	// tokens expiring in 10 seconds are always within the refresh window of 1 minute
+	tm := sihttp.NewClientCredentialsTokenManager(context.Background(), ts.config(), time.Minute)
+
+	tok, err := tm.Token()
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "token-1", tok.AccessToken)
+
+	tok, err = tm.Token()
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "token-2", tok.AccessToken)
+}
+
+func TestClient_WithTokenManager_reauthOn401(t *testing.T) {
+	ts := newOauth2TestServer(3600)
+	defer ts.Close()
+
+	tm := sihttp.NewClientCredentialsTokenManager(context.Background(), ts.config(), 0)
+	client := sihttp.NewClient(ts.Client(), sihttp.WithBaseUrl(ts.URL), sihttp.WithTokenManager(tm))
+
+	b, err := client.Get("/resource", nil, nil)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "token-1", string(b))
+
+	ts.revoke("token-1")
+
+	b, err = client.Post("/resource", nil, []byte("body"))
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "token-2", string(b))
+	assert.EqualValues(t, 2, atomic.LoadInt64(&ts.issued))
+
+	// Authorization set by caller is not replaced
+	_, err = client.Get("/resource", http.Header{"Authorization": []string{"Bearer token-1"}}, nil)
+	assert.ErrorIs(t, err, sihttp.ErrClientStatus)
+	assert.EqualValues(t, 2, atomic.LoadInt64(&ts.issued))
+}
+
+func TestClient_WithTokenManager_noRetryOn401(t *testing.T) {
+	ts := newOauth2TestServer(3600)
+	defer ts.Close()
+
+	var requests int64
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer rejecting.Close()
+
+	tm := sihttp.NewClientCredentialsTokenManager(context.Background(), ts.config(), 0)
+	client := sihttp.NewClient(ts.Client(), sihttp.WithBaseUrl(rejecting.URL), sihttp.WithTokenManager(tm),
+		sihttp.WithRetryAttempts(2))
+
+	_, err := client.Get("/resource", nil, nil)
+	assert.ErrorIs(t, err, sihttp.ErrClientStatus)
+	// the request and its retry by the token manager only
+	assert.EqualValues(t, 2, atomic.LoadInt64(&requests))
+}
+
+func TestClient_WithTokenManager_reusedRequest(t *testing.T) {
+	ts := newOauth2TestServer(3600)
+	defer ts.Close()
+
+	tm := sihttp.NewClientCredentialsTokenManager(context.Background(), ts.config(), 0)
+	client := sihttp.NewClient(ts.Client(), sihttp.WithTokenManager(tm))
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/resource", nil)
+	siutils.AssertNilFail(t, err)
+	b, err := client.DoRead(req)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "token-1", string(b))
+	assert.Empty(t, req.Header.Get("Authorization"))
+
+	// the request sent again gets the refreshed token
+	ts.revoke("token-1")
+	b, err = client.DoRead(req)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "token-2", string(b))
+}
@@ -0,0 +1,217 @@
+package sihttp_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-wonk/si/v2/sihttp"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+)
+
+// test vectors from AWS Signature Version 4 test suite and documentation.
+func TestAwsSigV4Signer_Sign(t *testing.T) {
+	signTime, _ := time.Parse("20060102T150405Z", "20150830T123600Z")
+
+	t.Run("get-vanilla", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+		siutils.AssertNilFail(t, err)
+
+		s := &sihttp.AwsSigV4Signer{
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+			Region:          "us-east-1",
+			Service:         "service",
+		}
+		siutils.AssertNilFail(t, s.Sign(req, signTime))
+		assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+		assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+			"SignedHeaders=host;x-amz-date, "+
+			"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+			req.Header.Get("Authorization"))
+	})
+
+	t.Run("iam-list-users", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Version=2010-05-08&Action=ListUsers", nil)
+		siutils.AssertNilFail(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+		s := &sihttp.AwsSigV4Signer{
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+			Region:          "us-east-1",
+			Service:         "iam",
+		}
+		siutils.AssertNilFail(t, s.Sign(req, signTime))
+		assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, "+
+			"SignedHeaders=content-type;host;x-amz-date, "+
+			"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+			req.Header.Get("Authorization"))
+	})
+
+	t.Run("s3-content-sha256", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPut, "https://bucket.s3.amazonaws.com/key", strings.NewReader("hello"))
+		siutils.AssertNilFail(t, err)
+
+		s := &sihttp.AwsSigV4Signer{
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+			Region:          "us-east-1",
+			Service:         "s3",
+		}
+		siutils.AssertNilFail(t, s.Sign(req, signTime))
+		assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", req.Header.Get("X-Amz-Content-Sha256"))
+		assert.Contains(t, req.Header.Get("Authorization"), "SignedHeaders=host;x-amz-content-sha256;x-amz-date,")
+	})
+
+	t.Run("canonical-uri", func(t *testing.T) {
+		for service, uri := range map[string]string{
+			"service": "/a%253Ab%2520c/d%252Fe",
+			"s3":      "/a%3Ab%20c/d%2Fe",
+		} {
+			req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/a:b%20c/d%2Fe", nil)
+			siutils.AssertNilFail(t, err)
+
+			s := &sihttp.AwsSigV4Signer{
+				AccessKeyID:     "AKIDEXAMPLE",
+				SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+				Region:          "us-east-1",
+				Service:         service,
+			}
+			siutils.AssertNilFail(t, s.Sign(req, signTime))
+
+			headers := "host:example.amazonaws.com\nx-amz-date:20150830T123600Z\n"
+			signedHeaders := "host;x-amz-date"
+			payloadHash := sha256Hex("")
+			if service == "s3" {
+				headers = "host:example.amazonaws.com\nx-amz-content-sha256:" + payloadHash + "\nx-amz-date:20150830T123600Z\n"
+				signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+			}
+			canonicalRequest := strings.Join([]string{http.MethodGet, uri, "", headers, signedHeaders, payloadHash}, "\n")
+			scope := "20150830/us-east-1/" + service + "/aws4_request"
+			stringToSign := "AWS4-HMAC-SHA256\n20150830T123600Z\n" + scope + "\n" + sha256Hex(canonicalRequest)
+
+			key := []byte("AWS4" + s.SecretAccessKey)
+			for _, v := range []string{"20150830", "us-east-1", service, "aws4_request", stringToSign} {
+				mac := hmac.New(sha256.New, key)
+				mac.Write([]byte(v))
+				key = mac.Sum(nil)
+			}
+			assert.Contains(t, req.Header.Get("Authorization"), "Signature="+hex.EncodeToString(key), service)
+		}
+	})
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func newSignatureTestRequest(t *testing.T) *http.Request {
+	req, err := http.NewRequest(http.MethodPost, "https://example.com/foo?param=Value&Pet=dog",
+		strings.NewReader(`{"hello": "world"}`))
+	siutils.AssertNilFail(t, err)
+	req.Header.Set("Date", "Tue, 20 Apr 2021 02:07:55 GMT")
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+// test vector from RFC 9421 appendix B.2.5.
+func TestHttpMessageSigner_hmacSha256(t *testing.T) {
+	key, _ := base64.StdEncoding.DecodeString("uzvJfB4u3N0Jy4T7NZ75MDVcr8zSTInedJtkgcu46YW4XByzNJjxBdtjUkdJPBtbmHhIDi6pcl8jsasjlTMtDQ==")
+	req := newSignatureTestRequest(t)
+
+	s := &sihttp.HttpMessageSigner{
+		KeyID:      "test-shared-secret",
+		Algorithm:  sihttp.SignatureAlgHmacSha256,
+		Key:        key,
+		Components: []string{"date", "@authority", "content-type"},
+	}
+	siutils.AssertNilFail(t, s.Sign(req, time.Unix(1618884473, 0)))
+	assert.Equal(t, `sig1=("date" "@authority" "content-type");created=1618884473;keyid="test-shared-secret"`,
+		req.Header.Get("Signature-Input"))
+	assert.Equal(t, "sig1=:pxcQw6G3AjtMBQjwo8XzkZf/bws5LelbaMk5rGIGtE8=:", req.Header.Get("Signature"))
+}
+
+func TestSignatureBase(t *testing.T) {
+	req := newSignatureTestRequest(t)
+	base, err := sihttp.SignatureBase(req,
+		[]string{"@method", "@authority", "@path", "@query", "@target-uri", "content-type"},
+		`("@method" "@authority" "@path" "@query" "@target-uri" "content-type");created=1618884473`)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, `"@method": POST
+"@authority": example.com
+"@path": /foo
+"@query": ?param=Value&Pet=dog
+"@target-uri": https://example.com/foo?param=Value&Pet=dog
+"content-type": application/json
+"@signature-params": ("@method" "@authority" "@path" "@query" "@target-uri" "content-type");created=1618884473`, base)
+
+	_, err = sihttp.SignatureBase(req, []string{"x-missing"}, "()")
+	assert.ErrorIs(t, err, sihttp.ErrUnsupportedSignatureComponent)
+}
+
+func TestHttpMessageSigner_contentDigest(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	siutils.AssertNilFail(t, err)
+
+	req := newSignatureTestRequest(t)
+	s := &sihttp.HttpMessageSigner{
+		Label:      "sig-b26",
+		KeyID:      "test-key-ed25519",
+		Algorithm:  sihttp.SignatureAlgEd25519,
+		Key:        priv,
+		Components: []string{"@method", "@path", "content-digest"},
+	}
+	created := time.Unix(1618884473, 0)
+	siutils.AssertNilFail(t, s.Sign(req, created))
+	assert.Equal(t, "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:", req.Header.Get("Content-Digest"))
+
+	params := `("@method" "@path" "content-digest");created=1618884473;keyid="test-key-ed25519"`
+	assert.Equal(t, "sig-b26="+params, req.Header.Get("Signature-Input"))
+
+	base, err := sihttp.SignatureBase(req, s.Components, params)
+	siutils.AssertNilFail(t, err)
+	sig, err := base64.StdEncoding.DecodeString(strings.Trim(strings.TrimPrefix(req.Header.Get("Signature"), "sig-b26="), ":"))
+	siutils.AssertNilFail(t, err)
+	assert.True(t, ed25519.Verify(pub, []byte(base), sig))
+}
+
+func TestHttpMessageSigner_ecdsa(t *testing.T) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	siutils.AssertNilFail(t, err)
+
+	req := newSignatureTestRequest(t)
+	s := &sihttp.HttpMessageSigner{
+		KeyID:      "test-key-ecc-p256",
+		Algorithm:  sihttp.SignatureAlgEcdsaP256Sha256,
+		Key:        priv,
+		Components: []string{"@method", "@authority"},
+		IncludeAlg: true,
+	}
+	siutils.AssertNilFail(t, s.Sign(req, time.Unix(1618884473, 0)))
+
+	params := `("@method" "@authority");created=1618884473;keyid="test-key-ecc-p256";alg="ecdsa-p256-sha256"`
+	base, err := sihttp.SignatureBase(req, s.Components, params)
+	siutils.AssertNilFail(t, err)
+	sig, err := base64.StdEncoding.DecodeString(strings.Trim(strings.TrimPrefix(req.Header.Get("Signature"), "sig1="), ":"))
+	siutils.AssertNilFail(t, err)
+	if !assert.Len(t, sig, 64) {
+		t.FailNow()
+	}
+
+	h := sha256.Sum256([]byte(base))
+	r, ss := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+	assert.True(t, ecdsa.Verify(&priv.PublicKey, h[:], r, ss))
+}
@@ -0,0 +1,231 @@
+package sihttp_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-wonk/si/v2/sihttp"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestSSEReader_Next(t *testing.T) {
+	stream := ": comment\n" +
+		"retry: 1500\n" +
+		"id: 1\n" +
+		"event: greeting\n" +
+		"data: hello\n" +
+		"data:  world\n" +
+		"\n" +
+		"data: no type\r\n" +
+		"\r\n" +
+		"id: 2\n" +
+		"data: incomplete"
+
+	sr := sihttp.NewSSEReader(strings.NewReader(stream))
+
+	ev, err := sr.Next()
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "1", ev.ID)
+	assert.Equal(t, "greeting", ev.Event)
+	assert.Equal(t, "hello\n world", ev.Data)
+	assert.Equal(t, 1500*time.Millisecond, ev.Retry)
+
+	ev, err = sr.Next()
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "1", ev.ID)
+	assert.Equal(t, "message", ev.Event)
+	assert.Equal(t, "no type", ev.Data)
+
+	_, err = sr.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestClient_SubscribeSSE_reconnect(t *testing.T) {
+	var lastEventIDs []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		w.Header().Set("Content-Type", "text/event-stream")
+		if r.Header.Get("Last-Event-ID") == "" {
+			fmt.Fprint(w, "retry: 10\nid: 1\ndata: first\n\n")
+			return
+		}
+		fmt.Fprint(w, "id: 2\ndata: second\n\n")
+	}))
+	defer ts.Close()
+
+	client := sihttp.NewClient(ts.Client(), sihttp.WithBaseUrl(ts.URL))
+
+	var received []string
+	stop := errors.New("stop")
+	err := client.SubscribeSSE(context.Background(), "/events", nil, func(ev *sihttp.SSEEvent) error {
+		received = append(received, ev.Data)
+		if len(received) == 2 {
+			return stop
+		}
+		return nil
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, []string{"first", "second"}, received)
+	assert.Equal(t, []string{"", "1"}, lastEventIDs)
+}
+
+func TestClient_SubscribeSSE_notRetried(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Content-Encoding", sihttp.EncodingGzip)
+		w.Write(compressTestBody(t, sihttp.EncodingGzip, []byte("data: "+strings.Repeat("a", 2048)+"\n\n")))
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	handler := func(ev *sihttp.SSEEvent) error { return nil }
+
+	// failing to fetch a token is not a lost connection
+	errToken := errors.New("token endpoint is down")
+	tm := sihttp.NewTokenManager(tokenSourceFunc(func() (*oauth2.Token, error) {
+		return nil, errToken
+	}), 0)
+	client := sihttp.NewClient(ts.Client(), sihttp.WithBaseUrl(ts.URL), sihttp.WithTokenManager(tm))
+	assert.ErrorIs(t, client.SubscribeSSE(ctx, "/events", nil, handler), errToken)
+
+	client = sihttp.NewClient(ts.Client(), sihttp.WithBaseUrl(ts.URL), sihttp.WithDecompression(1024))
+	assert.ErrorIs(t, client.SubscribeSSE(ctx, "/events", nil, handler), sihttp.ErrDecompressedTooLarge)
+	assert.Nil(t, ctx.Err())
+}
+
+func TestClient_SubscribeSSE_withCache(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprint(w, "id: 1\ndata: first\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	client := sihttp.NewClient(ts.Client(), sihttp.WithBaseUrl(ts.URL), sihttp.WithCache(sihttp.NewCache(nil)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var received []string
+	stop := errors.New("stop")
+	err := client.SubscribeSSE(ctx, "/events", nil, func(ev *sihttp.SSEEvent) error {
+		received = append(received, ev.Data)
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, []string{"first"}, received)
+}
+
+func TestClient_GetNDJSON(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprint(w, "{\"id\":1,\"name\":\"a\"}\n\n{\"id\":2,\"name\":\"b\"}")
+	}))
+	defer ts.Close()
+
+	client := sihttp.NewClient(ts.Client(), sihttp.WithBaseUrl(ts.URL))
+	nr, err := client.GetNDJSON(context.Background(), "/items", nil, nil)
+	siutils.AssertNilFail(t, err)
+	defer nr.Close()
+
+	type item struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	var items []item
+	for {
+		var it item
+		err := nr.Next(&it)
+		if err == io.EOF {
+			break
+		}
+		siutils.AssertNilFail(t, err)
+		items = append(items, it)
+	}
+	assert.Equal(t, []item{{1, "a"}, {2, "b"}}, items)
+}
+
+func TestClient_Download_resume(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "data.txt", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	client := sihttp.NewClient(ts.Client(), sihttp.WithBaseUrl(ts.URL))
+
+	dst := bytes.NewBuffer(nil)
+	dst.Write(content[:8])
+
+	var lastTransferred, lastTotal int64
+	n, err := client.Download(context.Background(), "/data.txt", nil, dst, 8, func(transferred, total int64) {
+		lastTransferred, lastTotal = transferred, total
+	})
+	siutils.AssertNilFail(t, err)
+	assert.EqualValues(t, len(content)-8, n)
+	assert.Equal(t, content, dst.Bytes())
+	assert.EqualValues(t, len(content), lastTransferred)
+	assert.EqualValues(t, len(content), lastTotal)
+
+	// already completed
+	n, err = client.Download(context.Background(), "/data.txt", nil, dst, int64(len(content)), nil)
+	siutils.AssertNilFail(t, err)
+	assert.EqualValues(t, 0, n)
+}
+
+func TestClient_Download_ifRange(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "data.txt", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	client := sihttp.NewClient(ts.Client(), sihttp.WithBaseUrl(ts.URL))
+
+	dst := bytes.NewBuffer(nil)
+	dst.Write(content[:8])
+	n, err := client.Download(context.Background(), "/data.txt", http.Header{"If-Range": []string{`"v2"`}}, dst, 8, nil)
+	siutils.AssertNilFail(t, err)
+	assert.EqualValues(t, len(content)-8, n)
+	assert.Equal(t, content, dst.Bytes())
+
+	// the first part was downloaded from another version
+	dst.Reset()
+	dst.Write(content[:8])
+	n, err = client.Download(context.Background(), "/data.txt", http.Header{"If-Range": []string{`"v1"`}}, dst, 8, nil)
+	assert.ErrorIs(t, err, sihttp.ErrResourceChanged)
+	assert.EqualValues(t, 0, n)
+	assert.Equal(t, content[:8], dst.Bytes())
+}
+
+func TestClient_Download_rangeIgnored(t *testing.T) {
+	content := []byte("0123456789")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write(content)
+	}))
+	defer ts.Close()
+
+	client := sihttp.NewClient(ts.Client(), sihttp.WithBaseUrl(ts.URL))
+
+	dst := bytes.NewBuffer(nil)
+	n, err := client.Download(context.Background(), "/", nil, dst, 4, nil)
+	siutils.AssertNilFail(t, err)
+	assert.EqualValues(t, 6, n)
+	assert.Equal(t, "456789", dst.String())
+}
@@ -0,0 +1,132 @@
+package sihttp_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-wonk/si/v2/sihttp"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func slowTestServer(delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+			w.Write([]byte("ok"))
+		case <-r.Context().Done():
+		}
+	}))
+}
+
+func TestClient_requestTimeout(t *testing.T) {
+	ts := slowTestServer(time.Second)
+	defer ts.Close()
+
+	client := sihttp.NewClient(sihttp.DefaultStandardClient(nil), sihttp.WithBaseUrl(ts.URL))
+	start := time.Now()
+	_, err := client.Get("/", nil, nil, sihttp.WithRequestTimeout(50*time.Millisecond))
+	assert.True(t, errors.Is(err, sihttp.ErrTimeout))
+	assert.Less(t, time.Since(start), time.Second)
+
+	client = sihttp.NewClient(sihttp.DefaultStandardClient(nil), sihttp.WithBaseUrl(ts.URL),
+		sihttp.WithDefaultTimeout(50*time.Millisecond))
+	_, err = client.Get("/", nil, nil)
+	assert.True(t, errors.Is(err, sihttp.ErrTimeout))
+
+	// per-request timeout overrides the default
+	b, err := client.Get("/", nil, nil, sihttp.WithRequestTimeout(5*time.Second))
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "ok", string(b))
+}
+
+func TestClient_deadlinePropagation(t *testing.T) {
+	var remaining atomic.Int64
+	handler := sihttp.Deadline("", time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ms, _ := strconv.ParseInt(r.Header.Get(sihttp.DefaultDeadlineHeader), 10, 64)
+		remaining.Store(ms)
+		deadline, ok := r.Context().Deadline()
+		assert.True(t, ok)
+		assert.LessOrEqual(t, time.Until(deadline), time.Second)
+	}))
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	client := sihttp.NewClient(sihttp.DefaultStandardClient(nil), sihttp.WithBaseUrl(ts.URL),
+		sihttp.WithDeadlinePropagation(""))
+	_, err := client.Get("/", nil, nil, sihttp.WithRequestTimeout(3*time.Second))
+	siutils.AssertNilFail(t, err)
+	assert.Greater(t, remaining.Load(), int64(2000))
+	assert.LessOrEqual(t, remaining.Load(), int64(3000))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(sihttp.DefaultDeadlineHeader, "0")
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+}
+
+func TestClient_hedging(t *testing.T) {
+	var calls atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// disconnection of the client is noticed only after the body is read
+		io.Copy(io.Discard, r.Body)
+		if calls.Add(1) == 1 {
+			// the first attempt is stuck until it is canceled
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte("hedged"))
+	}))
+	defer ts.Close()
+
+	client := sihttp.NewClient(sihttp.DefaultStandardClient(nil), sihttp.WithBaseUrl(ts.URL),
+		sihttp.WithHedging(95, 20*time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	b, err := client.GetContext(ctx, "/", nil, nil)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "hedged", string(b))
+	assert.EqualValues(t, 2, calls.Load())
+
+	// POST is not hedged
+	calls.Store(0)
+	_, err = client.Post("/", nil, []byte("a"), sihttp.WithRequestTimeout(200*time.Millisecond))
+	assert.True(t, errors.Is(err, sihttp.ErrTimeout))
+	assert.EqualValues(t, 1, calls.Load())
+}
+
+func TestClient_hedgingDelayIsStable(t *testing.T) {
+	var calls atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// first attempts are slow and hedged attempts are fast
+		if calls.Add(1)%2 == 1 {
+			select {
+			case <-time.After(100 * time.Millisecond):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	client := sihttp.NewClient(sihttp.DefaultStandardClient(nil), sihttp.WithBaseUrl(ts.URL),
+		sihttp.WithHedging(95, 20*time.Millisecond))
+
+	// latencies of hedged responses are observed from the first attempt, so the delay does not shrink
+	for i := 0; i < 15; i++ {
+		start := time.Now()
+		_, err := client.Get("/", nil, nil)
+		siutils.AssertNilFail(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond, i)
+	}
+}
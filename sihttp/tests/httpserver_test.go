@@ -0,0 +1,279 @@
+package sihttp_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-wonk/si/v2/sihttp"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouter(t *testing.T) {
+	rt := sihttp.NewRouter()
+	rt.Get("/students/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("student " + sihttp.PathParam(r, "id")))
+	})
+	rt.Get("/students/me", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("me"))
+	})
+	rt.Post("/students", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	rt.Get("/files/*", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(sihttp.PathParam(r, "*")))
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{http.MethodGet, "/students/3", http.StatusOK, "student 3"},
+		{http.MethodGet, "/students/me", http.StatusOK, "me"},
+		{http.MethodPost, "/students", http.StatusCreated, ""},
+		{http.MethodGet, "/files/a/b.txt", http.StatusOK, "a/b.txt"},
+		{http.MethodDelete, "/students/3", http.StatusMethodNotAllowed, "Method Not Allowed\n"},
+		{http.MethodGet, "/teachers", http.StatusNotFound, "404 page not found\n"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		rt.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		assert.Equal(t, tt.status, w.Code, tt.path)
+		assert.Equal(t, tt.body, w.Body.String(), tt.path)
+	}
+
+	// methods of routes matching the path are listed once
+	rt.Put("/students/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	rt.Put("/students/me", func(w http.ResponseWriter, r *http.Request) {})
+	w := httptest.NewRecorder()
+	rt.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/students/me", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, PUT", w.Header().Get("Allow"))
+}
+
+func TestRouter_middlewaresBuiltOnce(t *testing.T) {
+	built := 0
+	rt := sihttp.NewRouter()
+	rt.Use(func(next http.Handler) http.Handler {
+		built++
+		return next
+	})
+	rt.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+	for i := 0; i < 3; i++ {
+		rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	assert.Equal(t, 1, built)
+}
+
+func TestMiddleware_recoveryAndRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	h := sihttp.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/panic" {
+			panic("boom")
+		}
+		w.Write([]byte(sihttp.RequestIDFromContext(r.Context())))
+	}), sihttp.Recovery(log.New(&logs, "", 0)), sihttp.RequestID(""), sihttp.AccessLog(log.New(&logs, "", 0)))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, logs.String(), "boom")
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(sihttp.DefaultRequestIDHeader, "abc")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, "abc", w.Body.String())
+	assert.Equal(t, "abc", w.Header().Get(sihttp.DefaultRequestIDHeader))
+	assert.Contains(t, logs.String(), "GET / HTTP/1.1 200 3")
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Len(t, w.Body.String(), 36)
+}
+
+func TestMiddleware_bodyLimit(t *testing.T) {
+	h := sihttp.BodyLimit(4)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("12345")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	r := httptest.NewRequest(http.MethodPost, "/", io.MultiReader(strings.NewReader("12345")))
+	r.ContentLength = -1
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("1234")))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestMiddleware_gzip(t *testing.T) {
+	body := strings.Repeat("hello world ", 100)
+	h := sihttp.Gzip(gzip.BestSpeed)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip, deflate")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+
+	gr, err := gzip.NewReader(w.Body)
+	siutils.AssertNilFail(t, err)
+	b, err := io.ReadAll(gr)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, body, string(b))
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, body, w.Body.String())
+}
+
+func TestMiddleware_gzipEarlyHints(t *testing.T) {
+	body := strings.Repeat("hello world ", 100)
+	ts := httptest.NewServer(sihttp.Gzip(gzip.BestSpeed)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(body))
+	})))
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL)
+	siutils.AssertNilFail(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	// decompressed by the transport
+	assert.True(t, resp.Uncompressed)
+	b, err := io.ReadAll(resp.Body)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, body, string(b))
+}
+
+func TestMiddleware_timeout(t *testing.T) {
+	h := sihttp.Timeout(20 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	// the Accept header of a client does not bypass the timeout
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", "text/event-stream")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	// routes excepted are not timed out and event streams are flushed as they are written
+	var flusher bool
+	h = sihttp.Timeout(20*time.Millisecond, "/events/*")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, flusher = w.(http.Flusher)
+		time.Sleep(40 * time.Millisecond)
+		w.Write([]byte("data: a\n\n"))
+	}))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events/orders", nil))
+	assert.True(t, flusher)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "data: a\n\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestServer_shutdownDrainsInFlight(t *testing.T) {
+	started := make(chan struct{})
+	hs, err := sihttp.NewServerWith(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	}), "", sihttp.WithDrainDelay(50*time.Millisecond), sihttp.WithShutdownTimeout(time.Second))
+	siutils.AssertNilFail(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	siutils.AssertNilFail(t, err)
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- hs.Serve(ln) }()
+
+	respCh := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String())
+		if err != nil {
+			respCh <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		respCh <- string(b)
+	}()
+
+	<-started
+	assert.True(t, hs.IsReady())
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- hs.Stop() }()
+	time.Sleep(10 * time.Millisecond)
+	assert.False(t, hs.IsReady())
+
+	assert.Equal(t, "done", <-respCh)
+	assert.Nil(t, <-stopped)
+	assert.ErrorIs(t, <-serveErr, http.ErrServerClosed)
+}
+
+func TestServer_shutdownDeadline(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	hs, err := sihttp.NewServerWith(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}), "")
+	siutils.AssertNilFail(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	siutils.AssertNilFail(t, err)
+	go hs.Serve(ln)
+	go http.Get("http://" + ln.Addr().String())
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, hs.Shutdown(ctx), context.DeadlineExceeded)
+}
+
+func TestServer_run(t *testing.T) {
+	hs, err := sihttp.NewServerWith(http.NotFoundHandler(), "127.0.0.1:0",
+		sihttp.WithMiddleware(sihttp.Recovery(nil)), sihttp.WithShutdownTimeout(time.Second))
+	siutils.AssertNilFail(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- hs.Run(ctx) }()
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, hs.IsReady())
+	cancel()
+	assert.Nil(t, <-done)
+}
@@ -0,0 +1,257 @@
+package sihttp_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-wonk/si/v2/sihttp"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert, isCA bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	siutils.AssertNilFail(t, err)
+
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{cn},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+	}
+
+	parentCert, parentKey := tmpl, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parentCert, &key.PublicKey, parentKey)
+	siutils.AssertNilFail(t, err)
+	cert, err := x509.ParseCertificate(der)
+	siutils.AssertNilFail(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	siutils.AssertNilFail(t, err)
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	}
+}
+
+func (c *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair(c.certPEM, c.keyPEM)
+	siutils.AssertNilFail(t, err)
+	return cert
+}
+
+func (c *testCert) writeFiles(t *testing.T, dir string, modTime time.Time) (string, string) {
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	siutils.AssertNilFail(t, os.WriteFile(certFile, c.certPEM, 0600))
+	siutils.AssertNilFail(t, os.WriteFile(keyFile, c.keyPEM, 0600))
+	siutils.AssertNilFail(t, os.Chtimes(certFile, modTime, modTime))
+	siutils.AssertNilFail(t, os.Chtimes(keyFile, modTime, modTime))
+	return certFile, keyFile
+}
+
+func serveTest(t *testing.T, handler http.Handler, opts ...sihttp.ServerOption) (*sihttp.Server, string) {
+	hs, err := sihttp.NewServerWith(handler, "", opts...)
+	siutils.AssertNilFail(t, err)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	siutils.AssertNilFail(t, err)
+	go hs.Serve(ln)
+	t.Cleanup(func() { hs.Stop() })
+	return hs, ln.Addr().String()
+}
+
+var protoHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte(r.Proto))
+})
+
+func getBody(t *testing.T, client *http.Client, url string) (string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	return string(b), err
+}
+
+func TestServer_http2(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, true)
+	server := newTestCert(t, "127.0.0.1", ca, false)
+	certFile, keyFile := server.writeFiles(t, t.TempDir(), time.Now())
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: pool},
+		ForceAttemptHTTP2: true,
+	}}
+
+	_, addr := serveTest(t, protoHandler, sihttp.WithCertFiles(certFile, keyFile), sihttp.WithHTTP2())
+	proto, err := getBody(t, client, "https://"+addr)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "HTTP/2.0", proto)
+
+	// HTTP/2 is disabled by default
+	_, addr = serveTest(t, protoHandler, sihttp.WithCertFiles(certFile, keyFile))
+	proto, err = getBody(t, client, "https://"+addr)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "HTTP/1.1", proto)
+}
+
+func TestServer_h2c(t *testing.T) {
+	_, addr := serveTest(t, protoHandler, sihttp.WithH2C())
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	proto, err := getBody(t, client, "http://"+addr)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "HTTP/2.0", proto)
+
+	proto, err = getBody(t, http.DefaultClient, "http://"+addr)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "HTTP/1.1", proto)
+}
+
+func TestServer_mutualTLS(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, true)
+	server := newTestCert(t, "127.0.0.1", ca, false)
+	certFile, keyFile := server.writeFiles(t, t.TempDir(), time.Now())
+	reloader, err := sihttp.NewCertReloader(certFile, keyFile, 0)
+	siutils.AssertNilFail(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	_, addr := serveTest(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := sihttp.ClientIdentity(r)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(id.CommonName))
+	}), sihttp.WithCertReloader(reloader), sihttp.WithMutualTLS(pool, func(cert *x509.Certificate) error {
+		if cert.Subject.CommonName == "blocked" {
+			return errors.New("blocked client")
+		}
+		return nil
+	}))
+
+	newClient := func(cert *testCert) *http.Client {
+		conf := &tls.Config{RootCAs: pool}
+		if cert != nil {
+			conf.Certificates = []tls.Certificate{cert.tlsCertificate(t)}
+		}
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: conf}}
+	}
+
+	body, err := getBody(t, newClient(newTestCert(t, "student-service", ca, false)), "https://"+addr)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "student-service", body)
+
+	_, err = getBody(t, newClient(nil), "https://"+addr)
+	assert.NotNil(t, err)
+	_, err = getBody(t, newClient(newTestCert(t, "blocked", ca, false)), "https://"+addr)
+	assert.NotNil(t, err)
+	_, err = getBody(t, newClient(newTestCert(t, "stranger", nil, false)), "https://"+addr)
+	assert.NotNil(t, err)
+}
+
+func TestServer_mutualTLSResumedSession(t *testing.T) {
+	ca := newTestCert(t, "ca", nil, true)
+	server := newTestCert(t, "127.0.0.1", ca, false)
+	certFile, keyFile := server.writeFiles(t, t.TempDir(), time.Now())
+	reloader, err := sihttp.NewCertReloader(certFile, keyFile, 0)
+	siutils.AssertNilFail(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	var blocked atomic.Bool
+	_, addr := serveTest(t, protoHandler, sihttp.WithCertReloader(reloader), sihttp.WithMutualTLS(pool, func(cert *x509.Certificate) error {
+		if blocked.Load() {
+			return errors.New("blocked client")
+		}
+		return nil
+	}))
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{
+			RootCAs:            pool,
+			Certificates:       []tls.Certificate{newTestCert(t, "student-service", ca, false).tlsCertificate(t)},
+			ClientSessionCache: tls.NewLRUClientSessionCache(1),
+		},
+		DisableKeepAlives: true,
+	}}
+	_, err = getBody(t, client, "https://"+addr)
+	siutils.AssertNilFail(t, err)
+
+	// a resumed session is verified again
+	blocked.Store(true)
+	_, err = getBody(t, client, "https://"+addr)
+	assert.NotNil(t, err)
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	first := newTestCert(t, "first", nil, false)
+	certFile, keyFile := first.writeFiles(t, dir, time.Now().Add(-time.Minute))
+
+	r, err := sihttp.NewCertReloader(certFile, keyFile, time.Millisecond)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, first.certPEM, pemOf(r.Certificate()))
+
+	second := newTestCert(t, "second", nil, false)
+	second.writeFiles(t, dir, time.Now())
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, second.certPEM, pemOf(r.Certificate()))
+
+	// broken files keep the current certificate
+	siutils.AssertNilFail(t, os.WriteFile(keyFile, []byte("broken"), 0600))
+	siutils.AssertNilFail(t, os.Chtimes(keyFile, time.Now().Add(time.Minute), time.Now().Add(time.Minute)))
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, second.certPEM, pemOf(r.Certificate()))
+}
+
+func pemOf(cert *tls.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+}
@@ -0,0 +1,147 @@
+package sihttp_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-wonk/si/v2/sihttp"
+	"github.com/go-wonk/si/v2/sihttp/sihttptest"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+)
+
+var discardLogger = log.New(io.Discard, "", 0)
+
+func proxyGet(t *testing.T, h http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestProxy_roundRobinAndRewrite(t *testing.T) {
+	var hits [2]int64
+	newUpstream := func(i int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt64(&hits[i], 1)
+			w.Header().Set("Server", "upstream")
+			w.Header().Set("X-Path", r.URL.Path)
+			w.Header().Set("X-Gateway", r.Header.Get("X-Gateway"))
+			w.Header().Set("X-Cookie", r.Header.Get("Cookie"))
+			w.Header().Set("X-Forwarded", r.Header.Get("X-Forwarded-For"))
+		}))
+	}
+	u0, u1 := newUpstream(0), newUpstream(1)
+	defer u0.Close()
+	defer u1.Close()
+
+	p, err := sihttp.NewProxy([]string{u0.URL, u1.URL + "/v1"},
+		sihttp.WithStripPrefix("/api"),
+		sihttp.WithProxyRequestHeader("X-Gateway", "si"),
+		sihttp.WithProxyRemoveRequestHeader("Cookie"),
+		sihttp.WithProxyRemoveResponseHeader("Server"),
+		sihttp.WithProxyResponseHeader("X-Proxy", "si"))
+	siutils.AssertNilFail(t, err)
+
+	paths := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/api/students", nil)
+		r.Header.Set("Cookie", "session=1")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Server"))
+		assert.Equal(t, "si", w.Header().Get("X-Proxy"))
+		assert.Equal(t, "si", w.Header().Get("X-Gateway"))
+		assert.Empty(t, w.Header().Get("X-Cookie"))
+		assert.NotEmpty(t, w.Header().Get("X-Forwarded"))
+		paths[w.Header().Get("X-Path")] = true
+	}
+	assert.EqualValues(t, 2, atomic.LoadInt64(&hits[0]))
+	assert.EqualValues(t, 2, atomic.LoadInt64(&hits[1]))
+	assert.Equal(t, map[string]bool{"/students": true, "/v1/students": true}, paths)
+}
+
+func TestProxy_retriesIdempotent(t *testing.T) {
+	bad := sihttptest.NewServer()
+	defer bad.Close()
+	bad.On("", "*").Reply(http.StatusServiceUnavailable, nil)
+	good := sihttptest.NewServer()
+	defer good.Close()
+	good.On("", "*").Reply(http.StatusOK, []byte("ok"))
+
+	p, err := sihttp.NewProxy([]string{bad.URL, good.URL}, sihttp.WithProxyRetries(1), sihttp.WithProxyLogger(discardLogger))
+	siutils.AssertNilFail(t, err)
+
+	for i := 0; i < 4; i++ {
+		w := proxyGet(t, p, "/")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "ok", w.Body.String())
+	}
+
+	// requests with body are not retried
+	failed := 0
+	for i := 0; i < 4; i++ {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("body")))
+		if w.Code == http.StatusServiceUnavailable {
+			failed++
+		}
+	}
+	assert.Equal(t, 2, failed)
+}
+
+func TestProxy_timeout(t *testing.T) {
+	slow := sihttptest.NewServer()
+	defer slow.Close()
+	slow.On(http.MethodGet, "/").WithLatency(time.Second)
+
+	p, err := sihttp.NewProxy([]string{slow.URL}, sihttp.WithProxyTimeout(50*time.Millisecond),
+		sihttp.WithProxyLogger(discardLogger))
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, http.StatusGatewayTimeout, proxyGet(t, p, "/").Code)
+}
+
+func TestProxy_healthCheck(t *testing.T) {
+	var healthy atomic.Bool
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" && !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("flaky"))
+	}))
+	defer flaky.Close()
+
+	p, err := sihttp.NewProxy([]string{flaky.URL},
+		sihttp.WithLoadBalancer(sihttp.LeastConn()),
+		sihttp.WithProxyHealthCheck("/healthz", 10*time.Millisecond, time.Second),
+		sihttp.WithProxyLogger(discardLogger))
+	siutils.AssertNilFail(t, err)
+	defer p.Close()
+
+	assert.Eventually(t, func() bool { return !p.Upstreams()[0].IsHealthy() }, time.Second, 5*time.Millisecond)
+	assert.ErrorIs(t, p.HealthCheck(context.Background()), sihttp.ErrNoHealthyUpstream)
+	assert.Equal(t, http.StatusServiceUnavailable, proxyGet(t, p, "/").Code)
+
+	healthy.Store(true)
+	assert.Eventually(t, func() bool { return p.Upstreams()[0].IsHealthy() }, time.Second, 5*time.Millisecond)
+	w := proxyGet(t, p, "/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "flaky", w.Body.String())
+	assert.EqualValues(t, 0, p.Upstreams()[0].InFlight())
+}
+
+func TestProxy_invalidHealthCheck(t *testing.T) {
+	for _, d := range [][2]time.Duration{{0, time.Second}, {time.Second, 0}, {-time.Second, time.Second}} {
+		p, err := sihttp.NewProxy([]string{"http://127.0.0.1:8080"}, sihttp.WithProxyHealthCheck("/healthz", d[0], d[1]))
+		assert.NotNil(t, err)
+		assert.Nil(t, p)
+	}
+}
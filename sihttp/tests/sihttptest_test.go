@@ -0,0 +1,132 @@
+package sihttp_test
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-wonk/si/v2/sihttp"
+	"github.com/go-wonk/si/v2/sihttp/sihttptest"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeT struct {
+	errors []string
+}
+
+func (t *fakeT) Helper() {}
+func (t *fakeT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, format)
+}
+
+func TestMockServer(t *testing.T) {
+	ms := sihttptest.NewServer()
+	defer ms.Close()
+
+	ms.On(http.MethodGet, "/students/1").Times(1).Reply(http.StatusServiceUnavailable, nil)
+	ms.On(http.MethodGet, "/students/1").ReplyJSON(http.StatusOK, map[string]string{"name": "wonk"}).Expect(1)
+	ms.On(http.MethodPost, "/students").MatchHeader("X-Tenant", "school").
+		ReplyHeader("Location", "/students/2").Reply(http.StatusCreated, nil).Expect(1)
+	ms.On(http.MethodGet, "/slow").WithLatency(time.Second)
+	ms.On(http.MethodGet, "/reset").ResetConnection()
+
+	client := sihttp.NewClient(ms.Client(), sihttp.WithBaseUrl(ms.URL))
+
+	_, err := client.Get("/students/1", nil, nil)
+	assert.ErrorIs(t, err, sihttp.ErrServerStatus)
+	b, err := client.Get("/students/1", nil, nil)
+	siutils.AssertNilFail(t, err)
+	assert.JSONEq(t, `{"name":"wonk"}`, string(b))
+
+	_, err = client.Post("/students", http.Header{"X-Tenant": []string{"school"}}, []byte(`{"name":"new"}`))
+	siutils.AssertNilFail(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.GetContext(ctx, "/slow", nil, nil)
+	assert.ErrorIs(t, err, sihttp.ErrTimeout)
+
+	_, err = client.Get("/reset", nil, nil)
+	assert.ErrorIs(t, err, sihttp.ErrTransport)
+
+	reqs := ms.Requests()
+	assert.Equal(t, `{"name":"new"}`, string(reqs[2].Body))
+	assert.True(t, ms.AssertExpectations(t))
+
+	_, err = client.Get("/unknown", nil, nil)
+	assert.ErrorIs(t, err, sihttp.ErrClientStatus)
+	ft := &fakeT{}
+	assert.False(t, ms.AssertExpectations(ft))
+	assert.Len(t, ft.errors, 1)
+}
+
+func TestMockServer_changeRouteWhileServing(t *testing.T) {
+	server := sihttptest.NewServer()
+	defer server.Close()
+	rt := server.On(http.MethodGet, "/status").Reply(http.StatusOK, []byte("starting"))
+	client := sihttp.NewClient(server.Client(), sihttp.WithBaseUrl(server.URL))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			rt.ReplyHeader("X-Attempt", "1").Reply(http.StatusOK, []byte("ready"))
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		_, err := client.Get("/status", nil, nil)
+		siutils.AssertNilFail(t, err)
+	}
+	<-done
+
+	b, err := client.Get("/status", nil, nil)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "ready", string(b))
+}
+
+func TestRecorder(t *testing.T) {
+	ms := sihttptest.NewServer()
+	ms.On(http.MethodPost, "/echo").ReplyFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=secret")
+		b := make([]byte, r.ContentLength)
+		r.Body.Read(b)
+		w.Write(b)
+	})
+	ms.On(http.MethodGet, "/binary").Reply(http.StatusOK, []byte{0xff, 0x00, 0xfe})
+
+	golden := filepath.Join(t.TempDir(), "golden", "echo.json")
+
+	rec, err := sihttptest.NewRecorder(golden, sihttptest.ModeRecord)
+	siutils.AssertNilFail(t, err)
+	client := sihttp.NewClient(rec.Client(), sihttp.WithBaseUrl(ms.URL))
+	b, err := client.Post("/echo", http.Header{"Authorization": []string{"Bearer token"}}, []byte("hello"))
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "hello", string(b))
+	_, err = client.Get("/binary", nil, nil)
+	siutils.AssertNilFail(t, err)
+	siutils.AssertNilFail(t, rec.Save())
+	ms.Close()
+
+	rep, err := sihttptest.NewRecorder(golden, sihttptest.ModeReplay)
+	siutils.AssertNilFail(t, err)
+	its := rep.Interactions()
+	assert.Equal(t, "REDACTED", its[0].Request.Header.Get("Authorization"))
+	assert.Equal(t, "REDACTED", its[0].Response.Header.Get("Set-Cookie"))
+	assert.Equal(t, "base64", its[1].Response.Body.Encoding)
+
+	client = sihttp.NewClient(rep.Client(), sihttp.WithBaseUrl(ms.URL))
+	b, err = client.Get("/binary", nil, nil)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, []byte{0xff, 0x00, 0xfe}, b)
+	assert.Len(t, rep.Unused(), 1)
+
+	_, err = client.Post("/echo", nil, []byte("other"))
+	assert.ErrorIs(t, err, sihttptest.ErrInteractionNotFound)
+	b, err = client.Post("/echo", nil, []byte("hello"))
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "hello", string(b))
+	assert.Empty(t, rep.Unused())
+}
@@ -0,0 +1,303 @@
+package sikafka
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+var ErrGroupNotEmpty = errors.New("sikafka: consumer group has active members")
+
+// TopicSpec is the desired state of a topic. Configs are topic configs, eg. `retention.ms`.
+type TopicSpec struct {
+	Name              string
+	Partitions        int32
+	ReplicationFactor int16
+	Configs           map[string]string
+}
+
+// GroupMember is a member of a consumer group with its assigned partitions.
+type GroupMember struct {
+	MemberID    string
+	ClientID    string
+	ClientHost  string
+	Assignments map[string][]int32
+}
+
+// GroupDescription describes a consumer group.
+type GroupDescription struct {
+	GroupID      string
+	State        string
+	ProtocolType string
+	Protocol     string
+	Members      []GroupMember
+}
+
+// PartitionLag is the lag of a consumer group in a partition. Committed is -1 if the group has not committed any
+// offset of the partition, and Lag is counted from the oldest offset then.
+type PartitionLag struct {
+	Committed     int64
+	HighWaterMark int64
+	Lag           int64
+}
+
+// Admin manages topics and consumer groups with sarama.ClusterAdmin and sarama.Client.
+type Admin struct {
+	admin  sarama.ClusterAdmin
+	client sarama.Client
+}
+
+// NewAdmin returns Admin over admin and client, which should be connected to the same cluster.
+func NewAdmin(admin sarama.ClusterAdmin, client sarama.Client) *Admin {
+	return &Admin{admin, client}
+}
+
+// DefaultAdmin returns Admin connected to brokers.
+func DefaultAdmin(brokers []string, version string) (*Admin, error) {
+	parsedVersion, err := sarama.ParseKafkaVersion(version)
+	if err != nil {
+		return nil, errors.New("sikafka: cannot parse kafka version: " + err.Error())
+	}
+	config := sarama.NewConfig()
+	config.Version = parsedVersion
+
+	client, err := sarama.NewClient(brokers, config)
+	if err != nil {
+		return nil, errors.New("sikafka: failed to create client: " + err.Error())
+	}
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, errors.New("sikafka: failed to create cluster admin: " + err.Error())
+	}
+	return NewAdmin(admin, client), nil
+}
+
+// Close closes the cluster admin, which also closes the client if the admin was created from it.
+func (a *Admin) Close() error {
+	return a.admin.Close()
+}
+
+// EnsureTopics creates topics of specs that do not exist, adds partitions to topics with less partitions than
+// specified and sets configs that differ. Partitions are never removed and the replication factor of existing
+// topics is not changed.
+func (a *Admin) EnsureTopics(specs ...TopicSpec) error {
+	topics, err := a.admin.ListTopics()
+	if err != nil {
+		return err
+	}
+
+	for _, spec := range specs {
+		detail, ok := topics[spec.Name]
+		if !ok {
+			if err := a.admin.CreateTopic(spec.Name, topicDetail(spec), false); err != nil && !errors.Is(err, sarama.ErrTopicAlreadyExists) {
+				return fmt.Errorf("sikafka: failed to create topic %s: %w", spec.Name, err)
+			}
+			continue
+		}
+
+		if spec.Partitions > detail.NumPartitions {
+			if err := a.admin.CreatePartitions(spec.Name, spec.Partitions, nil, false); err != nil {
+				return fmt.Errorf("sikafka: failed to create partitions of topic %s: %w", spec.Name, err)
+			}
+		}
+
+		entries := make(map[string]sarama.IncrementalAlterConfigsEntry)
+		for k, v := range spec.Configs {
+			if cur, ok := detail.ConfigEntries[k]; ok && cur != nil && *cur == v {
+				continue
+			}
+			v := v
+			entries[k] = sarama.IncrementalAlterConfigsEntry{Operation: sarama.IncrementalAlterConfigsOperationSet, Value: &v}
+		}
+		if len(entries) > 0 {
+			if err := a.admin.IncrementalAlterConfig(sarama.TopicResource, spec.Name, entries, false); err != nil {
+				return fmt.Errorf("sikafka: failed to alter configs of topic %s: %w", spec.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func topicDetail(spec TopicSpec) *sarama.TopicDetail {
+	detail := &sarama.TopicDetail{
+		NumPartitions:     spec.Partitions,
+		ReplicationFactor: spec.ReplicationFactor,
+		ConfigEntries:     make(map[string]*string, len(spec.Configs)),
+	}
+	if detail.NumPartitions == 0 {
+		detail.NumPartitions = -1
+	}
+	if detail.ReplicationFactor == 0 {
+		detail.ReplicationFactor = -1
+	}
+	for k, v := range spec.Configs {
+		v := v
+		detail.ConfigEntries[k] = &v
+	}
+	return detail
+}
+
+// DescribeGroup describes group with the partitions assigned to its members.
+func (a *Admin) DescribeGroup(group string) (*GroupDescription, error) {
+	descs, err := a.admin.DescribeConsumerGroups([]string{group})
+	if err != nil {
+		return nil, err
+	}
+	if len(descs) == 0 {
+		return nil, fmt.Errorf("sikafka: consumer group %s is not described", group)
+	}
+	d := descs[0]
+	if d.Err != sarama.ErrNoError {
+		return nil, d.Err
+	}
+
+	res := &GroupDescription{
+		GroupID:      d.GroupId,
+		State:        d.State,
+		ProtocolType: d.ProtocolType,
+		Protocol:     d.Protocol,
+	}
+	for _, m := range d.Members {
+		member := GroupMember{MemberID: m.MemberId, ClientID: m.ClientId, ClientHost: m.ClientHost}
+		if len(m.MemberAssignment) > 0 {
+			assignment, err := m.GetMemberAssignment()
+			if err != nil {
+				return nil, err
+			}
+			member.Assignments = assignment.Topics
+		}
+		res.Members = append(res.Members, member)
+	}
+	sort.Slice(res.Members, func(i, j int) bool { return res.Members[i].MemberID < res.Members[j].MemberID })
+	return res, nil
+}
+
+// GroupLag returns the lag of group in all partitions of topics, or in partitions with committed offsets if no topic
+// is given.
+func (a *Admin) GroupLag(group string, topics ...string) (map[string]map[int32]PartitionLag, error) {
+	var partitions map[string][]int32
+	if len(topics) > 0 {
+		var err error
+		if partitions, err = a.partitions(topics); err != nil {
+			return nil, err
+		}
+	}
+	offsets, err := a.admin.ListConsumerGroupOffsets(group, partitions)
+	if err != nil {
+		return nil, err
+	}
+	if offsets.Err != sarama.ErrNoError {
+		return nil, offsets.Err
+	}
+
+	res := make(map[string]map[int32]PartitionLag)
+	for topic, blocks := range offsets.Blocks {
+		for p, block := range blocks {
+			if block.Err != sarama.ErrNoError {
+				return nil, fmt.Errorf("sikafka: failed to fetch offset of %s/%d: %w", topic, p, block.Err)
+			}
+			hwm, err := a.client.GetOffset(topic, p, sarama.OffsetNewest)
+			if err != nil {
+				return nil, err
+			}
+			lag := PartitionLag{Committed: block.Offset, HighWaterMark: hwm}
+			if block.Offset >= 0 {
+				lag.Lag = hwm - block.Offset
+			} else {
+				oldest, err := a.client.GetOffset(topic, p, sarama.OffsetOldest)
+				if err != nil {
+					return nil, err
+				}
+				lag.Committed = -1
+				lag.Lag = hwm - oldest
+			}
+			if res[topic] == nil {
+				res[topic] = make(map[int32]PartitionLag)
+			}
+			res[topic][p] = lag
+		}
+	}
+	return res, nil
+}
+
+// ResetGroupOffsets commits offsets of group in all partitions of topics to offset, which is sarama.OffsetOldest,
+// sarama.OffsetNewest or a timestamp in milliseconds as in sarama.Client.GetOffset. For a timestamp, it is reset to
+// the first offset of messages at or after the timestamp, or to the newest offset if there is none. The group must
+// have no active members. It returns the committed offsets.
+func (a *Admin) ResetGroupOffsets(group string, topics []string, offset int64) (map[string]map[int32]int64, error) {
+	desc, err := a.DescribeGroup(group)
+	if err != nil {
+		return nil, err
+	}
+	if desc.State != "Empty" && desc.State != "Dead" {
+		return nil, fmt.Errorf("%w: %s is %s", ErrGroupNotEmpty, group, desc.State)
+	}
+
+	partitions, err := a.partitions(topics)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &sarama.OffsetCommitRequest{
+		Version:                 2,
+		ConsumerGroup:           group,
+		ConsumerGroupGeneration: sarama.GroupGenerationUndefined,
+		RetentionTime:           -1,
+	}
+	res := make(map[string]map[int32]int64)
+	for topic, ps := range partitions {
+		res[topic] = make(map[int32]int64)
+		for _, p := range ps {
+			o, err := a.client.GetOffset(topic, p, offset)
+			if err != nil {
+				return nil, err
+			}
+			if o < 0 {
+				if o, err = a.client.GetOffset(topic, p, sarama.OffsetNewest); err != nil {
+					return nil, err
+				}
+			}
+			req.AddBlock(topic, p, o, 0, "")
+			res[topic][p] = o
+		}
+	}
+
+	coordinator, err := a.client.Coordinator(group)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := coordinator.CommitOffset(req)
+	if err != nil {
+		return nil, err
+	}
+	for topic, errs := range resp.Errors {
+		for p, kerr := range errs {
+			if kerr != sarama.ErrNoError {
+				return nil, fmt.Errorf("sikafka: failed to commit offset of %s/%d: %w", topic, p, kerr)
+			}
+		}
+	}
+	return res, nil
+}
+
+// ResetGroupOffsetsToTime resets offsets of group in topics to the first messages at or after t, see
+// ResetGroupOffsets.
+func (a *Admin) ResetGroupOffsetsToTime(group string, topics []string, t time.Time) (map[string]map[int32]int64, error) {
+	return a.ResetGroupOffsets(group, topics, t.UnixMilli())
+}
+
+func (a *Admin) partitions(topics []string) (map[string][]int32, error) {
+	res := make(map[string][]int32, len(topics))
+	for _, t := range topics {
+		ps, err := a.client.Partitions(t)
+		if err != nil {
+			return nil, err
+		}
+		res[t] = ps
+	}
+	return res, nil
+}
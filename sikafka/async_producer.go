@@ -1,16 +1,30 @@
 package sikafka
 
 import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
 	"github.com/IBM/sarama"
 )
 
+// asyncErrorWindow is how long AsyncProducer reports a failed message, since it does not see successes following it.
+const asyncErrorWindow = 30 * time.Second
+
+// AsyncProducer sends messages without waiting for their delivery. Successes and Errors of the underlying producer
+// must be drained by the caller if they are enabled, except Errors of producers returned by RetryableAsyncProducer,
+// which are drained and logged. Use ManagedAsyncProducer to get delivery reports instead.
 type AsyncProducer struct {
 	sarama.AsyncProducer
 	topic string
+
+	wg     sync.WaitGroup
+	health producerHealth
 }
 
 func NewAsyncProducer(producer sarama.AsyncProducer, topic string) *AsyncProducer {
-	return &AsyncProducer{producer, topic}
+	return &AsyncProducer{AsyncProducer: producer, topic: topic}
 }
 
 func (ap *AsyncProducer) Produce(key []byte, value []byte) (partition int32, offset int64, err error) {
@@ -41,3 +55,36 @@ func (ap *AsyncProducer) ProduceWithMessage(msg *sarama.ProducerMessage) (partit
 
 	return 0, 0, nil
 }
+
+// drainErrors logs errors of the underlying producer until it is closed, so that it does not block on Errors.
+func (ap *AsyncProducer) drainErrors() {
+	ap.wg.Add(1)
+	go func() {
+		defer ap.wg.Done()
+		for perr := range ap.Errors() {
+			log.Println("sikafka: failed to produce message: " + perr.Error())
+			ap.health.report(perr.Err)
+		}
+	}()
+}
+
+// Close shuts down the producer and waits for buffered messages to be flushed and errors to be drained, see
+// sarama.AsyncProducer.
+func (ap *AsyncProducer) Close() error {
+	ap.health.close()
+	err := ap.AsyncProducer.Close()
+	ap.wg.Wait()
+	return err
+}
+
+// AsyncClose triggers a shutdown of the producer, see sarama.AsyncProducer.
+func (ap *AsyncProducer) AsyncClose() {
+	ap.health.close()
+	ap.AsyncProducer.AsyncClose()
+}
+
+// HealthCheck returns ErrProducerClosed if ap is closed, or the error of a message failed within the last 30 seconds
+// because brokers were unavailable. Errors are seen only if they are drained by ap, see RetryableAsyncProducer.
+func (ap *AsyncProducer) HealthCheck(ctx context.Context) error {
+	return ap.health.check(asyncErrorWindow)
+}
@@ -80,26 +80,67 @@ type ConsumerGroup struct {
 	consumer Consumer
 	topics   []string
 
-	isPaused bool
-	cancel   context.CancelFunc
+	retryMax        int
+	retryBackoff    time.Duration
+	retryMaxBackoff time.Duration
+
+	mu      sync.Mutex
+	running bool
+	cancel  context.CancelFunc
+	lastErr error
+
+	memberID     string
+	generationID int32
+	claims       map[string][]int32
+	partitions   map[topicPartition]*partitionState
+
+	isPaused     bool
+	pausedTopics map[string]bool
+	paused       map[topicPartition]bool
 }
 
 func NewConsumerGroup(cg sarama.ConsumerGroup, consumer Consumer, topics []string) *ConsumerGroup {
 	return &ConsumerGroup{
-		ConsumerGroup: cg,
-		consumer:      consumer,
-		topics:        topics,
-		isPaused:      false,
+		ConsumerGroup:   cg,
+		consumer:        consumer,
+		topics:          topics,
+		retryMax:        5,
+		retryBackoff:    3 * time.Second,
+		retryMaxBackoff: 3 * time.Second,
+		partitions:      make(map[topicPartition]*partitionState),
+		pausedTopics:    make(map[string]bool),
+		paused:          make(map[topicPartition]bool),
+		isPaused:        false,
 	}
 }
 
+// NewConsumerGroupWithOptions returns ConsumerGroup consuming topics with consumer and opts applied. It fails if an
+// option fails.
+func NewConsumerGroupWithOptions(cg sarama.ConsumerGroup, consumer Consumer, topics []string, opts ...ConsumerGroupOption) (*ConsumerGroup, error) {
+	c := NewConsumerGroup(cg, consumer, topics)
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if err := o.apply(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
 func (cg *ConsumerGroup) Toggle() {
 	cg.toggleConsumptionFlow()
 }
 
+// StartWith consumes until it is finished or the process receives SIGINT or SIGTERM, and toggles consumption on
+// SIGUSR1. loaded is sent after the consumer has been set up. Use Run to consume without handling signals.
 func (cg *ConsumerGroup) StartWith(loaded chan bool) error {
-	var consumerCtx context.Context
-	consumerCtx, cg.cancel = context.WithCancel(context.Background())
+	consumerCtx, err := cg.start(context.Background())
+	if err != nil {
+		return err
+	}
+	defer cg.stopped()
 
 	stopCh := make(chan bool)
 
@@ -108,47 +149,9 @@ func (cg *ConsumerGroup) StartWith(loaded chan bool) error {
 	wg.Add(1)
 	go func(wg *sync.WaitGroup) {
 		defer wg.Done()
-
-		attempts := 0
-		retryMax := 5
-		for {
-			attempts++
-
-			// `Consume` should be called inside an infinite loop, when a
-			// server-side rebalance happens, the consumer session will need to be
-			// recreated to get the new claims
-			log.Println("consumer group: trying to consume...")
-			if err := cg.Consume(consumerCtx, cg.topics, cg.consumer); err != nil {
-				if errors.Is(err, sarama.ErrClosedConsumerGroup) || attempts >= retryMax {
-					log.Println("consumer error: " + err.Error())
-					consumerErr = err
-					cg.cancel()
-					close(stopCh)
-					return
-				}
-				if consumerCtx.Err() != nil {
-					consumerErr = consumerCtx.Err()
-					cg.cancel()
-					close(stopCh)
-					return
-				}
-
-				log.Println("consumer error: retrying: " + err.Error())
-				time.Sleep(time.Second * 3)
-				continue
-				// log.Panicf("Error from consumer: %v\n", err)
-			}
-			// check if context was cancelled, signaling that the consumer should stop
-			if consumerCtx.Err() != nil {
-				consumerErr = consumerCtx.Err()
-				cg.cancel()
-				close(stopCh)
-				return
-			}
-
-			cg.consumer.MakeReady()
-			attempts = 0
-		}
+		consumerErr = cg.consume(consumerCtx)
+		cg.Finish()
+		close(stopCh)
 	}(&wg)
 
 	select {
@@ -160,9 +163,11 @@ func (cg *ConsumerGroup) StartWith(loaded chan bool) error {
 
 	sigusr1 := make(chan os.Signal, 1)
 	signal.Notify(sigusr1, syscall.SIGUSR1)
+	defer signal.Stop(sigusr1)
 
 	sigterm := make(chan os.Signal, 1)
 	signal.Notify(sigterm, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigterm)
 
 	keepRunning := true
 	for keepRunning {
@@ -177,7 +182,7 @@ func (cg *ConsumerGroup) StartWith(loaded chan bool) error {
 			cg.toggleConsumptionFlow()
 		}
 	}
-	cg.cancel()
+	cg.Finish()
 	wg.Wait()
 	if err := cg.Close(); err != nil {
 		log.Println("consumer error: failed to close client: " + err.Error())
@@ -196,10 +201,13 @@ func (cg *ConsumerGroup) Start() error {
 }
 
 func (cg *ConsumerGroup) Finish() error {
-	if cg.cancel == nil {
+	cg.mu.Lock()
+	cancel := cg.cancel
+	cg.mu.Unlock()
+	if cancel == nil {
 		return errors.New("ConsumerGroup has not been started")
 	}
-	cg.cancel()
+	cancel()
 	return nil
 }
 
@@ -208,21 +216,35 @@ func (cg *ConsumerGroup) Stop() error {
 }
 
 func (cg *ConsumerGroup) toggleConsumptionFlow() {
-	if cg.isPaused {
+	cg.mu.Lock()
+	isPaused := cg.isPaused
+	cg.mu.Unlock()
+
+	if isPaused {
 		cg.ResumeAll()
 		log.Println("Resuming consumption")
 	} else {
 		cg.PauseAll()
 		log.Println("Pausing consumption")
 	}
-
-	cg.isPaused = !cg.isPaused
 }
 
 // CgConsumer represents a Sarama consumer group consumer
 type CgConsumer struct {
 	ready      chan bool
 	msgHandler MessageHandler
+
+	retry           handlerRetry
+	failureProducer sarama.SyncProducer
+	retryDelays     []time.Duration
+	deadLetter      bool
+	deadLetterTopic string
+
+	concurrency concurrency
+
+	batchHandler BatchMessageHandler
+	batchSize    int
+	batchMaxWait time.Duration
 }
 
 func NewCgConsumer(msgHandler MessageHandler) *CgConsumer {
@@ -233,6 +255,22 @@ func NewCgConsumer(msgHandler MessageHandler) *CgConsumer {
 	return c
 }
 
+// NewCgConsumerWithOptions returns CgConsumer handling messages with msgHandler and opts applied. It fails if an
+// option fails.
+func NewCgConsumerWithOptions(msgHandler MessageHandler, opts ...CgConsumerOption) (*CgConsumer, error) {
+	c := NewCgConsumer(msgHandler)
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if err := o.apply(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
 // Setup is run at the beginning of a new session, before ConsumeClaim
 func (consumer *CgConsumer) Setup(sarama.ConsumerGroupSession) error {
 	// Mark the consumer as ready
@@ -251,6 +289,12 @@ func (consumer *CgConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, cl
 	// Do not move the code below to a goroutine.
 	// The `ConsumeClaim` itself is called within a goroutine, see:
 	// https://github.com/Shopify/sarama/blob/main/consumer_group.go#L27-L29
+	if consumer.batchHandler != nil {
+		return consumer.consumeClaimBatch(session, claim)
+	}
+	if consumer.concurrency.lanes > 1 {
+		return consumer.consumeClaimConcurrently(session, claim)
+	}
 	for {
 		select {
 		case message, ok := <-claim.Messages():
@@ -259,8 +303,11 @@ func (consumer *CgConsumer) ConsumeClaim(session sarama.ConsumerGroupSession, cl
 				return nil
 			}
 			// log.Printf("Message claimed: value = %s, timestamp = %v, topic = %s", string(message.Value), message.Timestamp, message.Topic)
-			if err := consumer.msgHandler.Handle(message); err == nil {
+			if err := consumer.handle(session.Context(), message); err == nil {
 				session.MarkMessage(message, "")
+			} else if errors.Is(err, ErrForwardFailed) {
+				// end the session, otherwise the offsets marked later would skip message
+				return err
 			}
 
 		// Should return when `session.Context()` is done.
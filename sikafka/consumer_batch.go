@@ -0,0 +1,202 @@
+package sikafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// BatchMessageHandler handles messages of a partition in batches.
+type BatchMessageHandler interface {
+	// HandleBatch handles msgs. It returns a *BatchError if some of msgs failed, and the others are regarded as
+	// handled.
+	HandleBatch(msgs []*sarama.ConsumerMessage) error
+}
+
+// MessageError is a message that failed in a batch.
+type MessageError struct {
+	Message *sarama.ConsumerMessage
+	Err     error
+}
+
+func (e *MessageError) Error() string {
+	return fmt.Sprintf("sikafka: message %s/%d/%d: %v", e.Message.Topic, e.Message.Partition, e.Message.Offset, e.Err)
+}
+
+func (e *MessageError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError reports messages that failed in a batch.
+type BatchError struct {
+	Errors []*MessageError
+}
+
+// Add adds msg failed with err.
+func (e *BatchError) Add(msg *sarama.ConsumerMessage, err error) {
+	e.Errors = append(e.Errors, &MessageError{msg, err})
+}
+
+// Err returns e if any message has failed, or nil.
+func (e *BatchError) Err() error {
+	if e == nil || len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *BatchError) Error() string {
+	if len(e.Errors) == 0 {
+		return "sikafka: batch failed"
+	}
+	return fmt.Sprintf("sikafka: %d messages of batch failed, first: %v", len(e.Errors), e.Errors[0])
+}
+
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i := range e.Errors {
+		errs[i] = e.Errors[i]
+	}
+	return errs
+}
+
+// NewBatchCgConsumer returns CgConsumer handling messages of a partition with handler in batches of up to size
+// messages, or of the messages received in maxWait since the first message of the batch if maxWait is positive. The
+// offsets of a batch are marked after handler succeeded.
+//
+// WithHandlerRetry retries the failed messages of a batch in a smaller batch, or the whole batch if handler did not
+// return a *BatchError. Messages failed at all attempts are forwarded to retry topics or the dead letter topic if
+// configured. Otherwise, or if forwarding failed, ConsumeClaim returns the error without marking the batch, which
+// ends the session so that the batch is consumed again. WithConcurrency has no effect.
+func NewBatchCgConsumer(handler BatchMessageHandler, size int, maxWait time.Duration, opts ...CgConsumerOption) (*CgConsumer, error) {
+	c, err := NewCgConsumerWithOptions(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if size < 1 {
+		size = 1
+	}
+	c.batchHandler = handler
+	c.batchSize = size
+	c.batchMaxWait = maxWait
+	return c, nil
+}
+
+func (c *CgConsumer) consumeClaimBatch(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	ctx := session.Context()
+
+	var batch []*sarama.ConsumerMessage
+	var timer *time.Timer
+	var timeout <-chan time.Time
+	// flush returns an error if the batch failed, to end the session, otherwise the offsets marked later would skip it
+	flush := func() error {
+		if timer != nil {
+			timer.Stop()
+			timer, timeout = nil, nil
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		last := batch[len(batch)-1]
+		err := c.handleBatch(ctx, batch)
+		batch = nil
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		session.MarkMessage(last, "")
+		return nil
+	}
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				log.Println("message channel was closed")
+				return flush()
+			}
+			if len(batch) == 0 && c.batchMaxWait > 0 {
+				timer = time.NewTimer(c.batchMaxWait)
+				timeout = timer.C
+			}
+			batch = append(batch, message)
+			if len(batch) >= c.batchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-timeout:
+			if err := flush(); err != nil {
+				return err
+			}
+
+		// the batch not handled yet is consumed again by the next session
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// handleBatch handles batch with retries and forwards failed messages. It returns nil if batch can be marked.
+func (c *CgConsumer) handleBatch(ctx context.Context, batch []*sarama.ConsumerMessage) error {
+	for _, msg := range batch {
+		if err := c.waitRetryDelay(ctx, msg); err != nil {
+			return err
+		}
+	}
+
+	attempts := c.retry.maxAttempts()
+	backoff := c.retry.backoff
+	pending := batch
+	var failed []*MessageError
+	var err error
+	for i := 1; i <= attempts; i++ {
+		if err = c.batchHandler.HandleBatch(pending); err == nil {
+			return nil
+		}
+
+		var batchErr *BatchError
+		if errors.As(err, &batchErr) {
+			failed = batchErr.Errors
+		} else {
+			failed = make([]*MessageError, len(pending))
+			for j, msg := range pending {
+				failed[j] = &MessageError{msg, err}
+			}
+		}
+		if i == attempts || len(failed) == 0 {
+			attempts = i
+			break
+		}
+		if serr := sleepContext(ctx, backoff); serr != nil {
+			return serr
+		}
+		backoff = c.retry.nextBackoff(backoff)
+
+		pending = make([]*sarama.ConsumerMessage, len(failed))
+		for j := range failed {
+			pending[j] = failed[j].Message
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	for _, me := range failed {
+		if ferr := c.forwardFailed(me.Message, attempts, me.Err); ferr != nil {
+			return ferr
+		}
+	}
+	return nil
+}
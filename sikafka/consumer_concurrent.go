@@ -0,0 +1,147 @@
+package sikafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+type concurrency struct {
+	lanes       int
+	maxInFlight int
+}
+
+// WithConcurrency handles messages of a partition concurrently in lanes goroutines while messages of the same key
+// are handled in order, in the same lane chosen by the hash of the key. Messages without a key are spread over lanes.
+// At most maxInFlight messages of a partition are handled or waiting for a lane at a time, and no more messages are
+// received until one of them is done.
+//
+// Offsets are marked only up to the lowest offset that has not been done yet, so messages after an unfinished one are
+// consumed again after a rebalance or a restart. As in sequential consumption, a message whose handler failed does
+// not hold back offsets of later messages, see WithRetryTopics and WithDeadLetterTopic to keep such messages.
+//
+// It fails if lanes is less than 1. maxInFlight less than lanes is raised to lanes.
+func WithConcurrency(lanes int, maxInFlight int) CgConsumerOptionFunc {
+	return CgConsumerOptionFunc(func(c *CgConsumer) error {
+		if lanes < 1 {
+			return fmt.Errorf("sikafka: concurrency lanes must be at least 1: %d", lanes)
+		}
+		if maxInFlight < lanes {
+			maxInFlight = lanes
+		}
+		c.concurrency = concurrency{lanes, maxInFlight}
+		return nil
+	})
+}
+
+func laneOf(msg *sarama.ConsumerMessage, lanes int) int {
+	if len(msg.Key) == 0 {
+		return int(msg.Offset % int64(lanes))
+	}
+	h := fnv.New32a()
+	h.Write(msg.Key)
+	return int(h.Sum32() % uint32(lanes))
+}
+
+// offsetTracker tracks offsets of a partition being handled to mark the lowest contiguous done offset.
+type offsetTracker struct {
+	mu      sync.Mutex
+	pending []int64 // offsets in the order received, not marked yet
+	done    map[int64]bool
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{done: make(map[int64]bool)}
+}
+
+func (t *offsetTracker) add(offset int64) {
+	t.mu.Lock()
+	t.pending = append(t.pending, offset)
+	t.mu.Unlock()
+}
+
+// complete sets offset done and calls mark with the next offset to consume if the lowest pending offsets are done.
+func (t *offsetTracker) complete(offset int64, mark func(next int64)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done[offset] = true
+	next := int64(-1)
+	for len(t.pending) > 0 && t.done[t.pending[0]] {
+		delete(t.done, t.pending[0])
+		next = t.pending[0] + 1
+		t.pending = t.pending[1:]
+	}
+	if next >= 0 {
+		mark(next)
+	}
+}
+
+func (c *CgConsumer) consumeClaimConcurrently(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) (err error) {
+	ctx, cancel := context.WithCancel(session.Context())
+	defer cancel()
+	tracker := newOffsetTracker()
+
+	// the first ErrForwardFailed, returned after lanes are done
+	var forwardErr error
+	var forwardErrOnce sync.Once
+	inFlight := make(chan struct{}, c.concurrency.maxInFlight)
+
+	var wg sync.WaitGroup
+	lanes := make([]chan *sarama.ConsumerMessage, c.concurrency.lanes)
+	for i := range lanes {
+		lanes[i] = make(chan *sarama.ConsumerMessage, c.concurrency.maxInFlight)
+		wg.Add(1)
+		go func(lane <-chan *sarama.ConsumerMessage) {
+			defer wg.Done()
+			for msg := range lane {
+				// messages left in lanes after the session ended are consumed again by the next session
+				if ctx.Err() == nil {
+					herr := c.handle(ctx, msg)
+					if errors.Is(herr, ErrForwardFailed) {
+						// msg is never completed, so the offsets after it are not marked
+						forwardErrOnce.Do(func() { forwardErr = herr })
+						cancel()
+					} else if ctx.Err() == nil {
+						tracker.complete(msg.Offset, func(next int64) {
+							session.MarkOffset(msg.Topic, msg.Partition, next, "")
+						})
+					}
+				}
+				<-inFlight
+			}
+		}(lanes[i])
+	}
+	defer func() {
+		for _, lane := range lanes {
+			close(lane)
+		}
+		wg.Wait()
+		err = forwardErr
+	}()
+
+	for {
+		select {
+		case inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				<-inFlight
+				return nil
+			}
+			tracker.add(message.Offset)
+			lanes[laneOf(message, len(lanes))] <- message
+		case <-ctx.Done():
+			<-inFlight
+			return nil
+		}
+	}
+}
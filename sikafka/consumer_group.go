@@ -0,0 +1,324 @@
+package sikafka
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+
+	"github.com/IBM/sarama"
+)
+
+var ErrConsumerGroupRunning = errors.New("sikafka: consumer group is already running")
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// partitionState is a claimed partition with the next offset to consume marked by the consumer.
+type partitionState struct {
+	claim  sarama.ConsumerGroupClaim
+	marked int64
+}
+
+// Run consumes until ctx is done or consuming has failed more than the retries set by WithConsumeRetry, and closes
+// the consumer group. Unlike Start, it does not handle signals of the process. It returns nil if ctx is done.
+func (cg *ConsumerGroup) Run(ctx context.Context) error {
+	ctx, err := cg.start(ctx)
+	if err != nil {
+		return err
+	}
+	defer cg.stopped()
+
+	err = cg.consume(ctx)
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		err = nil
+	}
+	if cerr := cg.Close(); cerr != nil && err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (cg *ConsumerGroup) start(ctx context.Context) (context.Context, error) {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	if cg.running {
+		return nil, ErrConsumerGroupRunning
+	}
+	ctx, cg.cancel = context.WithCancel(ctx)
+	cg.running = true
+	cg.lastErr = nil
+	return ctx, nil
+}
+
+func (cg *ConsumerGroup) stopped() {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	cg.cancel()
+	cg.running = false
+}
+
+// consume calls Consume in a loop, since the session has to be recreated to get new claims after a server-side
+// rebalance, and retries it on errors.
+func (cg *ConsumerGroup) consume(ctx context.Context) error {
+	handler := &groupHandler{cg}
+	attempts := 0
+	backoff := cg.retryBackoff
+	for {
+		attempts++
+
+		log.Println("consumer group: trying to consume...")
+		if err := cg.Consume(ctx, cg.topics, handler); err != nil {
+			cg.mu.Lock()
+			cg.lastErr = err
+			cg.mu.Unlock()
+
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) || (cg.retryMax > 0 && attempts >= cg.retryMax) {
+				log.Println("consumer error: " + err.Error())
+				return err
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			log.Println("consumer error: retrying: " + err.Error())
+			if sleepContext(ctx, backoff) != nil {
+				return ctx.Err()
+			}
+			backoff *= 2
+			if cg.retryMaxBackoff > 0 && backoff > cg.retryMaxBackoff {
+				backoff = cg.retryMaxBackoff
+			}
+			continue
+		}
+		// check if context was cancelled, signaling that the consumer should stop
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		cg.consumer.MakeReady()
+		attempts = 0
+		backoff = cg.retryBackoff
+	}
+}
+
+// Pause pauses fetching from partitions, which stay paused across rebalances until they are resumed.
+func (cg *ConsumerGroup) Pause(partitions map[string][]int32) {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	for topic, ps := range partitions {
+		for _, p := range ps {
+			cg.paused[topicPartition{topic, p}] = true
+		}
+	}
+	cg.ConsumerGroup.Pause(partitions)
+}
+
+// Resume resumes partitions paused by Pause.
+func (cg *ConsumerGroup) Resume(partitions map[string][]int32) {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	for topic, ps := range partitions {
+		for _, p := range ps {
+			delete(cg.paused, topicPartition{topic, p})
+		}
+	}
+	cg.ConsumerGroup.Resume(partitions)
+}
+
+// PauseTopics pauses fetching from all partitions of topics, including partitions assigned later.
+func (cg *ConsumerGroup) PauseTopics(topics ...string) {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	for _, t := range topics {
+		cg.pausedTopics[t] = true
+	}
+	if partitions := cg.claimedPartitions(topics); len(partitions) > 0 {
+		cg.ConsumerGroup.Pause(partitions)
+	}
+}
+
+// ResumeTopics resumes all partitions of topics paused by PauseTopics or Pause.
+func (cg *ConsumerGroup) ResumeTopics(topics ...string) {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	for _, t := range topics {
+		delete(cg.pausedTopics, t)
+		for tp := range cg.paused {
+			if tp.topic == t {
+				delete(cg.paused, tp)
+			}
+		}
+	}
+	if partitions := cg.claimedPartitions(topics); len(partitions) > 0 {
+		cg.ConsumerGroup.Resume(partitions)
+	}
+}
+
+// PauseAll pauses fetching from all partitions until ResumeAll is called.
+func (cg *ConsumerGroup) PauseAll() {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	cg.isPaused = true
+	cg.ConsumerGroup.PauseAll()
+}
+
+// ResumeAll resumes all partitions, including partitions paused by Pause and PauseTopics.
+func (cg *ConsumerGroup) ResumeAll() {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+	cg.isPaused = false
+	cg.pausedTopics = make(map[string]bool)
+	cg.paused = make(map[topicPartition]bool)
+	cg.ConsumerGroup.ResumeAll()
+}
+
+func (cg *ConsumerGroup) claimedPartitions(topics []string) map[string][]int32 {
+	res := make(map[string][]int32)
+	for _, t := range topics {
+		if ps, ok := cg.claims[t]; ok {
+			res[t] = ps
+		}
+	}
+	return res
+}
+
+func (cg *ConsumerGroup) isPartitionPaused(topic string, partition int32) bool {
+	return cg.isPaused || cg.pausedTopics[topic] || cg.paused[topicPartition{topic, partition}]
+}
+
+// ConsumerGroupHealth is the state of ConsumerGroup.
+type ConsumerGroupHealth struct {
+	Running      bool
+	MemberID     string
+	GenerationID int32
+	// Assignments are partitions of topics claimed in the current session.
+	Assignments map[string][]int32
+	// Paused are assigned partitions that are paused.
+	Paused map[string][]int32
+	// Lag is the number of messages not marked yet of assigned partitions, from the high water mark of the
+	// partition and the offset marked by the consumer or the initial offset of the session. Partitions with no valid
+	// offset yet are omitted.
+	Lag map[string]map[int32]int64
+	// Err is the last error of consuming, cleared when a new session is set up.
+	Err error
+}
+
+// TotalLag returns the sum of Lag.
+func (h ConsumerGroupHealth) TotalLag() int64 {
+	var total int64
+	for _, ps := range h.Lag {
+		for _, l := range ps {
+			total += l
+		}
+	}
+	return total
+}
+
+// Health returns the current state of cg.
+func (cg *ConsumerGroup) Health() ConsumerGroupHealth {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+
+	h := ConsumerGroupHealth{
+		Running:      cg.running,
+		MemberID:     cg.memberID,
+		GenerationID: cg.generationID,
+		Assignments:  make(map[string][]int32),
+		Paused:       make(map[string][]int32),
+		Lag:          make(map[string]map[int32]int64),
+		Err:          cg.lastErr,
+	}
+	for topic, ps := range cg.claims {
+		h.Assignments[topic] = append([]int32(nil), ps...)
+		sort.Slice(h.Assignments[topic], func(i, j int) bool { return h.Assignments[topic][i] < h.Assignments[topic][j] })
+		for _, p := range h.Assignments[topic] {
+			if cg.isPartitionPaused(topic, p) {
+				h.Paused[topic] = append(h.Paused[topic], p)
+			}
+		}
+	}
+	for tp, st := range cg.partitions {
+		hwm := st.claim.HighWaterMarkOffset()
+		offset := st.marked
+		if offset < 0 {
+			offset = st.claim.InitialOffset()
+		}
+		if offset < 0 || hwm < offset {
+			continue
+		}
+		if h.Lag[tp.topic] == nil {
+			h.Lag[tp.topic] = make(map[int32]int64)
+		}
+		h.Lag[tp.topic][tp.partition] = hwm - offset
+	}
+	return h
+}
+
+// groupHandler tracks sessions and claims of cg for Health and pauses, and delegates to the consumer of cg.
+type groupHandler struct {
+	cg *ConsumerGroup
+}
+
+func (h *groupHandler) Setup(session sarama.ConsumerGroupSession) error {
+	h.cg.mu.Lock()
+	h.cg.memberID = session.MemberID()
+	h.cg.generationID = session.GenerationID()
+	h.cg.claims = session.Claims()
+	h.cg.partitions = make(map[topicPartition]*partitionState)
+	h.cg.lastErr = nil
+	h.cg.mu.Unlock()
+	return h.cg.consumer.Setup(session)
+}
+
+func (h *groupHandler) Cleanup(session sarama.ConsumerGroupSession) error {
+	h.cg.mu.Lock()
+	h.cg.claims = nil
+	h.cg.partitions = make(map[topicPartition]*partitionState)
+	h.cg.mu.Unlock()
+	return h.cg.consumer.Cleanup(session)
+}
+
+func (h *groupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	tp := topicPartition{claim.Topic(), claim.Partition()}
+	h.cg.mu.Lock()
+	h.cg.partitions[tp] = &partitionState{claim: claim, marked: -1}
+	// the partition consumer of claim exists from now on, so pauses are applied to it
+	if h.cg.isPartitionPaused(tp.topic, tp.partition) {
+		h.cg.ConsumerGroup.Pause(map[string][]int32{tp.topic: {tp.partition}})
+	}
+	h.cg.mu.Unlock()
+
+	return h.cg.consumer.ConsumeClaim(&trackingSession{session, h.cg}, claim)
+}
+
+// trackingSession records offsets marked by the consumer.
+type trackingSession struct {
+	sarama.ConsumerGroupSession
+	cg *ConsumerGroup
+}
+
+func (s *trackingSession) track(topic string, partition int32, offset int64, reset bool) {
+	s.cg.mu.Lock()
+	defer s.cg.mu.Unlock()
+	if st, ok := s.cg.partitions[topicPartition{topic, partition}]; ok && (reset || offset > st.marked) {
+		st.marked = offset
+	}
+}
+
+func (s *trackingSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	s.ConsumerGroupSession.MarkOffset(topic, partition, offset, metadata)
+	s.track(topic, partition, offset, false)
+}
+
+func (s *trackingSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+	s.ConsumerGroupSession.ResetOffset(topic, partition, offset, metadata)
+	s.track(topic, partition, offset, true)
+}
+
+func (s *trackingSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.ConsumerGroupSession.MarkMessage(msg, metadata)
+	s.track(msg.Topic, msg.Partition, msg.Offset+1, false)
+}
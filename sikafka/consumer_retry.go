@@ -0,0 +1,303 @@
+package sikafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// Headers attached to messages forwarded to retry topics and dead letter topics.
+const (
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderError             = "x-error"
+	HeaderAttempts          = "x-attempts"
+	HeaderRetryStage        = "x-retry-stage"
+)
+
+const defaultDeadLetterSuffix = ".dlq"
+
+// ErrForwardFailed is returned from ConsumeClaim when a failed message could not be forwarded to a retry topic or
+// the dead letter topic. The session ends without marking the message, so it is consumed again by the next session.
+var ErrForwardFailed = errors.New("sikafka: failed to forward message")
+
+type handlerRetry struct {
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+func (r handlerRetry) maxAttempts() int {
+	if r.attempts < 1 {
+		return 1
+	}
+	return r.attempts
+}
+
+func (r handlerRetry) nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if r.maxBackoff > 0 && backoff > r.maxBackoff {
+		backoff = r.maxBackoff
+	}
+	return backoff
+}
+
+// WithHandlerRetry calls the handler up to attempts times in process, waiting backoff doubled after each failure up
+// to maxBackoff. It fails if backoff or maxBackoff is negative.
+func WithHandlerRetry(attempts int, backoff, maxBackoff time.Duration) CgConsumerOptionFunc {
+	return CgConsumerOptionFunc(func(c *CgConsumer) error {
+		if backoff < 0 || maxBackoff < 0 {
+			return errors.New("sikafka: retry backoff must not be negative")
+		}
+		c.retry = handlerRetry{attempts, backoff, maxBackoff}
+		return nil
+	})
+}
+
+// WithRetryTopics forwards messages failed in process to retry topics with producer. A message failed at the i-th
+// retry topic is forwarded to the next one and it is handled again after delays[i] since it was forwarded. Retry
+// topics are named `<topic>.retry.<delay>`, eg. `orders.retry.1m` and `orders.retry.10m`, and must be subscribed
+// along with the original topics, see CgConsumer.Topics. It fails if producer is nil or a delay is not positive.
+func WithRetryTopics(producer sarama.SyncProducer, delays ...time.Duration) CgConsumerOptionFunc {
+	return CgConsumerOptionFunc(func(c *CgConsumer) error {
+		if producer == nil {
+			return errors.New("sikafka: retry topic producer is nil")
+		}
+		for _, d := range delays {
+			if d <= 0 {
+				return fmt.Errorf("sikafka: retry delay must be positive: %v", d)
+			}
+		}
+		c.failureProducer = producer
+		c.retryDelays = delays
+		return nil
+	})
+}
+
+// WithDeadLetterTopic forwards messages failed at all retries to topic with producer, or to `<topic>.dlq` of the
+// original topic if topic is empty. It fails if producer is nil.
+func WithDeadLetterTopic(producer sarama.SyncProducer, topic string) CgConsumerOptionFunc {
+	return CgConsumerOptionFunc(func(c *CgConsumer) error {
+		if producer == nil {
+			return errors.New("sikafka: dead letter topic producer is nil")
+		}
+		c.failureProducer = producer
+		c.deadLetter = true
+		c.deadLetterTopic = topic
+		return nil
+	})
+}
+
+// RetryTopicName returns the name of the retry topic of topic with delay.
+func RetryTopicName(topic string, delay time.Duration) string {
+	return topic + ".retry." + formatRetryDelay(delay)
+}
+
+func formatRetryDelay(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		return strconv.FormatInt(int64(d/time.Hour), 10) + "h"
+	case d >= time.Minute && d%time.Minute == 0:
+		return strconv.FormatInt(int64(d/time.Minute), 10) + "m"
+	case d >= time.Second && d%time.Second == 0:
+		return strconv.FormatInt(int64(d/time.Second), 10) + "s"
+	}
+	return strconv.FormatInt(d.Milliseconds(), 10) + "ms"
+}
+
+// Topics returns topics with their retry topics to subscribe.
+func (c *CgConsumer) Topics(topics ...string) []string {
+	res := make([]string, 0, len(topics)*(1+len(c.retryDelays)))
+	for _, t := range topics {
+		res = append(res, t)
+		for _, d := range c.retryDelays {
+			res = append(res, RetryTopicName(t, d))
+		}
+	}
+	return res
+}
+
+// failureState is where a message is in retries, read from its headers.
+type failureState struct {
+	originalTopic string
+	stage         int
+	attempts      int
+}
+
+func readFailureState(msg *sarama.ConsumerMessage) failureState {
+	st := failureState{originalTopic: msg.Topic}
+	for _, h := range msg.Headers {
+		if h == nil {
+			continue
+		}
+		switch string(h.Key) {
+		case HeaderOriginalTopic:
+			st.originalTopic = string(h.Value)
+		case HeaderRetryStage:
+			st.stage, _ = strconv.Atoi(string(h.Value))
+		case HeaderAttempts:
+			st.attempts, _ = strconv.Atoi(string(h.Value))
+		}
+	}
+	return st
+}
+
+// handle handles msg with retries and forwards it to retry topics or the dead letter topic if it fails. It returns
+// nil if msg can be marked.
+func (c *CgConsumer) handle(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	if c.failureProducer == nil && c.retry.attempts <= 1 {
+		return c.msgHandler.Handle(msg)
+	}
+
+	if err := c.waitRetryDelay(ctx, msg); err != nil {
+		return err
+	}
+
+	attempts, err := c.handleWithRetry(ctx, msg)
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return c.forwardFailed(msg, attempts, err)
+}
+
+// waitRetryDelay waits until msg from a retry topic is due.
+func (c *CgConsumer) waitRetryDelay(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	st := readFailureState(msg)
+	if st.stage > 0 && st.stage <= len(c.retryDelays) {
+		return sleepContext(ctx, time.Until(msg.Timestamp.Add(c.retryDelays[st.stage-1])))
+	}
+	return nil
+}
+
+// forwardFailed forwards msg failed after attempts with err to the next retry topic or the dead letter topic. It
+// returns err if there is no topic to forward to, or ErrForwardFailed if forwarding failed.
+func (c *CgConsumer) forwardFailed(msg *sarama.ConsumerMessage, attempts int, err error) error {
+	st := readFailureState(msg)
+	st.attempts += attempts
+
+	next := ""
+	if st.stage < len(c.retryDelays) {
+		next = RetryTopicName(st.originalTopic, c.retryDelays[st.stage])
+	} else if c.deadLetter {
+		next = c.deadLetterTopic
+		if next == "" {
+			next = st.originalTopic + defaultDeadLetterSuffix
+		}
+	}
+	if next == "" || c.failureProducer == nil {
+		return err
+	}
+
+	if _, _, ferr := c.failureProducer.SendMessage(failedMessage(msg, next, st, err)); ferr != nil {
+		return fmt.Errorf("%w to %s: %v: %w", ErrForwardFailed, next, ferr, err)
+	}
+	return nil
+}
+
+func (c *CgConsumer) handleWithRetry(ctx context.Context, msg *sarama.ConsumerMessage) (int, error) {
+	attempts := c.retry.maxAttempts()
+	backoff := c.retry.backoff
+
+	var err error
+	for i := 1; i <= attempts; i++ {
+		if err = c.msgHandler.Handle(msg); err == nil {
+			return i, nil
+		}
+		if i == attempts {
+			return i, err
+		}
+		if serr := sleepContext(ctx, backoff); serr != nil {
+			return i, err
+		}
+		backoff = c.retry.nextBackoff(backoff)
+	}
+	return attempts, err
+}
+
+// failedMessage returns msg to forward to topic with its original headers and the failure.
+func failedMessage(msg *sarama.ConsumerMessage, topic string, st failureState, err error) *sarama.ProducerMessage {
+	headers := make([]sarama.RecordHeader, 0, len(msg.Headers)+6)
+	for _, h := range msg.Headers {
+		if h == nil || isFailureHeader(string(h.Key)) {
+			continue
+		}
+		headers = append(headers, *h)
+	}
+
+	partition, offset := strconv.Itoa(int(msg.Partition)), strconv.FormatInt(msg.Offset, 10)
+	if st.stage > 0 {
+		// keep the position in the original topic
+		for _, h := range msg.Headers {
+			if h == nil {
+				continue
+			}
+			switch string(h.Key) {
+			case HeaderOriginalPartition:
+				partition = string(h.Value)
+			case HeaderOriginalOffset:
+				offset = string(h.Value)
+			}
+		}
+	}
+
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(HeaderOriginalTopic), Value: []byte(st.originalTopic)},
+		sarama.RecordHeader{Key: []byte(HeaderOriginalPartition), Value: []byte(partition)},
+		sarama.RecordHeader{Key: []byte(HeaderOriginalOffset), Value: []byte(offset)},
+		sarama.RecordHeader{Key: []byte(HeaderError), Value: []byte(err.Error())},
+		sarama.RecordHeader{Key: []byte(HeaderAttempts), Value: []byte(strconv.Itoa(st.attempts))},
+		sarama.RecordHeader{Key: []byte(HeaderRetryStage), Value: []byte(strconv.Itoa(st.stage + 1))},
+	)
+
+	pm := &sarama.ProducerMessage{
+		Topic:   topic,
+		Value:   sarama.ByteEncoder(msg.Value),
+		Headers: headers,
+	}
+	if msg.Key != nil {
+		pm.Key = sarama.ByteEncoder(msg.Key)
+	}
+	return pm
+}
+
+func isFailureHeader(key string) bool {
+	switch key {
+	case HeaderOriginalTopic, HeaderOriginalPartition, HeaderOriginalOffset, HeaderError, HeaderAttempts,
+		HeaderRetryStage:
+		return true
+	}
+	return false
+}
+
+// FailureHeaders returns the failure headers of a message consumed from a retry topic or a dead letter topic.
+func FailureHeaders(msg *sarama.ConsumerMessage) map[string]string {
+	res := make(map[string]string)
+	for _, h := range msg.Headers {
+		if h != nil && isFailureHeader(string(h.Key)) {
+			res[string(h.Key)] = string(h.Value)
+		}
+	}
+	return res
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,83 @@
+package sikafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+var ErrClientClosed = errors.New("sikafka: client is closed")
+
+// ClientHealthChecker checks that client is open and that metadata of topics can be fetched from the cluster. Create
+// producers and consumer groups from client, eg. with sarama.NewSyncProducerFromClient, to cover them with the
+// check.
+type ClientHealthChecker struct {
+	client sarama.Client
+	topics []string
+}
+
+// NewClientHealthChecker returns ClientHealthChecker refreshing metadata of topics, or of all topics if none is
+// given.
+func NewClientHealthChecker(client sarama.Client, topics ...string) *ClientHealthChecker {
+	return &ClientHealthChecker{client, topics}
+}
+
+func (c *ClientHealthChecker) HealthCheck(ctx context.Context) error {
+	if c.client.Closed() {
+		return ErrClientClosed
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.client.RefreshMetadata(c.topics...)
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// producerHealth is the health of a producer, which is unhealthy once closed or while messages fail because brokers
+// are unavailable.
+type producerHealth struct {
+	mu      sync.Mutex
+	closed  bool
+	lastErr error
+	at      time.Time
+}
+
+// report reports the result of a message, where only retryable errors are kept.
+func (h *producerHealth) report(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err != nil && !isRetryableError(err) {
+		return
+	}
+	h.lastErr = err
+	h.at = time.Now()
+}
+
+func (h *producerHealth) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+}
+
+// check returns ErrProducerClosed if closed, or the last error reported within window if window is positive.
+func (h *producerHealth) check(window time.Duration) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return ErrProducerClosed
+	}
+	if h.lastErr == nil || (window > 0 && time.Since(h.at) > window) {
+		return nil
+	}
+	return fmt.Errorf("sikafka: failed to produce message: %w", h.lastErr)
+}
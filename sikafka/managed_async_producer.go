@@ -0,0 +1,241 @@
+package sikafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+var ErrProducerClosed = errors.New("sikafka: producer is closed")
+
+// Delivery is the delivery report of a message sent with ManagedAsyncProducer. Partition, Offset and Err are set
+// once Done is closed.
+type Delivery struct {
+	Message   *sarama.ProducerMessage
+	Partition int32
+	Offset    int64
+	Err       error
+
+	done     chan struct{}
+	callback DeliveryCallback
+	// metadata is the original Metadata of Message, which is replaced by the delivery while the message is in flight.
+	metadata any
+}
+
+// DeliveryCallback is called with the delivery report of a message. It is called from the goroutine draining the
+// producer, so it must not block.
+type DeliveryCallback func(d *Delivery)
+
+// Done is closed when the message is delivered or has failed.
+func (d *Delivery) Done() <-chan struct{} {
+	return d.done
+}
+
+// Wait waits for the delivery and returns its partition, offset and error.
+func (d *Delivery) Wait(ctx context.Context) (partition int32, offset int64, err error) {
+	select {
+	case <-d.done:
+		return d.Partition, d.Offset, d.Err
+	case <-ctx.Done():
+		return 0, 0, ctx.Err()
+	}
+}
+
+// ManagedAsyncProducer sends messages with sarama.AsyncProducer and drains its Successes and Errors so that every
+// message gets a delivery report. The producer must be configured with both `Producer.Return.Successes` and
+// `Producer.Return.Errors` enabled, see RetryableManagedAsyncProducer.
+type ManagedAsyncProducer struct {
+	producer sarama.AsyncProducer
+	topic    string
+	callback DeliveryCallback
+
+	// mu guards closed so that no message is sent to Input after the producer is closed.
+	mu     sync.RWMutex
+	closed bool
+
+	inFlightMu sync.Mutex
+	inFlight   int64
+	idle       chan struct{}
+
+	wg     sync.WaitGroup
+	health producerHealth
+}
+
+// NewManagedAsyncProducer returns ManagedAsyncProducer sending to topic by default and starts draining producer.
+// If an option fails, producer is not drained and the caller should close it.
+func NewManagedAsyncProducer(producer sarama.AsyncProducer, topic string, opts ...ManagedAsyncProducerOption) (*ManagedAsyncProducer, error) {
+	idle := make(chan struct{})
+	close(idle)
+	p := &ManagedAsyncProducer{
+		producer: producer,
+		topic:    topic,
+		idle:     idle,
+	}
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if err := o.apply(p); err != nil {
+			return nil, err
+		}
+	}
+
+	p.wg.Add(2)
+	go func() {
+		defer p.wg.Done()
+		for msg := range producer.Successes() {
+			p.complete(msg, nil)
+		}
+	}()
+	go func() {
+		defer p.wg.Done()
+		for perr := range producer.Errors() {
+			p.complete(perr.Msg, perr.Err)
+		}
+	}()
+	return p, nil
+}
+
+// Produce sends value with key to the default topic.
+func (p *ManagedAsyncProducer) Produce(ctx context.Context, key []byte, value []byte) (*Delivery, error) {
+	return p.ProduceWithTopic(ctx, p.topic, key, value)
+}
+
+func (p *ManagedAsyncProducer) ProduceWithTopic(ctx context.Context, topic string, key []byte, value []byte) (*Delivery, error) {
+	msg := &sarama.ProducerMessage{
+		Topic: topic,
+		Key:   sarama.ByteEncoder(key),
+		Value: sarama.ByteEncoder(value),
+	}
+	return p.ProduceWithMessage(ctx, msg)
+}
+
+// ProduceWithMessage sends msg and returns its Delivery. An error is returned only if msg cannot be enqueued,
+// because the producer is closed or ctx is done, failures to deliver are reported by the Delivery.
+func (p *ManagedAsyncProducer) ProduceWithMessage(ctx context.Context, msg *sarama.ProducerMessage) (*Delivery, error) {
+	return p.send(ctx, msg, nil)
+}
+
+// ProduceWithCallback sends msg and calls callback with its delivery report.
+func (p *ManagedAsyncProducer) ProduceWithCallback(ctx context.Context, msg *sarama.ProducerMessage, callback DeliveryCallback) error {
+	_, err := p.send(ctx, msg, callback)
+	return err
+}
+
+func (p *ManagedAsyncProducer) send(ctx context.Context, msg *sarama.ProducerMessage, callback DeliveryCallback) (*Delivery, error) {
+	if msg.Topic == "" {
+		msg.Topic = p.topic
+	}
+	d := &Delivery{
+		Message:  msg,
+		done:     make(chan struct{}),
+		callback: callback,
+		metadata: msg.Metadata,
+	}
+	msg.Metadata = d
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		msg.Metadata = d.metadata
+		return nil, ErrProducerClosed
+	}
+
+	p.addInFlight()
+	select {
+	case p.producer.Input() <- msg:
+		return d, nil
+	case <-ctx.Done():
+		p.doneInFlight()
+		msg.Metadata = d.metadata
+		return nil, ctx.Err()
+	}
+}
+
+func (p *ManagedAsyncProducer) complete(msg *sarama.ProducerMessage, err error) {
+	d, ok := msg.Metadata.(*Delivery)
+	if !ok {
+		// not sent by p
+		return
+	}
+	p.health.report(err)
+	msg.Metadata = d.metadata
+	d.Partition = msg.Partition
+	d.Offset = msg.Offset
+	d.Err = err
+	close(d.done)
+
+	if d.callback != nil {
+		d.callback(d)
+	}
+	if p.callback != nil {
+		p.callback(d)
+	}
+	p.doneInFlight()
+}
+
+func (p *ManagedAsyncProducer) addInFlight() {
+	p.inFlightMu.Lock()
+	defer p.inFlightMu.Unlock()
+	if p.inFlight == 0 {
+		p.idle = make(chan struct{})
+	}
+	p.inFlight++
+}
+
+func (p *ManagedAsyncProducer) doneInFlight() {
+	p.inFlightMu.Lock()
+	defer p.inFlightMu.Unlock()
+	p.inFlight--
+	if p.inFlight == 0 {
+		close(p.idle)
+	}
+}
+
+// InFlight returns the number of messages sent and not yet reported.
+func (p *ManagedAsyncProducer) InFlight() int64 {
+	p.inFlightMu.Lock()
+	defer p.inFlightMu.Unlock()
+	return p.inFlight
+}
+
+// Flush waits until all messages in flight are reported or ctx is done.
+func (p *ManagedAsyncProducer) Flush(ctx context.Context) error {
+	p.inFlightMu.Lock()
+	idle := p.idle
+	p.inFlightMu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting messages, flushes messages in flight until ctx is done and closes the underlying producer.
+// Messages still in flight when ctx is done are reported by the underlying producer as it shuts down.
+func (p *ManagedAsyncProducer) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrProducerClosed
+	}
+	p.closed = true
+	p.mu.Unlock()
+	p.health.close()
+
+	err := p.Flush(ctx)
+	// Close of sarama.AsyncProducer would drain Successes and Errors itself, so they are left to p until closed
+	p.producer.AsyncClose()
+	p.wg.Wait()
+	return err
+}
+
+// HealthCheck returns ErrProducerClosed if p is closed, or the error of the last delivery if it failed because
+// brokers were unavailable.
+func (p *ManagedAsyncProducer) HealthCheck(ctx context.Context) error {
+	return p.health.check(0)
+}
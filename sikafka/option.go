@@ -1,5 +1,10 @@
 package sikafka
 
+import (
+	"errors"
+	"time"
+)
+
 func WithSyncProducerOptionRetyMax(retryMax uint16) SyncProducerOptionFunc {
 	return SyncProducerOptionFunc(func(o *SyncProducer) error {
 		o.retryMax = retryMax
@@ -16,3 +21,122 @@ type SyncProducerOptionFunc func(o *SyncProducer) error
 func (s SyncProducerOptionFunc) apply(o *SyncProducer) error {
 	return s(o)
 }
+
+type ManagedAsyncProducerOption interface {
+	apply(o *ManagedAsyncProducer) error
+}
+
+type ManagedAsyncProducerOptionFunc func(o *ManagedAsyncProducer) error
+
+func (s ManagedAsyncProducerOptionFunc) apply(o *ManagedAsyncProducer) error {
+	return s(o)
+}
+
+// WithDeliveryCallback sets callback called with the delivery report of every message, after the callback of the
+// message if any. It is useful for logging failures and metrics.
+func WithDeliveryCallback(callback DeliveryCallback) ManagedAsyncProducerOptionFunc {
+	return ManagedAsyncProducerOptionFunc(func(o *ManagedAsyncProducer) error {
+		o.callback = callback
+		return nil
+	})
+}
+
+type CgConsumerOption interface {
+	apply(o *CgConsumer) error
+}
+
+type CgConsumerOptionFunc func(o *CgConsumer) error
+
+func (s CgConsumerOptionFunc) apply(o *CgConsumer) error {
+	return s(o)
+}
+
+type ConsumerGroupOption interface {
+	apply(o *ConsumerGroup) error
+}
+
+type ConsumerGroupOptionFunc func(o *ConsumerGroup) error
+
+func (s ConsumerGroupOptionFunc) apply(o *ConsumerGroup) error {
+	return s(o)
+}
+
+// WithConsumeRetry sets how many times consuming is retried in a row on errors of sarama.ConsumerGroup.Consume,
+// forever if retryMax is 0 or less, waiting backoff doubled after each failure up to maxBackoff. By default it is
+// retried 5 times every 3 seconds. The backoff is not limited if maxBackoff is 0. It fails if backoff or maxBackoff
+// is negative.
+func WithConsumeRetry(retryMax int, backoff, maxBackoff time.Duration) ConsumerGroupOptionFunc {
+	return ConsumerGroupOptionFunc(func(o *ConsumerGroup) error {
+		if backoff < 0 || maxBackoff < 0 {
+			return errors.New("sikafka: consume retry backoff must not be negative")
+		}
+		o.retryMax = retryMax
+		o.retryBackoff = backoff
+		o.retryMaxBackoff = maxBackoff
+		return nil
+	})
+}
+
+type TransactionalProcessorOption interface {
+	apply(o *TransactionalProcessor) error
+}
+
+type TransactionalProcessorOptionFunc func(o *TransactionalProcessor) error
+
+func (s TransactionalProcessorOptionFunc) apply(o *TransactionalProcessor) error {
+	return s(o)
+}
+
+// WithTransactionalID sets the transactional ID of the producer of each claimed partition, DefaultTransactionalID
+// by default. IDs must be unique per partition and stable across assignments for fencing.
+func WithTransactionalID(transactionalID func(topic string, partition int32) string) TransactionalProcessorOptionFunc {
+	return TransactionalProcessorOptionFunc(func(o *TransactionalProcessor) error {
+		if transactionalID == nil {
+			return errors.New("sikafka: transactional id function is nil")
+		}
+		o.transactionalID = transactionalID
+		return nil
+	})
+}
+
+// WithTransactionMaxMessages sets the maximum number of consumed messages in a transaction, 100 by default.
+func WithTransactionMaxMessages(maxMessages int) TransactionalProcessorOptionFunc {
+	return TransactionalProcessorOptionFunc(func(o *TransactionalProcessor) error {
+		if maxMessages < 1 {
+			maxMessages = 1
+		}
+		o.maxMessages = maxMessages
+		return nil
+	})
+}
+
+// WithTransformRetry calls the handler up to attempts times in the session, waiting backoff doubled after each
+// failure up to maxBackoff. It fails if backoff or maxBackoff is negative.
+func WithTransformRetry(attempts int, backoff, maxBackoff time.Duration) TransactionalProcessorOptionFunc {
+	return TransactionalProcessorOptionFunc(func(o *TransactionalProcessor) error {
+		if backoff < 0 || maxBackoff < 0 {
+			return errors.New("sikafka: retry backoff must not be negative")
+		}
+		o.retry = handlerRetry{attempts, backoff, maxBackoff}
+		return nil
+	})
+}
+
+// WithTransformDeadLetterTopic produces messages failed at all attempts to topic, or to `<topic>.dlq` of the original
+// topic if topic is empty, in the transaction along with their offsets. Failure headers are attached as by
+// WithDeadLetterTopic.
+func WithTransformDeadLetterTopic(topic string) TransactionalProcessorOptionFunc {
+	return TransactionalProcessorOptionFunc(func(o *TransactionalProcessor) error {
+		o.deadLetter = true
+		o.deadLetterTopic = topic
+		return nil
+	})
+}
+
+// WithSkipFailedTransform commits offsets of messages failed at all attempts without producing anything for them.
+func WithSkipFailedTransform() TransactionalProcessorOptionFunc {
+	return TransactionalProcessorOptionFunc(func(o *TransactionalProcessor) error {
+		o.skipFailed = true
+		return nil
+	})
+}
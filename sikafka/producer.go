@@ -60,8 +60,47 @@ func RetryableSyncProducer(brokers []string, version, topic string) (*SyncProduc
 		WithSyncProducerOptionRetyMax(2)), nil
 }
 
-// RetryableAsyncProducer returns SyncProducer with retry configured.
+// RetryableAsyncProducer returns AsyncProducer with retry configured. Errors are drained and logged, use
+// RetryableManagedAsyncProducer to handle them.
 func RetryableAsyncProducer(brokers []string, version, topic string) (*AsyncProducer, error) {
+	config, err := retryableAsyncProducerConfig(version)
+	if err != nil {
+		return nil, err
+	}
+
+	producer, err := sarama.NewAsyncProducer(brokers, config)
+	if err != nil {
+		return nil, errors.New("sikafka: failed to create async producer: " + err.Error())
+	}
+
+	ap := NewAsyncProducer(producer, topic)
+	ap.drainErrors()
+	return ap, nil
+}
+
+// RetryableManagedAsyncProducer returns ManagedAsyncProducer with retry configured and both successes and errors
+// returned for delivery reports.
+func RetryableManagedAsyncProducer(brokers []string, version, topic string, opts ...ManagedAsyncProducerOption) (*ManagedAsyncProducer, error) {
+	config, err := retryableAsyncProducerConfig(version)
+	if err != nil {
+		return nil, err
+	}
+	config.Producer.Return.Successes = true
+
+	producer, err := sarama.NewAsyncProducer(brokers, config)
+	if err != nil {
+		return nil, errors.New("sikafka: failed to create async producer: " + err.Error())
+	}
+
+	p, err := NewManagedAsyncProducer(producer, topic, opts...)
+	if err != nil {
+		producer.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func retryableAsyncProducerConfig(version string) (*sarama.Config, error) {
 	parsedVersion, err := sarama.ParseKafkaVersion(version)
 	if err != nil {
 		return nil, errors.New("sikafka: cannot parse kafka version: " + err.Error())
@@ -111,12 +150,7 @@ func RetryableAsyncProducer(brokers []string, version, topic string) (*AsyncProd
 	}
 	config.Metadata.RefreshFrequency = 5 * time.Minute
 
-	producer, err := sarama.NewAsyncProducer(brokers, config)
-	if err != nil {
-		return nil, errors.New("sikafka: failed to create async producer: " + err.Error())
-	}
-
-	return NewAsyncProducer(producer, topic), nil
+	return config, nil
 }
 
 // Deprecated
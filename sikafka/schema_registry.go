@@ -0,0 +1,210 @@
+package sikafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-wonk/si/v2/sicore"
+	"github.com/go-wonk/si/v2/sihttp"
+)
+
+const (
+	SchemaTypeAvro     = "AVRO"
+	SchemaTypeProtobuf = "PROTOBUF"
+	SchemaTypeJSON     = "JSON"
+
+	schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+
+	// error codes of Schema Registry
+	schemaRegistrySubjectNotFound = 40401
+	schemaRegistryVersionNotFound = 40402
+	schemaRegistrySchemaNotFound  = 40403
+)
+
+var ErrSchemaNotFound = errors.New("sikafka: schema not found")
+
+// Schema is a schema registered to Schema Registry. SchemaType is empty for Avro.
+type Schema struct {
+	ID         int               `json:"id,omitempty"`
+	Subject    string            `json:"subject,omitempty"`
+	Version    int               `json:"version,omitempty"`
+	SchemaType string            `json:"schemaType,omitempty"`
+	Schema     string            `json:"schema"`
+	References []SchemaReference `json:"references,omitempty"`
+}
+
+// SchemaReference is a reference to a schema of another subject, eg. an imported protobuf file.
+type SchemaReference struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+// SchemaRegistry registers and looks up schemas of subjects. It is implemented by SchemaRegistryClient,
+// CachedSchemaRegistry and MemorySchemaRegistry.
+type SchemaRegistry interface {
+	// Register registers schema under subject and returns its ID. Registering an existing schema returns the ID of
+	// it.
+	Register(ctx context.Context, subject string, schema *Schema) (int, error)
+	// Lookup returns schema registered under subject with its ID and version.
+	Lookup(ctx context.Context, subject string, schema *Schema) (*Schema, error)
+	SchemaByID(ctx context.Context, id int) (*Schema, error)
+	SchemaByVersion(ctx context.Context, subject string, version int) (*Schema, error)
+	LatestSchema(ctx context.Context, subject string) (*Schema, error)
+	Subjects(ctx context.Context) ([]string, error)
+	Versions(ctx context.Context, subject string) ([]int, error)
+	// CheckCompatibility reports whether schema is compatible with the latest version of subject under the
+	// compatibility level of subject.
+	CheckCompatibility(ctx context.Context, subject string, schema *Schema) (bool, error)
+}
+
+// SchemaRegistryError is an error response of Schema Registry.
+type SchemaRegistryError struct {
+	StatusCode int    `json:"-"`
+	ErrorCode  int    `json:"error_code"`
+	Message    string `json:"message"`
+}
+
+func (e *SchemaRegistryError) Error() string {
+	return fmt.Sprintf("sikafka: schema registry error %d: %s", e.ErrorCode, e.Message)
+}
+
+// Is reports whether target is ErrSchemaNotFound for not found subjects, versions and schemas.
+func (e *SchemaRegistryError) Is(target error) bool {
+	if target != ErrSchemaNotFound {
+		return false
+	}
+	switch e.ErrorCode {
+	case schemaRegistrySubjectNotFound, schemaRegistryVersionNotFound, schemaRegistrySchemaNotFound:
+		return true
+	}
+	return e.StatusCode == http.StatusNotFound
+}
+
+// SchemaRegistryClient is a client of Confluent compatible Schema Registry API. It sends requests with an
+// sihttp.Client, which should be created with the url of the registry as its base url and with authentication
+// request options if required.
+type SchemaRegistryClient struct {
+	client *sihttp.Client
+}
+
+func NewSchemaRegistryClient(client *sihttp.Client) *SchemaRegistryClient {
+	return &SchemaRegistryClient{client}
+}
+
+func (c *SchemaRegistryClient) Register(ctx context.Context, subject string, schema *Schema) (int, error) {
+	var res struct {
+		ID int `json:"id"`
+	}
+	err := c.post(ctx, "/subjects/"+url.PathEscape(subject)+"/versions", schemaRequest(schema), &res)
+	return res.ID, err
+}
+
+func (c *SchemaRegistryClient) Lookup(ctx context.Context, subject string, schema *Schema) (*Schema, error) {
+	var res Schema
+	if err := c.post(ctx, "/subjects/"+url.PathEscape(subject), schemaRequest(schema), &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *SchemaRegistryClient) SchemaByID(ctx context.Context, id int) (*Schema, error) {
+	var res Schema
+	if err := c.get(ctx, "/schemas/ids/"+strconv.Itoa(id), &res); err != nil {
+		return nil, err
+	}
+	res.ID = id
+	return &res, nil
+}
+
+func (c *SchemaRegistryClient) SchemaByVersion(ctx context.Context, subject string, version int) (*Schema, error) {
+	return c.schemaByVersion(ctx, subject, strconv.Itoa(version))
+}
+
+func (c *SchemaRegistryClient) LatestSchema(ctx context.Context, subject string) (*Schema, error) {
+	return c.schemaByVersion(ctx, subject, "latest")
+}
+
+func (c *SchemaRegistryClient) schemaByVersion(ctx context.Context, subject string, version string) (*Schema, error) {
+	var res Schema
+	if err := c.get(ctx, "/subjects/"+url.PathEscape(subject)+"/versions/"+version, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *SchemaRegistryClient) Subjects(ctx context.Context) ([]string, error) {
+	var res []string
+	err := c.get(ctx, "/subjects", &res)
+	return res, err
+}
+
+func (c *SchemaRegistryClient) Versions(ctx context.Context, subject string) ([]int, error) {
+	var res []int
+	err := c.get(ctx, "/subjects/"+url.PathEscape(subject)+"/versions", &res)
+	return res, err
+}
+
+func (c *SchemaRegistryClient) CheckCompatibility(ctx context.Context, subject string, schema *Schema) (bool, error) {
+	var res struct {
+		IsCompatible bool `json:"is_compatible"`
+	}
+	err := c.post(ctx, "/compatibility/subjects/"+url.PathEscape(subject)+"/versions/latest", schemaRequest(schema), &res)
+	return res.IsCompatible, err
+}
+
+// schemaRequest returns schema with the fields accepted by the registry only.
+func schemaRequest(schema *Schema) *Schema {
+	return &Schema{
+		SchemaType: schema.SchemaType,
+		Schema:     schema.Schema,
+		References: schema.References,
+	}
+}
+
+var schemaRegistryHeader = http.Header{
+	"Content-Type": []string{schemaRegistryContentType},
+	"Accept":       []string{schemaRegistryContentType + ", application/json"},
+}
+
+func (c *SchemaRegistryClient) get(ctx context.Context, path string, res any) error {
+	b, err := c.client.GetContext(ctx, path, schemaRegistryHeader, nil)
+	if err != nil {
+		return schemaRegistryError(err)
+	}
+	return json.Unmarshal(b, res)
+}
+
+func (c *SchemaRegistryClient) post(ctx context.Context, path string, body any, res any) error {
+	// the body is encoded here, since the writer options of the client may not encode JSON
+	w, buf := sicore.GetWriterAndBuffer(sicore.SetJsonEncoder())
+	defer sicore.PutWriterAndBuffer(w, buf)
+	if err := w.EncodeFlush(body); err != nil {
+		return err
+	}
+
+	b, err := c.client.PostContext(ctx, path, schemaRegistryHeader, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return schemaRegistryError(err)
+	}
+	return json.Unmarshal(b, res)
+}
+
+// schemaRegistryError converts error responses to SchemaRegistryError.
+func schemaRegistryError(err error) error {
+	var httpErr *sihttp.Error
+	if !errors.As(err, &httpErr) || httpErr.Response == nil || len(httpErr.Body) == 0 {
+		return err
+	}
+	regErr := &SchemaRegistryError{StatusCode: httpErr.Response.StatusCode}
+	if json.Unmarshal(httpErr.Body, regErr) != nil || regErr.ErrorCode == 0 {
+		return err
+	}
+	return regErr
+}
@@ -0,0 +1,113 @@
+package sikafka
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+)
+
+// CachedSchemaRegistry caches the results of a SchemaRegistry in process. Schemas by ID, schemas by version and
+// IDs of registered schemas are immutable, so they are cached forever, while latest schemas, subjects, versions and
+// compatibility are always requested to the registry.
+type CachedSchemaRegistry struct {
+	SchemaRegistry
+
+	mu        sync.RWMutex
+	byID      map[int]*Schema
+	byVersion map[string]*Schema
+	ids       map[string]*Schema
+}
+
+func NewCachedSchemaRegistry(registry SchemaRegistry) *CachedSchemaRegistry {
+	return &CachedSchemaRegistry{
+		SchemaRegistry: registry,
+		byID:           make(map[int]*Schema),
+		byVersion:      make(map[string]*Schema),
+		ids:            make(map[string]*Schema),
+	}
+}
+
+func schemaCacheKey(subject string, schema *Schema) string {
+	refs, _ := json.Marshal(schema.References)
+	return subject + "\x00" + schema.SchemaType + "\x00" + schema.Schema + "\x00" + string(refs)
+}
+
+func versionCacheKey(subject string, version int) string {
+	return subject + "\x00" + strconv.Itoa(version)
+}
+
+func (c *CachedSchemaRegistry) Register(ctx context.Context, subject string, schema *Schema) (int, error) {
+	key := schemaCacheKey(subject, schema)
+	c.mu.RLock()
+	s, ok := c.ids[key]
+	c.mu.RUnlock()
+	if ok {
+		return s.ID, nil
+	}
+
+	id, err := c.SchemaRegistry.Register(ctx, subject, schema)
+	if err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	c.ids[key] = &Schema{ID: id, Subject: subject}
+	c.mu.Unlock()
+	return id, nil
+}
+
+func (c *CachedSchemaRegistry) Lookup(ctx context.Context, subject string, schema *Schema) (*Schema, error) {
+	key := schemaCacheKey(subject, schema)
+	c.mu.RLock()
+	s, ok := c.ids[key]
+	c.mu.RUnlock()
+	if ok && s.Version > 0 {
+		return s, nil
+	}
+
+	s, err := c.SchemaRegistry.Lookup(ctx, subject, schema)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.ids[key] = s
+	c.mu.Unlock()
+	return s, nil
+}
+
+func (c *CachedSchemaRegistry) SchemaByID(ctx context.Context, id int) (*Schema, error) {
+	c.mu.RLock()
+	s, ok := c.byID[id]
+	c.mu.RUnlock()
+	if ok {
+		return s, nil
+	}
+
+	s, err := c.SchemaRegistry.SchemaByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.byID[id] = s
+	c.mu.Unlock()
+	return s, nil
+}
+
+func (c *CachedSchemaRegistry) SchemaByVersion(ctx context.Context, subject string, version int) (*Schema, error) {
+	key := versionCacheKey(subject, version)
+	c.mu.RLock()
+	s, ok := c.byVersion[key]
+	c.mu.RUnlock()
+	if ok {
+		return s, nil
+	}
+
+	s, err := c.SchemaRegistry.SchemaByVersion(ctx, subject, version)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.byVersion[key] = s
+	c.mu.Unlock()
+	return s, nil
+}
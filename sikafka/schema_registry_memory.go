@@ -0,0 +1,242 @@
+package sikafka
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemorySchemaRegistry is an in-memory SchemaRegistry for tests. IDs are shared by identical schemas across
+// subjects as in Schema Registry. Compatibility of Avro records is checked with BACKWARD level: fields added must
+// have defaults and types of existing fields must not change. Other schema types are always compatible.
+type MemorySchemaRegistry struct {
+	mu       sync.RWMutex
+	schemas  []*Schema // indexed by ID-1
+	subjects map[string][]*Schema
+}
+
+func NewMemorySchemaRegistry() *MemorySchemaRegistry {
+	return &MemorySchemaRegistry{
+		subjects: make(map[string][]*Schema),
+	}
+}
+
+func (m *MemorySchemaRegistry) Register(ctx context.Context, subject string, schema *Schema) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	versions := m.subjects[subject]
+	for _, s := range versions {
+		if sameSchema(s, schema) {
+			return s.ID, nil
+		}
+	}
+	if len(versions) > 0 && !schemaCompatible(versions[len(versions)-1], schema) {
+		return 0, &SchemaRegistryError{StatusCode: http.StatusConflict, ErrorCode: http.StatusConflict,
+			Message: "Schema being registered is incompatible with an earlier schema for subject " + subject}
+	}
+
+	id := 0
+	for _, s := range m.schemas {
+		if sameSchema(s, schema) {
+			id = s.ID
+			break
+		}
+	}
+	if id == 0 {
+		m.schemas = append(m.schemas, &Schema{
+			ID:         len(m.schemas) + 1,
+			SchemaType: schema.SchemaType,
+			Schema:     schema.Schema,
+			References: schema.References,
+		})
+		id = len(m.schemas)
+	}
+
+	m.subjects[subject] = append(versions, &Schema{
+		ID:         id,
+		Subject:    subject,
+		Version:    len(versions) + 1,
+		SchemaType: schema.SchemaType,
+		Schema:     schema.Schema,
+		References: schema.References,
+	})
+	return id, nil
+}
+
+func (m *MemorySchemaRegistry) Lookup(ctx context.Context, subject string, schema *Schema) (*Schema, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	versions, ok := m.subjects[subject]
+	if !ok {
+		return nil, subjectNotFound(subject)
+	}
+	for _, s := range versions {
+		if sameSchema(s, schema) {
+			return copySchema(s), nil
+		}
+	}
+	return nil, &SchemaRegistryError{StatusCode: http.StatusNotFound, ErrorCode: schemaRegistrySchemaNotFound, Message: "Schema not found"}
+}
+
+func (m *MemorySchemaRegistry) SchemaByID(ctx context.Context, id int) (*Schema, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if id <= 0 || id > len(m.schemas) {
+		return nil, &SchemaRegistryError{StatusCode: http.StatusNotFound, ErrorCode: schemaRegistrySchemaNotFound, Message: "Schema not found"}
+	}
+	return copySchema(m.schemas[id-1]), nil
+}
+
+func (m *MemorySchemaRegistry) SchemaByVersion(ctx context.Context, subject string, version int) (*Schema, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	versions, ok := m.subjects[subject]
+	if !ok {
+		return nil, subjectNotFound(subject)
+	}
+	if version <= 0 || version > len(versions) {
+		return nil, &SchemaRegistryError{StatusCode: http.StatusNotFound, ErrorCode: schemaRegistryVersionNotFound, Message: "Version not found"}
+	}
+	return copySchema(versions[version-1]), nil
+}
+
+func (m *MemorySchemaRegistry) LatestSchema(ctx context.Context, subject string) (*Schema, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	versions, ok := m.subjects[subject]
+	if !ok {
+		return nil, subjectNotFound(subject)
+	}
+	return copySchema(versions[len(versions)-1]), nil
+}
+
+func (m *MemorySchemaRegistry) Subjects(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	subjects := make([]string, 0, len(m.subjects))
+	for s := range m.subjects {
+		subjects = append(subjects, s)
+	}
+	sort.Strings(subjects)
+	return subjects, nil
+}
+
+func (m *MemorySchemaRegistry) Versions(ctx context.Context, subject string) ([]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	versions, ok := m.subjects[subject]
+	if !ok {
+		return nil, subjectNotFound(subject)
+	}
+	res := make([]int, len(versions))
+	for i, s := range versions {
+		res[i] = s.Version
+	}
+	return res, nil
+}
+
+func (m *MemorySchemaRegistry) CheckCompatibility(ctx context.Context, subject string, schema *Schema) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	versions, ok := m.subjects[subject]
+	if !ok {
+		return false, subjectNotFound(subject)
+	}
+	return schemaCompatible(versions[len(versions)-1], schema), nil
+}
+
+func subjectNotFound(subject string) error {
+	return &SchemaRegistryError{StatusCode: http.StatusNotFound, ErrorCode: schemaRegistrySubjectNotFound, Message: "Subject '" + subject + "' not found."}
+}
+
+func copySchema(s *Schema) *Schema {
+	c := *s
+	return &c
+}
+
+func schemaTypeOf(s *Schema) string {
+	if s.SchemaType == "" {
+		return SchemaTypeAvro
+	}
+	return strings.ToUpper(s.SchemaType)
+}
+
+func sameSchema(a, b *Schema) bool {
+	if schemaTypeOf(a) != schemaTypeOf(b) || len(a.References) != len(b.References) {
+		return false
+	}
+	for i := range a.References {
+		if a.References[i] != b.References[i] {
+			return false
+		}
+	}
+	if a.Schema == b.Schema {
+		return true
+	}
+	if schemaTypeOf(a) == SchemaTypeProtobuf {
+		return false
+	}
+	// compare JSON schemas ignoring formatting
+	var av, bv any
+	if json.Unmarshal([]byte(a.Schema), &av) != nil || json.Unmarshal([]byte(b.Schema), &bv) != nil {
+		return false
+	}
+	ab, _ := json.Marshal(av)
+	bb, _ := json.Marshal(bv)
+	return string(ab) == string(bb)
+}
+
+type avroRecordSchema struct {
+	Type   string `json:"type"`
+	Fields []struct {
+		Name    string          `json:"name"`
+		Type    json.RawMessage `json:"type"`
+		Default json.RawMessage `json:"default"`
+	} `json:"fields"`
+}
+
+// schemaCompatible checks BACKWARD compatibility of Avro records, new schema reading data of old schema.
+func schemaCompatible(old, new *Schema) bool {
+	if schemaTypeOf(old) != schemaTypeOf(new) {
+		return false
+	}
+	if schemaTypeOf(new) != SchemaTypeAvro {
+		return true
+	}
+
+	var o, n avroRecordSchema
+	if json.Unmarshal([]byte(old.Schema), &o) != nil || json.Unmarshal([]byte(new.Schema), &n) != nil ||
+		o.Type != "record" || n.Type != "record" {
+		return true
+	}
+	oldTypes := make(map[string]string, len(o.Fields))
+	for _, f := range o.Fields {
+		oldTypes[f.Name] = compactJSON(f.Type)
+	}
+	for _, f := range n.Fields {
+		t, ok := oldTypes[f.Name]
+		if !ok {
+			if f.Default == nil {
+				return false
+			}
+			continue
+		}
+		if t != compactJSON(f.Type) {
+			return false
+		}
+	}
+	return true
+}
+
+func compactJSON(b json.RawMessage) string {
+	var v any
+	if json.Unmarshal(b, &v) != nil {
+		return string(b)
+	}
+	c, _ := json.Marshal(v)
+	return string(c)
+}
@@ -0,0 +1,216 @@
+package sikafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// SubjectNameStrategy returns the subject of the schema of keys or values of topic.
+type SubjectNameStrategy func(topic string, isKey bool) string
+
+// TopicNameStrategy is the default strategy of Schema Registry, `<topic>-key` or `<topic>-value`.
+func TopicNameStrategy(topic string, isKey bool) string {
+	if isKey {
+		return topic + "-key"
+	}
+	return topic + "-value"
+}
+
+type registrySerdeConfig struct {
+	isKey        bool
+	strategy     SubjectNameStrategy
+	autoRegister bool
+}
+
+type RegistrySerdeOption interface {
+	apply(c *registrySerdeConfig) error
+}
+
+type RegistrySerdeOptionFunc func(c *registrySerdeConfig) error
+
+func (o RegistrySerdeOptionFunc) apply(c *registrySerdeConfig) error {
+	return o(c)
+}
+
+// WithKeySerde makes a registry serde serialize keys instead of values, which affects the subject name.
+func WithKeySerde() RegistrySerdeOptionFunc {
+	return RegistrySerdeOptionFunc(func(c *registrySerdeConfig) error {
+		c.isKey = true
+		return nil
+	})
+}
+
+// WithSubjectNameStrategy sets the strategy naming subjects, TopicNameStrategy by default.
+func WithSubjectNameStrategy(strategy SubjectNameStrategy) RegistrySerdeOptionFunc {
+	return RegistrySerdeOptionFunc(func(c *registrySerdeConfig) error {
+		c.strategy = strategy
+		return nil
+	})
+}
+
+// WithAutoRegister sets whether the schema is registered on the first Serialize of a subject. If it is disabled,
+// the schema must have been registered and it is only looked up. It is enabled by default.
+func WithAutoRegister(autoRegister bool) RegistrySerdeOptionFunc {
+	return RegistrySerdeOptionFunc(func(c *registrySerdeConfig) error {
+		c.autoRegister = autoRegister
+		return nil
+	})
+}
+
+// registrySchema resolves the IDs of a schema in subjects of topics.
+type registrySchema struct {
+	registry SchemaRegistry
+	schema   *Schema
+	config   registrySerdeConfig
+
+	ids sync.Map // subject -> int
+}
+
+func newRegistrySchema(registry SchemaRegistry, schema *Schema, opts []RegistrySerdeOption) (*registrySchema, error) {
+	rs := &registrySchema{
+		registry: registry,
+		schema:   schema,
+		config: registrySerdeConfig{
+			strategy:     TopicNameStrategy,
+			autoRegister: true,
+		},
+	}
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if err := o.apply(&rs.config); err != nil {
+			return nil, err
+		}
+	}
+	return rs, nil
+}
+
+func (rs *registrySchema) id(topic string) (int, error) {
+	subject := rs.config.strategy(topic, rs.config.isKey)
+	if id, ok := rs.ids.Load(subject); ok {
+		return id.(int), nil
+	}
+
+	// Serializer has no context, registration is bounded by the timeouts of the registry client
+	ctx := context.Background()
+	var id int
+	if rs.config.autoRegister {
+		registered, err := rs.registry.Register(ctx, subject, rs.schema)
+		if err != nil {
+			return 0, err
+		}
+		id = registered
+	} else {
+		s, err := rs.registry.Lookup(ctx, subject, rs.schema)
+		if err != nil {
+			return 0, err
+		}
+		id = s.ID
+	}
+	rs.ids.Store(subject, id)
+	return id, nil
+}
+
+// AvroRegistrySerde encodes values of T with an Avro schema registered to SchemaRegistry. Messages are decoded with
+// the writer schema fetched by the schema ID of each message, so messages written with other versions of the schema
+// are decoded as long as the fields of T are found by name. Values are converted through JSON as in AvroSerde.
+//
+// Use NewCachedSchemaRegistry to avoid fetching writer schemas of unknown IDs more than once.
+type AvroRegistrySerde[T any] struct {
+	rs     *registrySchema
+	codec  *goavro.Codec
+	codecs sync.Map // id -> *goavro.Codec
+}
+
+func NewAvroRegistrySerde[T any](registry SchemaRegistry, schema string, opts ...RegistrySerdeOption) (*AvroRegistrySerde[T], error) {
+	codec, err := goavro.NewCodecForStandardJSONFull(schema)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := newRegistrySchema(registry, &Schema{Schema: schema}, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &AvroRegistrySerde[T]{rs: rs, codec: codec}, nil
+}
+
+func (s *AvroRegistrySerde[T]) Serialize(topic string, v T) ([]byte, error) {
+	id, err := s.rs.id(topic)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := avroEncode(s.codec, v)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeWireFormat(id, payload), nil
+}
+
+func (s *AvroRegistrySerde[T]) Deserialize(topic string, b []byte) (T, error) {
+	var zero T
+	id, payload, err := DecodeWireFormat(b)
+	if err != nil {
+		return zero, err
+	}
+	codec, err := s.writerCodec(id)
+	if err != nil {
+		return zero, err
+	}
+	return avroDecode[T](codec, payload)
+}
+
+func (s *AvroRegistrySerde[T]) writerCodec(id int) (*goavro.Codec, error) {
+	if c, ok := s.codecs.Load(id); ok {
+		return c.(*goavro.Codec), nil
+	}
+	schema, err := s.rs.registry.SchemaByID(context.Background(), id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %d: %v", ErrUnknownSchemaID, id, err)
+	}
+	if schemaTypeOf(schema) != SchemaTypeAvro {
+		return nil, fmt.Errorf("sikafka: schema %d is not avro but %s", id, schemaTypeOf(schema))
+	}
+	codec, err := goavro.NewCodecForStandardJSONFull(schema.Schema)
+	if err != nil {
+		return nil, err
+	}
+	s.codecs.Store(id, codec)
+	return codec, nil
+}
+
+// ProtobufRegistrySerde encodes protobuf messages of T with schema, the `.proto` definition of T, registered to
+// SchemaRegistry. As in ProtobufSerde, T must be the first message type of schema.
+type ProtobufRegistrySerde[T proto.Message] struct {
+	rs *registrySchema
+}
+
+func NewProtobufRegistrySerde[T proto.Message](registry SchemaRegistry, schema string, opts ...RegistrySerdeOption) (*ProtobufRegistrySerde[T], error) {
+	rs, err := newRegistrySchema(registry, &Schema{SchemaType: SchemaTypeProtobuf, Schema: schema}, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &ProtobufRegistrySerde[T]{rs: rs}, nil
+}
+
+func (s *ProtobufRegistrySerde[T]) Serialize(topic string, v T) ([]byte, error) {
+	id, err := s.rs.id(topic)
+	if err != nil {
+		return nil, err
+	}
+	return NewProtobufSerde[T](id).Serialize(topic, v)
+}
+
+// Deserialize decodes b regardless of its schema ID, since protobuf messages are decoded by field numbers.
+func (s *ProtobufRegistrySerde[T]) Deserialize(topic string, b []byte) (T, error) {
+	id, _, err := DecodeWireFormat(b)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return NewProtobufSerde[T](id).Deserialize(topic, b)
+}
@@ -0,0 +1,213 @@
+package sikafka
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// wireFormatMagicByte is the first byte of messages in Confluent wire format, followed by 4 bytes of schema ID.
+const wireFormatMagicByte byte = 0
+
+var (
+	ErrInvalidWireFormat = errors.New("sikafka: invalid wire format")
+	ErrUnknownSchemaID   = errors.New("sikafka: unknown schema id")
+)
+
+// Serializer encodes values of T for topic.
+type Serializer[T any] interface {
+	Serialize(topic string, v T) ([]byte, error)
+}
+
+// Deserializer decodes values of T from topic.
+type Deserializer[T any] interface {
+	Deserialize(topic string, b []byte) (T, error)
+}
+
+// Serde is Serializer and Deserializer of T.
+type Serde[T any] interface {
+	Serializer[T]
+	Deserializer[T]
+}
+
+// EncodeWireFormat prepends the magic byte and schemaID to payload as in Confluent wire format.
+func EncodeWireFormat(schemaID int, payload []byte) []byte {
+	b := make([]byte, 5+len(payload))
+	b[0] = wireFormatMagicByte
+	binary.BigEndian.PutUint32(b[1:5], uint32(schemaID))
+	copy(b[5:], payload)
+	return b
+}
+
+// DecodeWireFormat returns the schema ID and the payload of b in Confluent wire format.
+func DecodeWireFormat(b []byte) (schemaID int, payload []byte, err error) {
+	if len(b) < 5 || b[0] != wireFormatMagicByte {
+		return 0, nil, ErrInvalidWireFormat
+	}
+	return int(binary.BigEndian.Uint32(b[1:5])), b[5:], nil
+}
+
+// BytesSerde passes bytes as they are.
+type BytesSerde struct{}
+
+func (BytesSerde) Serialize(topic string, v []byte) ([]byte, error) {
+	return v, nil
+}
+
+func (BytesSerde) Deserialize(topic string, b []byte) ([]byte, error) {
+	return b, nil
+}
+
+// StringSerde encodes strings as UTF-8 bytes.
+type StringSerde struct{}
+
+func (StringSerde) Serialize(topic string, v string) ([]byte, error) {
+	return []byte(v), nil
+}
+
+func (StringSerde) Deserialize(topic string, b []byte) (string, error) {
+	return string(b), nil
+}
+
+// JSONSerde encodes values of T as JSON.
+type JSONSerde[T any] struct{}
+
+func NewJSONSerde[T any]() *JSONSerde[T] {
+	return &JSONSerde[T]{}
+}
+
+func (*JSONSerde[T]) Serialize(topic string, v T) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (*JSONSerde[T]) Deserialize(topic string, b []byte) (T, error) {
+	var v T
+	err := json.Unmarshal(b, &v)
+	return v, err
+}
+
+// ProtobufSerde encodes protobuf messages of T in Confluent wire format with schemaID. T must be a pointer to a
+// generated message type, eg. *pb.Student.
+//
+// Only the first message type of the schema is supported, whose message indexes are encoded as a single 0.
+type ProtobufSerde[T proto.Message] struct {
+	schemaID int
+}
+
+func NewProtobufSerde[T proto.Message](schemaID int) *ProtobufSerde[T] {
+	return &ProtobufSerde[T]{schemaID: schemaID}
+}
+
+func (s *ProtobufSerde[T]) Serialize(topic string, v T) ([]byte, error) {
+	payload, err := proto.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	// message indexes [0] are encoded as a single 0
+	return EncodeWireFormat(s.schemaID, append([]byte{0}, payload...)), nil
+}
+
+func (s *ProtobufSerde[T]) Deserialize(topic string, b []byte) (T, error) {
+	var zero T
+	schemaID, payload, err := DecodeWireFormat(b)
+	if err != nil {
+		return zero, err
+	}
+	if schemaID != s.schemaID {
+		return zero, fmt.Errorf("%w: %d", ErrUnknownSchemaID, schemaID)
+	}
+	payload, err = skipMessageIndexes(payload)
+	if err != nil {
+		return zero, err
+	}
+
+	v := zero.ProtoReflect().New().Interface().(T)
+	if err := proto.Unmarshal(payload, v); err != nil {
+		return zero, err
+	}
+	return v, nil
+}
+
+// skipMessageIndexes skips the array of message indexes, a zigzag varint count followed by the indexes, preceding
+// protobuf payloads.
+func skipMessageIndexes(b []byte) ([]byte, error) {
+	count, n := binary.Varint(b)
+	if n <= 0 || count < 0 {
+		return nil, ErrInvalidWireFormat
+	}
+	b = b[n:]
+	for i := int64(0); i < count; i++ {
+		_, n := binary.Varint(b)
+		if n <= 0 {
+			return nil, ErrInvalidWireFormat
+		}
+		b = b[n:]
+	}
+	return b, nil
+}
+
+// AvroSerde encodes values of T with an Avro schema in Confluent wire format with schemaID. Values are converted
+// through their JSON encoding, so the json tags of T must match the field names of the schema. Unions are encoded
+// as plain JSON values, not wrapped with their type names.
+type AvroSerde[T any] struct {
+	schemaID int
+	codec    *goavro.Codec
+}
+
+func NewAvroSerde[T any](schemaID int, schema string) (*AvroSerde[T], error) {
+	codec, err := goavro.NewCodecForStandardJSONFull(schema)
+	if err != nil {
+		return nil, err
+	}
+	return &AvroSerde[T]{schemaID: schemaID, codec: codec}, nil
+}
+
+func (s *AvroSerde[T]) Serialize(topic string, v T) ([]byte, error) {
+	payload, err := avroEncode(s.codec, v)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeWireFormat(s.schemaID, payload), nil
+}
+
+func (s *AvroSerde[T]) Deserialize(topic string, b []byte) (T, error) {
+	var zero T
+	schemaID, payload, err := DecodeWireFormat(b)
+	if err != nil {
+		return zero, err
+	}
+	if schemaID != s.schemaID {
+		return zero, fmt.Errorf("%w: %d", ErrUnknownSchemaID, schemaID)
+	}
+	return avroDecode[T](s.codec, payload)
+}
+
+func avroEncode(codec *goavro.Codec, v any) ([]byte, error) {
+	textual, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	native, _, err := codec.NativeFromTextual(textual)
+	if err != nil {
+		return nil, err
+	}
+	return codec.BinaryFromNative(nil, native)
+}
+
+func avroDecode[T any](codec *goavro.Codec, payload []byte) (T, error) {
+	var v T
+	native, _, err := codec.NativeFromBinary(payload)
+	if err != nil {
+		return v, err
+	}
+	textual, err := codec.TextualFromNative(nil, native)
+	if err != nil {
+		return v, err
+	}
+	err = json.Unmarshal(textual, &v)
+	return v, err
+}
@@ -0,0 +1,202 @@
+// Package sikafkatest provides an in-memory Kafka broker with consumer groups implementing sarama.ConsumerGroup, for
+// testing code built on sikafka without a cluster.
+//
+// Producers are the mocks of sarama/mocks. Broker.Deliver is a mocks.MessageChecker appending messages to Broker,
+// so that messages expected to be sent by a mock producer are consumed by consumer groups of Broker. Injecting
+// produce errors and checking messages are left to the mocks.
+//
+// Consumer groups are implemented here since sarama.MockBroker answers requests with responses set up in advance and
+// sarama/mocks has no consumer group, so neither keeps the state shared by members of a group. Broker keeps topics,
+// committed offsets and group members, so that a joining member rebalances the partitions of the others and a new
+// session continues from the committed offsets. Transactions are not supported.
+package sikafkatest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+const DefaultPartitions int32 = 1
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// Broker is an in-memory cluster of topics and consumer groups. Topics are created with DefaultPartitions
+// partitions when they are first delivered to or subscribed, or with CreateTopic.
+type Broker struct {
+	mu sync.Mutex
+	// changed is closed and replaced whenever partitions, pauses or groups change
+	changed chan struct{}
+
+	topics    map[string][][]*sarama.ConsumerMessage
+	committed map[string]map[topicPartition]int64
+	groups    map[string]*group
+
+	consumeErrs map[string][]error
+
+	memberSeq int
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		changed:     make(chan struct{}),
+		topics:      make(map[string][][]*sarama.ConsumerMessage),
+		committed:   make(map[string]map[topicPartition]int64),
+		groups:      make(map[string]*group),
+		consumeErrs: make(map[string][]error),
+	}
+}
+
+// notify wakes up goroutines waiting for changes. b.mu must be held.
+func (b *Broker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// CreateTopic creates topic with partitions, or adds partitions to topic if it has less. Consumer groups subscribing
+// topic are rebalanced if partitions are added.
+func (b *Broker) CreateTopic(topic string, partitions int32) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ps, ok := b.topics[topic]
+	if ok && int32(len(ps)) >= partitions {
+		return
+	}
+	for int32(len(ps)) < partitions {
+		ps = append(ps, nil)
+	}
+	b.topics[topic] = ps
+	if ok {
+		for _, g := range b.groups {
+			if g.subscribes(topic) {
+				b.rebalance(g)
+			}
+		}
+	}
+	b.notify()
+}
+
+// ensureTopic creates topic with DefaultPartitions if it does not exist. b.mu must be held.
+func (b *Broker) ensureTopic(topic string) [][]*sarama.ConsumerMessage {
+	ps, ok := b.topics[topic]
+	if !ok {
+		ps = make([][]*sarama.ConsumerMessage, DefaultPartitions)
+		b.topics[topic] = ps
+	}
+	return ps
+}
+
+// FailConsume makes the next Consume calls of members of group fail with errs in order.
+func (b *Broker) FailConsume(group string, errs ...error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.consumeErrs[group] = append(b.consumeErrs[group], errs...)
+}
+
+func popError(errs map[string][]error, key string) error {
+	if len(errs[key]) == 0 {
+		return nil
+	}
+	err := errs[key][0]
+	errs[key] = errs[key][1:]
+	return err
+}
+
+// Messages returns messages of topic ordered by partitions and offsets.
+func (b *Broker) Messages(topic string) []*sarama.ConsumerMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var res []*sarama.ConsumerMessage
+	for _, p := range b.topics[topic] {
+		res = append(res, p...)
+	}
+	return res
+}
+
+// HighWaterMark returns the offset of the next message of the partition.
+func (b *Broker) HighWaterMark(topic string, partition int32) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ps := b.topics[topic]
+	if int(partition) >= len(ps) {
+		return 0
+	}
+	return int64(len(ps[partition]))
+}
+
+// CommittedOffset returns the offset committed by group for the partition, or -1 if there is none.
+func (b *Broker) CommittedOffset(group, topic string, partition int32) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if o, ok := b.committed[group][topicPartition{topic, partition}]; ok {
+		return o
+	}
+	return -1
+}
+
+// Deliver appends msg to the partition set in msg and sets its offset. It is a mocks.MessageChecker, pass it to
+// the expectations of mock producers, eg. `ExpectSendMessageWithMessageCheckerFunctionAndSucceed(b.Deliver)`, to
+// deliver the messages they send to b. It fails with sarama.ErrInvalidPartition if the topic does not have the
+// partition.
+func (b *Broker) Deliver(msg *sarama.ProducerMessage) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ps := b.ensureTopic(msg.Topic)
+	if msg.Partition < 0 || int(msg.Partition) >= len(ps) {
+		return sarama.ErrInvalidPartition
+	}
+
+	cm := &sarama.ConsumerMessage{
+		Topic:     msg.Topic,
+		Partition: msg.Partition,
+		Offset:    int64(len(ps[msg.Partition])),
+		Timestamp: msg.Timestamp,
+	}
+	if cm.Timestamp.IsZero() {
+		cm.Timestamp = time.Now()
+	}
+	var err error
+	if msg.Key != nil {
+		if cm.Key, err = msg.Key.Encode(); err != nil {
+			return err
+		}
+	}
+	if msg.Value != nil {
+		if cm.Value, err = msg.Value.Encode(); err != nil {
+			return err
+		}
+	}
+	for i := range msg.Headers {
+		h := msg.Headers[i]
+		cm.Headers = append(cm.Headers, &h)
+	}
+
+	ps[msg.Partition] = append(ps[msg.Partition], cm)
+	msg.Offset = cm.Offset
+	b.notify()
+	return nil
+}
+
+// commitOffset commits offset of group if generation is of the current generation of group. b.mu must be held.
+func (b *Broker) commitOffset(group string, generation int32, tp topicPartition, offset int64) {
+	if g, ok := b.groups[group]; ok && g.generation != generation {
+		return
+	}
+	if b.committed[group] == nil {
+		b.committed[group] = make(map[topicPartition]int64)
+	}
+	b.committed[group][tp] = offset
+}
+
+func sortedPartitions(ps []int32) []int32 {
+	sort.Slice(ps, func(i, j int) bool { return ps[i] < ps[j] })
+	return ps
+}
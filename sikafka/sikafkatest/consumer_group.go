@@ -0,0 +1,410 @@
+package sikafkatest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+type group struct {
+	generation  int32
+	members     map[string]*member
+	assignments map[string]map[string][]int32 // member ID -> topic -> partitions
+}
+
+func (g *group) subscribes(topic string) bool {
+	for _, m := range g.members {
+		for _, t := range m.topics {
+			if t == topic {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type member struct {
+	id     string
+	topics []string
+	// cancel ends the current session of the member
+	cancel context.CancelFunc
+
+	pauseAll bool
+	paused   map[topicPartition]bool
+}
+
+func (m *member) isPaused(tp topicPartition) bool {
+	return m.pauseAll || m.paused[tp]
+}
+
+// rebalance starts a new generation of g, assigning partitions of each topic to its subscribers in turn, and ends
+// the current sessions of all members. b.mu must be held.
+func (b *Broker) rebalance(g *group) {
+	g.generation++
+	g.assignments = make(map[string]map[string][]int32, len(g.members))
+
+	subscribers := make(map[string][]string)
+	for id, m := range g.members {
+		g.assignments[id] = make(map[string][]int32)
+		for _, t := range m.topics {
+			subscribers[t] = append(subscribers[t], id)
+		}
+	}
+	for topic, ids := range subscribers {
+		sort.Strings(ids)
+		for p := range b.ensureTopic(topic) {
+			id := ids[p%len(ids)]
+			g.assignments[id][topic] = append(g.assignments[id][topic], int32(p))
+		}
+	}
+
+	for _, m := range g.members {
+		if m.cancel != nil {
+			m.cancel()
+		}
+	}
+	b.notify()
+}
+
+// Rebalance starts a new generation of group, which ends the sessions of all members as a server-side rebalance
+// does.
+func (b *Broker) Rebalance(group string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if g, ok := b.groups[group]; ok {
+		b.rebalance(g)
+	}
+}
+
+// Assignments returns partitions of topics assigned to members of group by member IDs.
+func (b *Broker) Assignments(group string) map[string]map[string][]int32 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	res := make(map[string]map[string][]int32)
+	if g, ok := b.groups[group]; ok {
+		for id, topics := range g.assignments {
+			res[id] = make(map[string][]int32, len(topics))
+			for t, ps := range topics {
+				res[id][t] = sortedPartitions(append([]int32(nil), ps...))
+			}
+		}
+	}
+	return res
+}
+
+// ConsumerGroup is a member of a consumer group of Broker implementing sarama.ConsumerGroup. The member joins the
+// group on the first Consume, which rebalances the group, and leaves it on Close. Offsets marked in sessions are
+// committed immediately if `Consumer.Offsets.AutoCommit.Enable` is set, otherwise on Commit of the session. Commits
+// of sessions of previous generations are ignored as Kafka rejects them.
+type ConsumerGroup struct {
+	b      *Broker
+	group  string
+	config *sarama.Config
+	m      *member
+
+	closed    bool
+	errors    chan error
+	closeOnce sync.Once
+}
+
+// NewConsumerGroup returns a new member of group configured with config, or sarama.NewConfig if it is nil.
+func (b *Broker) NewConsumerGroup(group string, config *sarama.Config) *ConsumerGroup {
+	if config == nil {
+		config = sarama.NewConfig()
+	}
+	b.mu.Lock()
+	b.memberSeq++
+	id := fmt.Sprintf("%s-member-%d", group, b.memberSeq)
+	b.mu.Unlock()
+
+	return &ConsumerGroup{
+		b:      b,
+		group:  group,
+		config: config,
+		m:      &member{id: id, paused: make(map[topicPartition]bool)},
+		errors: make(chan error),
+	}
+}
+
+// MemberID returns the ID of the member.
+func (cg *ConsumerGroup) MemberID() string {
+	return cg.m.id
+}
+
+func sameTopics(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (cg *ConsumerGroup) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
+	if len(topics) == 0 {
+		return sarama.ConfigurationError("no topics provided")
+	}
+	topics = append([]string(nil), topics...)
+	sort.Strings(topics)
+
+	b := cg.b
+	b.mu.Lock()
+	if cg.closed {
+		b.mu.Unlock()
+		return sarama.ErrClosedConsumerGroup
+	}
+	if err := popError(b.consumeErrs, cg.group); err != nil {
+		b.mu.Unlock()
+		return err
+	}
+
+	g, ok := b.groups[cg.group]
+	if !ok {
+		g = &group{members: make(map[string]*member)}
+		b.groups[cg.group] = g
+	}
+	if _, ok := g.members[cg.m.id]; !ok || !sameTopics(cg.m.topics, topics) {
+		cg.m.topics = topics
+		g.members[cg.m.id] = cg.m
+		b.rebalance(g)
+	}
+
+	sessCtx, cancel := context.WithCancel(ctx)
+	cg.m.cancel = cancel
+	s := &session{
+		ctx:        sessCtx,
+		cg:         cg,
+		generation: g.generation,
+		claims:     make(map[string][]int32),
+		marked:     make(map[topicPartition]int64),
+	}
+	var claims []*claim
+	for topic, ps := range g.assignments[cg.m.id] {
+		for _, p := range ps {
+			tp := topicPartition{topic, p}
+			c := &claim{
+				b:        b,
+				tp:       tp,
+				initial:  cg.initialOffset(tp),
+				messages: make(chan *sarama.ConsumerMessage, cg.config.ChannelBufferSize),
+			}
+			s.claims[topic] = append(s.claims[topic], p)
+			s.marked[tp] = c.initial
+			claims = append(claims, c)
+		}
+	}
+	b.mu.Unlock()
+	defer cancel()
+
+	if err := handler.Setup(s); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range claims {
+		wg.Add(2)
+		go func(c *claim) {
+			defer wg.Done()
+			c.feed(sessCtx, cg.m)
+		}(c)
+		go func(c *claim) {
+			defer wg.Done()
+			// the session ends as soon as a claim has been consumed
+			defer cancel()
+			_ = handler.ConsumeClaim(s, c)
+		}(c)
+	}
+	<-sessCtx.Done()
+	wg.Wait()
+
+	return handler.Cleanup(s)
+}
+
+// initialOffset returns the offset to start consuming tp from. b.mu must be held.
+func (cg *ConsumerGroup) initialOffset(tp topicPartition) int64 {
+	if o, ok := cg.b.committed[cg.group][tp]; ok {
+		return o
+	}
+	if cg.config.Consumer.Offsets.Initial == sarama.OffsetOldest {
+		return 0
+	}
+	return int64(len(cg.b.topics[tp.topic][tp.partition]))
+}
+
+func (cg *ConsumerGroup) Errors() <-chan error {
+	return cg.errors
+}
+
+// Close leaves the group, which rebalances the other members.
+func (cg *ConsumerGroup) Close() error {
+	b := cg.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if cg.closed {
+		return nil
+	}
+	cg.closed = true
+	if cg.m.cancel != nil {
+		cg.m.cancel()
+	}
+	if g, ok := b.groups[cg.group]; ok {
+		if _, ok := g.members[cg.m.id]; ok {
+			delete(g.members, cg.m.id)
+			b.rebalance(g)
+		}
+	}
+	cg.closeOnce.Do(func() {
+		close(cg.errors)
+	})
+	return nil
+}
+
+func (cg *ConsumerGroup) Pause(partitions map[string][]int32) {
+	cg.b.mu.Lock()
+	defer cg.b.mu.Unlock()
+	for topic, ps := range partitions {
+		for _, p := range ps {
+			cg.m.paused[topicPartition{topic, p}] = true
+		}
+	}
+	cg.b.notify()
+}
+
+func (cg *ConsumerGroup) Resume(partitions map[string][]int32) {
+	cg.b.mu.Lock()
+	defer cg.b.mu.Unlock()
+	for topic, ps := range partitions {
+		for _, p := range ps {
+			delete(cg.m.paused, topicPartition{topic, p})
+		}
+	}
+	cg.b.notify()
+}
+
+func (cg *ConsumerGroup) PauseAll() {
+	cg.b.mu.Lock()
+	defer cg.b.mu.Unlock()
+	cg.m.pauseAll = true
+	cg.b.notify()
+}
+
+func (cg *ConsumerGroup) ResumeAll() {
+	cg.b.mu.Lock()
+	defer cg.b.mu.Unlock()
+	cg.m.pauseAll = false
+	cg.m.paused = make(map[topicPartition]bool)
+	cg.b.notify()
+}
+
+// session is sarama.ConsumerGroupSession of ConsumerGroup.
+type session struct {
+	ctx        context.Context
+	cg         *ConsumerGroup
+	generation int32
+	claims     map[string][]int32
+
+	// marked is guarded by the mutex of the broker
+	marked map[topicPartition]int64
+}
+
+func (s *session) Claims() map[string][]int32 {
+	res := make(map[string][]int32, len(s.claims))
+	for t, ps := range s.claims {
+		res[t] = sortedPartitions(append([]int32(nil), ps...))
+	}
+	return res
+}
+
+func (s *session) MemberID() string         { return s.cg.m.id }
+func (s *session) GenerationID() int32      { return s.generation }
+func (s *session) Context() context.Context { return s.ctx }
+
+func (s *session) mark(tp topicPartition, offset int64, reset bool) {
+	b := s.cg.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if cur, ok := s.marked[tp]; ok && !reset && offset <= cur {
+		return
+	}
+	s.marked[tp] = offset
+	if s.cg.config.Consumer.Offsets.AutoCommit.Enable {
+		b.commitOffset(s.cg.group, s.generation, tp, offset)
+	}
+}
+
+func (s *session) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	s.mark(topicPartition{topic, partition}, offset, false)
+}
+
+func (s *session) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+	s.mark(topicPartition{topic, partition}, offset, true)
+}
+
+func (s *session) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
+
+func (s *session) Commit() {
+	b := s.cg.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for tp, o := range s.marked {
+		b.commitOffset(s.cg.group, s.generation, tp, o)
+	}
+}
+
+// claim is sarama.ConsumerGroupClaim fed from a partition of Broker.
+type claim struct {
+	b        *Broker
+	tp       topicPartition
+	initial  int64
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *claim) Topic() string                            { return c.tp.topic }
+func (c *claim) Partition() int32                         { return c.tp.partition }
+func (c *claim) InitialOffset() int64                     { return c.initial }
+func (c *claim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+func (c *claim) HighWaterMarkOffset() int64 {
+	return c.b.HighWaterMark(c.tp.topic, c.tp.partition)
+}
+
+// feed sends messages of the partition to c until ctx is done, waiting while the partition is paused by m.
+func (c *claim) feed(ctx context.Context, m *member) {
+	defer close(c.messages)
+
+	offset := c.initial
+	for ctx.Err() == nil {
+		c.b.mu.Lock()
+		var msg *sarama.ConsumerMessage
+		ps := c.b.topics[c.tp.topic][c.tp.partition]
+		if !m.isPaused(c.tp) && offset < int64(len(ps)) {
+			msg = ps[offset]
+		}
+		changed := c.b.changed
+		c.b.mu.Unlock()
+
+		if msg == nil {
+			select {
+			case <-changed:
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		offset++
+		cm := *msg
+		select {
+		case c.messages <- &cm:
+		case <-ctx.Done():
+		}
+	}
+}
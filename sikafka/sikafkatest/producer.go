@@ -0,0 +1,39 @@
+package sikafkatest
+
+import (
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+)
+
+// topicConfig returns mocks.TopicConfig with the partitions of the topics of b, so that mock producers partition
+// messages as b does. b.mu must be held.
+func (b *Broker) topicConfig() *mocks.TopicConfig {
+	tc := mocks.NewTopicConfig()
+	tc.SetDefaultPartitions(DefaultPartitions)
+	partitions := make(map[string]int32, len(b.topics))
+	for topic, ps := range b.topics {
+		partitions[topic] = int32(len(ps))
+	}
+	tc.SetPartitions(partitions)
+	return tc
+}
+
+// NewSyncProducer returns mocks.SyncProducer partitioning messages over the partitions of the topics of b, so create
+// topics before. Set expectations with Deliver to deliver messages to b.
+func (b *Broker) NewSyncProducer(t mocks.ErrorReporter, config *sarama.Config) *mocks.SyncProducer {
+	p := mocks.NewSyncProducer(t, config)
+	b.mu.Lock()
+	p.TopicConfig = b.topicConfig()
+	b.mu.Unlock()
+	return p
+}
+
+// NewAsyncProducer returns mocks.AsyncProducer partitioning messages over the partitions of the topics of b, so
+// create topics before. Set expectations with Deliver to deliver messages to b.
+func (b *Broker) NewAsyncProducer(t mocks.ErrorReporter, config *sarama.Config) *mocks.AsyncProducer {
+	p := mocks.NewAsyncProducer(t, config)
+	b.mu.Lock()
+	p.TopicConfig = b.topicConfig()
+	b.mu.Unlock()
+	return p
+}
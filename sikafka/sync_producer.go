@@ -1,6 +1,7 @@
 package sikafka
 
 import (
+	"context"
 	"time"
 
 	"github.com/IBM/sarama"
@@ -13,10 +14,12 @@ type SyncProducer struct {
 	sarama.SyncProducer
 	topic    string
 	retryMax uint16
+
+	health producerHealth
 }
 
 func NewSyncProducer(producer sarama.SyncProducer, topic string, opts ...SyncProducerOption) *SyncProducer {
-	p := &SyncProducer{producer, topic, defaultRetryMax}
+	p := &SyncProducer{SyncProducer: producer, topic: topic, retryMax: defaultRetryMax}
 	for _, o := range opts {
 		if o == nil {
 			continue
@@ -67,13 +70,26 @@ func (sp *SyncProducer) produce(message *sarama.ProducerMessage) (int32, int64,
 				wait *= 2
 				continue
 			}
+			sp.health.report(err)
 			return partition, offset, err
 		}
+		sp.health.report(nil)
 		return partition, offset, nil
 	}
 	return partition, offset, err
 }
 
+func (sp *SyncProducer) Close() error {
+	sp.health.close()
+	return sp.SyncProducer.Close()
+}
+
+// HealthCheck returns ErrProducerClosed if sp is closed, or the error of the last message if it failed because
+// brokers were unavailable.
+func (sp *SyncProducer) HealthCheck(ctx context.Context) error {
+	return sp.health.check(0)
+}
+
 func isRetryableError(err error) bool {
 	switch err {
 	case sarama.ErrBrokerNotAvailable,
@@ -0,0 +1,144 @@
+package sikafka_test
+
+import (
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/go-wonk/si/v2/sikafka"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockAdmin(t *testing.T, handlers map[string]sarama.MockResponse) (*sikafka.Admin, *sarama.MockBroker) {
+	broker := sarama.NewMockBroker(t, 1)
+	base := map[string]sarama.MockResponse{
+		"ApiVersionsRequest": sarama.NewMockApiVersionsResponse(t),
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetController(broker.BrokerID()).
+			SetLeader("orders", 0, broker.BrokerID()).
+			SetLeader("orders", 1, broker.BrokerID()),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, "grp", broker),
+	}
+	for k, v := range handlers {
+		base[k] = v
+	}
+	broker.SetHandlerByMap(base)
+
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_8_0_0
+	client, err := sarama.NewClient([]string{broker.Addr()}, config)
+	siutils.AssertNilFail(t, err)
+	admin, err := sarama.NewClusterAdminFromClient(client)
+	siutils.AssertNilFail(t, err)
+	return sikafka.NewAdmin(admin, client), broker
+}
+
+func requestsOf[T any](broker *sarama.MockBroker) []T {
+	var res []T
+	for _, rr := range broker.History() {
+		if req, ok := rr.Request.(T); ok {
+			res = append(res, req)
+		}
+	}
+	return res
+}
+
+func TestAdmin_EnsureTopics(t *testing.T) {
+	admin, broker := newMockAdmin(t, map[string]sarama.MockResponse{
+		"DescribeConfigsRequest":         sarama.NewMockDescribeConfigsResponse(t),
+		"CreateTopicsRequest":            sarama.NewMockCreateTopicsResponse(t),
+		"CreatePartitionsRequest":        sarama.NewMockCreatePartitionsResponse(t),
+		"IncrementalAlterConfigsRequest": sarama.NewMockIncrementalAlterConfigsResponse(t),
+	})
+	defer broker.Close()
+	defer admin.Close()
+
+	err := admin.EnsureTopics(
+		sikafka.TopicSpec{Name: "orders", Partitions: 3, Configs: map[string]string{"retention.ms": "1000"}},
+		sikafka.TopicSpec{Name: "users", Partitions: 2, ReplicationFactor: 1, Configs: map[string]string{"cleanup.policy": "compact"}},
+	)
+	siutils.AssertNilFail(t, err)
+
+	creates := requestsOf[*sarama.CreateTopicsRequest](broker)
+	if assert.Len(t, creates, 1) {
+		detail := creates[0].TopicDetails["users"]
+		assert.EqualValues(t, 2, detail.NumPartitions)
+		assert.EqualValues(t, 1, detail.ReplicationFactor)
+		assert.Equal(t, "compact", *detail.ConfigEntries["cleanup.policy"])
+	}
+
+	partitions := requestsOf[*sarama.CreatePartitionsRequest](broker)
+	if assert.Len(t, partitions, 1) {
+		assert.EqualValues(t, 3, partitions[0].TopicPartitions["orders"].Count)
+	}
+
+	alters := requestsOf[*sarama.IncrementalAlterConfigsRequest](broker)
+	if assert.Len(t, alters, 1) {
+		assert.Equal(t, "orders", alters[0].Resources[0].Name)
+		assert.Equal(t, "1000", *alters[0].Resources[0].ConfigEntries["retention.ms"].Value)
+	}
+
+	// configs already set are not altered
+	err = admin.EnsureTopics(sikafka.TopicSpec{Name: "orders", Partitions: 2, Configs: map[string]string{"retention.ms": "5000"}})
+	siutils.AssertNilFail(t, err)
+	assert.Len(t, requestsOf[*sarama.IncrementalAlterConfigsRequest](broker), 1)
+	assert.Len(t, requestsOf[*sarama.CreatePartitionsRequest](broker), 1)
+}
+
+func TestAdmin_GroupLagAndReset(t *testing.T) {
+	// member assignments are encoded by sync group requests
+	sync := &sarama.SyncGroupRequest{}
+	err := sync.AddGroupAssignmentMember("member-1", &sarama.ConsumerGroupMemberAssignment{Topics: map[string][]int32{"orders": {0, 1}}})
+	siutils.AssertNilFail(t, err)
+	assignment := sync.GroupAssignments[0].Assignment
+
+	describe := sarama.NewMockDescribeGroupsResponse(t).AddGroupDescription("grp", &sarama.GroupDescription{
+		GroupId: "grp", State: "Stable", ProtocolType: "consumer", Protocol: "range",
+		Members: map[string]*sarama.GroupMemberDescription{
+			"member-1": {MemberId: "member-1", ClientId: "client", ClientHost: "/127.0.0.1", MemberAssignment: assignment},
+		},
+	})
+	admin, broker := newMockAdmin(t, map[string]sarama.MockResponse{
+		"DescribeGroupsRequest": describe,
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset("grp", "orders", 0, 40, "", sarama.ErrNoError).
+			SetOffset("grp", "orders", 1, -1, "", sarama.ErrNoError),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("orders", 0, sarama.OffsetNewest, 100).
+			SetOffset("orders", 0, sarama.OffsetOldest, 10).
+			SetOffset("orders", 1, sarama.OffsetNewest, 50).
+			SetOffset("orders", 1, sarama.OffsetOldest, 20),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t),
+	})
+	defer broker.Close()
+	defer admin.Close()
+
+	desc, err := admin.DescribeGroup("grp")
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "Stable", desc.State)
+	if assert.Len(t, desc.Members, 1) {
+		assert.Equal(t, "member-1", desc.Members[0].MemberID)
+		assert.Equal(t, map[string][]int32{"orders": {0, 1}}, desc.Members[0].Assignments)
+	}
+
+	lag, err := admin.GroupLag("grp", "orders")
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, sikafka.PartitionLag{Committed: 40, HighWaterMark: 100, Lag: 60}, lag["orders"][0])
+	assert.Equal(t, sikafka.PartitionLag{Committed: -1, HighWaterMark: 50, Lag: 30}, lag["orders"][1])
+
+	// a group with active members cannot be reset
+	_, err = admin.ResetGroupOffsets("grp", []string{"orders"}, sarama.OffsetOldest)
+	assert.ErrorIs(t, err, sikafka.ErrGroupNotEmpty)
+
+	describe.AddGroupDescription("grp", &sarama.GroupDescription{GroupId: "grp", State: "Empty"})
+	offsets, err := admin.ResetGroupOffsets("grp", []string{"orders"}, sarama.OffsetOldest)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, map[string]map[int32]int64{"orders": {0: 10, 1: 20}}, offsets)
+
+	commits := requestsOf[*sarama.OffsetCommitRequest](broker)
+	if assert.Len(t, commits, 1) {
+		assert.Equal(t, "grp", commits[0].ConsumerGroup)
+	}
+}
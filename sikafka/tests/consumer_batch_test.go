@@ -0,0 +1,125 @@
+package sikafka_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/go-wonk/si/v2/sikafka"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+)
+
+type batchHandlerFunc func(msgs []*sarama.ConsumerMessage) error
+
+func (f batchHandlerFunc) HandleBatch(msgs []*sarama.ConsumerMessage) error {
+	return f(msgs)
+}
+
+func TestBatchCgConsumer_size(t *testing.T) {
+	var sizes []int
+	c, err := sikafka.NewBatchCgConsumer(batchHandlerFunc(func(msgs []*sarama.ConsumerMessage) error {
+		sizes = append(sizes, len(msgs))
+		return nil
+	}), 3, time.Minute)
+	siutils.AssertNilFail(t, err)
+
+	session := newFakeSession(context.Background())
+	siutils.AssertNilFail(t, c.ConsumeClaim(session, newFakeClaim("orders", 0, nil, []string{"a", "b", "c", "d", "e", "f", "g"})))
+	assert.Equal(t, []int{3, 3, 1}, sizes)
+	assert.EqualValues(t, 7, session.Marked("orders", 0))
+}
+
+func TestBatchCgConsumer_maxWait(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	c, err := sikafka.NewBatchCgConsumer(batchHandlerFunc(func(msgs []*sarama.ConsumerMessage) error {
+		mu.Lock()
+		sizes = append(sizes, len(msgs))
+		mu.Unlock()
+		return nil
+	}), 10, 20*time.Millisecond)
+	siutils.AssertNilFail(t, err)
+
+	session := newFakeSession(context.Background())
+	claim := &fakeClaim{topic: "orders", messages: make(chan *sarama.ConsumerMessage, 2)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "orders", Offset: 0}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "orders", Offset: 1}
+
+	done := make(chan error)
+	go func() {
+		done <- c.ConsumeClaim(session, claim)
+	}()
+	assert.Eventually(t, func() bool { return session.Marked("orders", 0) == 2 }, time.Second, time.Millisecond)
+	close(claim.messages)
+	siutils.AssertNilFail(t, <-done)
+	assert.Equal(t, []int{2}, sizes)
+}
+
+func TestBatchCgConsumer_partialFailure(t *testing.T) {
+	dlq := make(chan *sarama.ProducerMessage, 1)
+	producer := mocks.NewSyncProducer(t, mocks.NewTestConfig())
+	defer producer.Close()
+	producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		dlq <- msg
+		return nil
+	})
+
+	var batches [][]string
+	c, err := sikafka.NewBatchCgConsumer(batchHandlerFunc(func(msgs []*sarama.ConsumerMessage) error {
+		var values []string
+		batchErr := &sikafka.BatchError{}
+		for _, msg := range msgs {
+			values = append(values, string(msg.Value))
+			if string(msg.Value) == "bad" {
+				batchErr.Add(msg, errors.New("invalid record"))
+			}
+		}
+		batches = append(batches, values)
+		return batchErr.Err()
+	}), 3, 0, sikafka.WithHandlerRetry(2, time.Millisecond, time.Millisecond), sikafka.WithDeadLetterTopic(producer, ""))
+	siutils.AssertNilFail(t, err)
+
+	session := newFakeSession(context.Background())
+	siutils.AssertNilFail(t, c.ConsumeClaim(session, newFakeClaim("orders", 0, nil, []string{"a", "bad", "c"})))
+
+	// only the failed message is retried, then forwarded to the dead letter topic
+	assert.Equal(t, [][]string{{"a", "bad", "c"}, {"bad"}}, batches)
+	assert.EqualValues(t, 3, session.Marked("orders", 0))
+	msg := <-dlq
+	assert.Equal(t, "orders.dlq", msg.Topic)
+	assert.Equal(t, "invalid record", headerValue(msg, sikafka.HeaderError))
+	assert.Equal(t, "1", headerValue(msg, sikafka.HeaderOriginalOffset))
+	assert.Equal(t, "2", headerValue(msg, sikafka.HeaderAttempts))
+}
+
+func TestBatchCgConsumer_failureNotMarked(t *testing.T) {
+	c, err := sikafka.NewBatchCgConsumer(batchHandlerFunc(func(msgs []*sarama.ConsumerMessage) error {
+		if string(msgs[0].Value) == "0" {
+			return errors.New("database is down")
+		}
+		return nil
+	}), 2, 0)
+	siutils.AssertNilFail(t, err)
+
+	session := newFakeSession(context.Background())
+	values := make([]string, 4)
+	for i := range values {
+		values[i] = strconv.Itoa(i)
+	}
+	// the session ends at the failed batch, so the batch after it is not marked
+	err = c.ConsumeClaim(session, newFakeClaim("orders", 0, nil, values))
+	assert.EqualError(t, err, "database is down")
+	assert.EqualValues(t, 0, session.Marked("orders", 0))
+
+	var batchErr *sikafka.BatchError
+	err = error(&sikafka.BatchError{Errors: []*sikafka.MessageError{{Message: &sarama.ConsumerMessage{Topic: "orders"}, Err: context.Canceled}}})
+	assert.True(t, errors.As(err, &batchErr))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, (&sikafka.BatchError{}).Err())
+}
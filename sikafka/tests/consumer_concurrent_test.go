@@ -0,0 +1,153 @@
+package sikafka_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/go-wonk/si/v2/sikafka"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCgConsumer_concurrency(t *testing.T) {
+	const n = 200
+	keys := make([]string, n)
+	values := make([]string, n)
+	for i := 0; i < n; i++ {
+		keys[i] = "key-" + strconv.Itoa(i%10)
+		values[i] = strconv.Itoa(i)
+	}
+
+	var mu sync.Mutex
+	order := make(map[string][]int)
+	var running, maxRunning int32
+	c, err := sikafka.NewCgConsumerWithOptions(handlerFunc(func(msg *sarama.ConsumerMessage) error {
+		r := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if r <= m || atomic.CompareAndSwapInt32(&maxRunning, m, r) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+
+		v, _ := strconv.Atoi(string(msg.Value))
+		mu.Lock()
+		order[string(msg.Key)] = append(order[string(msg.Key)], v)
+		mu.Unlock()
+		return nil
+	}), sikafka.WithConcurrency(4, 8))
+	siutils.AssertNilFail(t, err)
+
+	session := newFakeSession(context.Background())
+	siutils.AssertNilFail(t, c.ConsumeClaim(session, newFakeClaim("orders", 0, keys, values)))
+
+	assert.EqualValues(t, n, session.Marked("orders", 0))
+	assert.Greater(t, maxRunning, int32(1))
+	assert.LessOrEqual(t, maxRunning, int32(4))
+	for key, vs := range order {
+		assert.Len(t, vs, n/10, key)
+		for i := 1; i < len(vs); i++ {
+			assert.Less(t, vs[i-1], vs[i], key)
+		}
+	}
+}
+
+func TestCgConsumer_concurrencyMarksLowestOffset(t *testing.T) {
+	release := make(chan struct{})
+	var handled int32
+	c, err := sikafka.NewCgConsumerWithOptions(handlerFunc(func(msg *sarama.ConsumerMessage) error {
+		if msg.Offset == 1 {
+			<-release
+		}
+		atomic.AddInt32(&handled, 1)
+		return nil
+	}), sikafka.WithConcurrency(3, 3))
+	siutils.AssertNilFail(t, err)
+
+	session := newFakeSession(context.Background())
+	claim := &fakeClaim{topic: "orders", messages: make(chan *sarama.ConsumerMessage, 10)}
+	for i := 0; i < 5; i++ {
+		claim.messages <- &sarama.ConsumerMessage{Topic: "orders", Offset: int64(i)}
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- c.ConsumeClaim(session, claim)
+	}()
+
+	// messages without keys are spread by offsets, offset 1 blocks offset 4 in its lane and holds back marking
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&handled) == 3 }, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	assert.EqualValues(t, 3, atomic.LoadInt32(&handled))
+	assert.EqualValues(t, 1, session.Marked("orders", 0))
+
+	close(release)
+	close(claim.messages)
+	siutils.AssertNilFail(t, <-done)
+	assert.EqualValues(t, 5, atomic.LoadInt32(&handled))
+	assert.EqualValues(t, 5, session.Marked("orders", 0))
+}
+
+func TestCgConsumer_concurrencyForwardFailed(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, mocks.NewTestConfig())
+	defer producer.Close()
+	producer.ExpectSendMessageAndFail(sarama.ErrNotLeaderForPartition)
+
+	c, err := sikafka.NewCgConsumerWithOptions(handlerFunc(func(msg *sarama.ConsumerMessage) error {
+		if msg.Offset == 1 {
+			return errors.New("permanent")
+		}
+		return nil
+	}), sikafka.WithConcurrency(2, 2), sikafka.WithDeadLetterTopic(producer, ""))
+	siutils.AssertNilFail(t, err)
+
+	values := make([]string, 10)
+	for i := range values {
+		values[i] = strconv.Itoa(i)
+	}
+	session := newFakeSession(context.Background())
+	err = c.ConsumeClaim(session, newFakeClaim("orders", 0, nil, values))
+	assert.ErrorIs(t, err, sikafka.ErrForwardFailed)
+	// offset 0 may not be handled before the session ends, but nothing after offset 1 is marked
+	assert.LessOrEqual(t, session.Marked("orders", 0), int64(1))
+}
+
+func TestCgConsumer_concurrencySessionDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	c, err := sikafka.NewCgConsumerWithOptions(handlerFunc(func(msg *sarama.ConsumerMessage) error {
+		close(started)
+		<-ctx.Done()
+		return nil
+	}), sikafka.WithConcurrency(2, 4))
+	siutils.AssertNilFail(t, err)
+
+	session := newFakeSession(ctx)
+	claim := &fakeClaim{topic: "orders", messages: make(chan *sarama.ConsumerMessage, 2)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "orders", Offset: 0, Key: []byte("a")}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "orders", Offset: 1, Key: []byte("a")}
+
+	done := make(chan error)
+	go func() {
+		done <- c.ConsumeClaim(session, claim)
+	}()
+	<-started
+	cancel()
+	siutils.AssertNilFail(t, <-done)
+	assert.EqualValues(t, 0, session.Marked("orders", 0))
+}
+
+func TestWithConcurrency_invalidLanes(t *testing.T) {
+	c, err := sikafka.NewCgConsumerWithOptions(nil, sikafka.WithConcurrency(0, 8))
+	assert.NotNil(t, err)
+	assert.Nil(t, c)
+}
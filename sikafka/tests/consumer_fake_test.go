@@ -0,0 +1,204 @@
+package sikafka_test
+
+import (
+	"context"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+// fakeSession is sarama.ConsumerGroupSession recording marked offsets.
+type fakeSession struct {
+	ctx    context.Context
+	claims map[string][]int32
+
+	mu     sync.Mutex
+	marked map[string]map[int32]int64
+}
+
+func newFakeSession(ctx context.Context) *fakeSession {
+	return &fakeSession{ctx: ctx, marked: make(map[string]map[int32]int64)}
+}
+
+func (s *fakeSession) Claims() map[string][]int32 { return s.claims }
+func (s *fakeSession) MemberID() string           { return "member" }
+func (s *fakeSession) GenerationID() int32        { return 1 }
+func (s *fakeSession) Commit()                    {}
+func (s *fakeSession) Context() context.Context   { return s.ctx }
+
+func (s *fakeSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.marked[topic] == nil {
+		s.marked[topic] = make(map[int32]int64)
+	}
+	if offset > s.marked[topic][partition] {
+		s.marked[topic][partition] = offset
+	}
+}
+
+func (s *fakeSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {}
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
+
+// Marked returns the next offset to consume marked for topic and partition.
+func (s *fakeSession) Marked(topic string, partition int32) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.marked[topic][partition]
+}
+
+// fakeClaim is sarama.ConsumerGroupClaim of messages.
+type fakeClaim struct {
+	topic     string
+	partition int32
+	messages  chan *sarama.ConsumerMessage
+	hwm       int64
+}
+
+// newFakeClaim returns a claim with values as messages from offset 0. Messages channel is closed after values.
+func newFakeClaim(topic string, partition int32, keys []string, values []string) *fakeClaim {
+	c := &fakeClaim{topic: topic, partition: partition, messages: make(chan *sarama.ConsumerMessage, len(values)),
+		hwm: int64(len(values))}
+	for i, v := range values {
+		msg := &sarama.ConsumerMessage{Topic: topic, Partition: partition, Offset: int64(i), Value: []byte(v)}
+		if keys != nil {
+			msg.Key = []byte(keys[i])
+		}
+		c.messages <- msg
+	}
+	close(c.messages)
+	return c
+}
+
+func (c *fakeClaim) Topic() string                            { return c.topic }
+func (c *fakeClaim) Partition() int32                         { return c.partition }
+func (c *fakeClaim) InitialOffset() int64                     { return 0 }
+func (c *fakeClaim) HighWaterMarkOffset() int64               { return c.hwm }
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage { return c.messages }
+
+// fakeConsumerGroup is sarama.ConsumerGroup of a single member claiming partitions of topics. The claims of a
+// session receive messages sent to Send.
+type fakeConsumerGroup struct {
+	partitions int32
+	hwm        int64
+
+	mu       sync.Mutex
+	errs     []error
+	calls    int
+	closed   bool
+	paused   map[string]map[int32]bool
+	claims   map[string]map[int32]*fakeClaim
+	sessions chan struct{}
+}
+
+func newFakeConsumerGroup(partitions int32, hwm int64, errs ...error) *fakeConsumerGroup {
+	return &fakeConsumerGroup{partitions: partitions, hwm: hwm, errs: errs, paused: make(map[string]map[int32]bool),
+		sessions: make(chan struct{}, 10)}
+}
+
+func (g *fakeConsumerGroup) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
+	g.mu.Lock()
+	g.calls++
+	if g.closed {
+		g.mu.Unlock()
+		return sarama.ErrClosedConsumerGroup
+	}
+	if len(g.errs) > 0 {
+		err := g.errs[0]
+		g.errs = g.errs[1:]
+		g.mu.Unlock()
+		return err
+	}
+	session := newFakeSession(ctx)
+	session.claims = make(map[string][]int32)
+	g.claims = make(map[string]map[int32]*fakeClaim)
+	for _, t := range topics {
+		g.claims[t] = make(map[int32]*fakeClaim)
+		for p := int32(0); p < g.partitions; p++ {
+			session.claims[t] = append(session.claims[t], p)
+			g.claims[t][p] = &fakeClaim{topic: t, partition: p, messages: make(chan *sarama.ConsumerMessage, 100), hwm: g.hwm}
+		}
+	}
+	claims := g.claims
+	g.mu.Unlock()
+
+	if err := handler.Setup(session); err != nil {
+		return err
+	}
+	var wg sync.WaitGroup
+	for _, ps := range claims {
+		for _, c := range ps {
+			wg.Add(1)
+			go func(c *fakeClaim) {
+				defer wg.Done()
+				_ = handler.ConsumeClaim(session, c)
+			}(c)
+		}
+	}
+	g.sessions <- struct{}{}
+	<-ctx.Done()
+	wg.Wait()
+	return handler.Cleanup(session)
+}
+
+// Send sends msg to the claim of its topic and partition in the current session.
+func (g *fakeConsumerGroup) Send(msg *sarama.ConsumerMessage) {
+	g.mu.Lock()
+	c := g.claims[msg.Topic][msg.Partition]
+	g.mu.Unlock()
+	c.messages <- msg
+}
+
+func (g *fakeConsumerGroup) Calls() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.calls
+}
+
+func (g *fakeConsumerGroup) IsPaused(topic string, partition int32) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused[topic][partition]
+}
+
+func (g *fakeConsumerGroup) setPaused(partitions map[string][]int32, paused bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for t, ps := range partitions {
+		if g.paused[t] == nil {
+			g.paused[t] = make(map[int32]bool)
+		}
+		for _, p := range ps {
+			g.paused[t][p] = paused
+		}
+	}
+}
+
+func (g *fakeConsumerGroup) allPartitions() map[string][]int32 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	res := make(map[string][]int32)
+	for t, ps := range g.claims {
+		for p := range ps {
+			res[t] = append(res[t], p)
+		}
+	}
+	return res
+}
+
+func (g *fakeConsumerGroup) Errors() <-chan error { return nil }
+
+func (g *fakeConsumerGroup) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closed = true
+	return nil
+}
+
+func (g *fakeConsumerGroup) Pause(partitions map[string][]int32)  { g.setPaused(partitions, true) }
+func (g *fakeConsumerGroup) Resume(partitions map[string][]int32) { g.setPaused(partitions, false) }
+func (g *fakeConsumerGroup) PauseAll()                            { g.setPaused(g.allPartitions(), true) }
+func (g *fakeConsumerGroup) ResumeAll()                           { g.setPaused(g.allPartitions(), false) }
@@ -0,0 +1,135 @@
+package sikafka_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/go-wonk/si/v2/sikafka"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsumerGroup_Run(t *testing.T) {
+	group := newFakeConsumerGroup(2, 10)
+	consumer := sikafka.NewCgConsumer(handlerFunc(func(msg *sarama.ConsumerMessage) error { return nil }))
+	cg := sikafka.NewConsumerGroup(group, consumer, []string{"orders"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- cg.Run(ctx)
+	}()
+	<-group.sessions
+	assert.ErrorIs(t, cg.Run(context.Background()), sikafka.ErrConsumerGroupRunning)
+
+	group.Send(&sarama.ConsumerMessage{Topic: "orders", Partition: 1, Offset: 3})
+	assert.Eventually(t, func() bool {
+		return cg.Health().Lag["orders"][1] == 6
+	}, time.Second, time.Millisecond)
+
+	h := cg.Health()
+	assert.True(t, h.Running)
+	assert.Equal(t, "member", h.MemberID)
+	assert.Equal(t, map[string][]int32{"orders": {0, 1}}, h.Assignments)
+	assert.EqualValues(t, 10, h.Lag["orders"][0])
+	assert.EqualValues(t, 16, h.TotalLag())
+	assert.Nil(t, h.Err)
+
+	cancel()
+	siutils.AssertNilFail(t, <-done)
+	assert.False(t, cg.Health().Running)
+	assert.ErrorIs(t, cg.Run(context.Background()), sarama.ErrClosedConsumerGroup)
+}
+
+func TestConsumerGroup_Pause(t *testing.T) {
+	group := newFakeConsumerGroup(2, 0)
+	consumer := sikafka.NewCgConsumer(handlerFunc(func(msg *sarama.ConsumerMessage) error { return nil }))
+	cg := sikafka.NewConsumerGroup(group, consumer, []string{"orders", "users"})
+
+	// pauses before the session are applied to claims
+	cg.PauseTopics("users")
+	cg.Pause(map[string][]int32{"orders": {1}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- cg.Run(ctx)
+	}()
+	<-group.sessions
+
+	assert.Eventually(t, func() bool {
+		return group.IsPaused("users", 0) && group.IsPaused("users", 1) && group.IsPaused("orders", 1)
+	}, time.Second, time.Millisecond)
+	assert.False(t, group.IsPaused("orders", 0))
+	assert.Equal(t, map[string][]int32{"orders": {1}, "users": {0, 1}}, cg.Health().Paused)
+
+	cg.ResumeTopics("users")
+	assert.False(t, group.IsPaused("users", 0))
+	assert.Equal(t, map[string][]int32{"orders": {1}}, cg.Health().Paused)
+
+	cg.Toggle()
+	assert.True(t, group.IsPaused("orders", 0))
+	assert.Len(t, cg.Health().Paused, 2)
+	cg.Toggle()
+	assert.False(t, group.IsPaused("orders", 1))
+	assert.Empty(t, cg.Health().Paused)
+
+	cancel()
+	siutils.AssertNilFail(t, <-done)
+}
+
+func TestConsumerGroup_retry(t *testing.T) {
+	errConsume := errors.New("coordinator not available")
+
+	group := newFakeConsumerGroup(1, 0, errConsume, errConsume)
+	consumer := sikafka.NewCgConsumer(handlerFunc(func(msg *sarama.ConsumerMessage) error { return nil }))
+	cg, err := sikafka.NewConsumerGroupWithOptions(group, consumer, []string{"orders"},
+		sikafka.WithConsumeRetry(3, time.Millisecond, 2*time.Millisecond))
+	siutils.AssertNilFail(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- cg.Run(ctx)
+	}()
+	<-group.sessions
+	assert.Equal(t, 3, group.Calls())
+	cancel()
+	siutils.AssertNilFail(t, <-done)
+
+	group = newFakeConsumerGroup(1, 0, errConsume, errConsume)
+	consumer = sikafka.NewCgConsumer(nil)
+	cg, err = sikafka.NewConsumerGroupWithOptions(group, consumer,
+		[]string{"orders"}, sikafka.WithConsumeRetry(2, time.Millisecond, time.Millisecond))
+	siutils.AssertNilFail(t, err)
+	assert.ErrorIs(t, cg.Run(context.Background()), errConsume)
+	assert.ErrorIs(t, cg.Health().Err, errConsume)
+
+	// without maxBackoff the backoff keeps doubling
+	group = newFakeConsumerGroup(1, 0, errConsume, errConsume)
+	consumer = sikafka.NewCgConsumer(nil)
+	cg, err = sikafka.NewConsumerGroupWithOptions(group, consumer, []string{"orders"},
+		sikafka.WithConsumeRetry(0, 5*time.Millisecond, 0))
+	siutils.AssertNilFail(t, err)
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		done <- cg.Run(ctx)
+	}()
+	start := time.Now()
+	<-group.sessions
+	assert.GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+	assert.Equal(t, 3, group.Calls())
+	cancel()
+	siutils.AssertNilFail(t, <-done)
+}
+
+func TestNewConsumerGroup_invalidOption(t *testing.T) {
+	consumer := sikafka.NewCgConsumer(nil)
+	cg, err := sikafka.NewConsumerGroupWithOptions(newFakeConsumerGroup(1, 0), consumer, []string{"orders"},
+		sikafka.WithConsumeRetry(3, -time.Second, 0))
+	assert.NotNil(t, err)
+	assert.Nil(t, cg)
+}
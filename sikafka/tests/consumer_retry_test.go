@@ -0,0 +1,155 @@
+package sikafka_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/go-wonk/si/v2/sikafka"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+)
+
+type handlerFunc func(msg *sarama.ConsumerMessage) error
+
+func (f handlerFunc) Handle(msg *sarama.ConsumerMessage) error {
+	return f(msg)
+}
+
+func TestRetryTopicName(t *testing.T) {
+	assert.Equal(t, "orders.retry.1m", sikafka.RetryTopicName("orders", time.Minute))
+	assert.Equal(t, "orders.retry.10m", sikafka.RetryTopicName("orders", 10*time.Minute))
+	assert.Equal(t, "orders.retry.2h", sikafka.RetryTopicName("orders", 2*time.Hour))
+	assert.Equal(t, "orders.retry.1500ms", sikafka.RetryTopicName("orders", 1500*time.Millisecond))
+
+	producer := mocks.NewSyncProducer(t, mocks.NewTestConfig())
+	defer producer.Close()
+	c, err := sikafka.NewCgConsumerWithOptions(nil, sikafka.WithRetryTopics(producer, time.Minute, 10*time.Minute))
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, []string{"orders", "orders.retry.1m", "orders.retry.10m"}, c.Topics("orders"))
+}
+
+func TestNewCgConsumer_invalidOption(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, mocks.NewTestConfig())
+	defer producer.Close()
+
+	for _, opt := range []sikafka.CgConsumerOption{
+		sikafka.WithHandlerRetry(3, -time.Second, 0),
+		sikafka.WithRetryTopics(nil, time.Minute),
+		sikafka.WithRetryTopics(producer, time.Minute, 0),
+		sikafka.WithDeadLetterTopic(nil, ""),
+	} {
+		c, err := sikafka.NewCgConsumerWithOptions(nil, opt)
+		assert.NotNil(t, err)
+		assert.Nil(t, c)
+	}
+
+	c, err := sikafka.NewBatchCgConsumer(nil, 10, 0, sikafka.WithDeadLetterTopic(nil, ""))
+	assert.NotNil(t, err)
+	assert.Nil(t, c)
+}
+
+func TestCgConsumer_handlerRetry(t *testing.T) {
+	calls := 0
+	c, err := sikafka.NewCgConsumerWithOptions(handlerFunc(func(msg *sarama.ConsumerMessage) error {
+		calls++
+		if calls < 3 {
+			return errors.New("temporary")
+		}
+		return nil
+	}), sikafka.WithHandlerRetry(3, time.Millisecond, 2*time.Millisecond))
+	siutils.AssertNilFail(t, err)
+
+	session := newFakeSession(context.Background())
+	siutils.AssertNilFail(t, c.ConsumeClaim(session, newFakeClaim("orders", 0, nil, []string{"a"})))
+	assert.Equal(t, 3, calls)
+	assert.EqualValues(t, 1, session.Marked("orders", 0))
+}
+
+func headerValue(msg *sarama.ProducerMessage, key string) string {
+	for _, h := range msg.Headers {
+		if string(h.Key) == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func TestCgConsumer_retryTopicsAndDeadLetter(t *testing.T) {
+	sent := make(chan *sarama.ProducerMessage, 2)
+	producer := mocks.NewSyncProducer(t, mocks.NewTestConfig())
+	defer producer.Close()
+	for i := 0; i < 2; i++ {
+		producer.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+			sent <- msg
+			return nil
+		})
+	}
+
+	c, err := sikafka.NewCgConsumerWithOptions(handlerFunc(func(msg *sarama.ConsumerMessage) error {
+		return errors.New("permanent")
+	}), sikafka.WithHandlerRetry(2, time.Millisecond, time.Millisecond),
+		sikafka.WithRetryTopics(producer, 10*time.Millisecond),
+		sikafka.WithDeadLetterTopic(producer, ""))
+	siutils.AssertNilFail(t, err)
+
+	// the original message goes to the retry topic
+	session := newFakeSession(context.Background())
+	claim := &fakeClaim{topic: "orders", messages: make(chan *sarama.ConsumerMessage, 1)}
+	claim.messages <- &sarama.ConsumerMessage{Topic: "orders", Partition: 2, Offset: 7, Value: []byte("a"),
+		Headers: []*sarama.RecordHeader{{Key: []byte("trace-id"), Value: []byte("t1")}}}
+	close(claim.messages)
+	siutils.AssertNilFail(t, c.ConsumeClaim(session, claim))
+	assert.EqualValues(t, 8, session.Marked("orders", 2))
+
+	retry := <-sent
+	assert.Equal(t, "orders.retry.10ms", retry.Topic)
+	assert.Equal(t, "t1", headerValue(retry, "trace-id"))
+	assert.Equal(t, "orders", headerValue(retry, sikafka.HeaderOriginalTopic))
+	assert.Equal(t, "2", headerValue(retry, sikafka.HeaderOriginalPartition))
+	assert.Equal(t, "7", headerValue(retry, sikafka.HeaderOriginalOffset))
+	assert.Equal(t, "permanent", headerValue(retry, sikafka.HeaderError))
+	assert.Equal(t, "2", headerValue(retry, sikafka.HeaderAttempts))
+
+	// the message from the retry topic is handled after the delay and goes to the dead letter topic
+	headers := make([]*sarama.RecordHeader, len(retry.Headers))
+	for i := range retry.Headers {
+		headers[i] = &retry.Headers[i]
+	}
+	claim = &fakeClaim{topic: retry.Topic, messages: make(chan *sarama.ConsumerMessage, 1)}
+	start := time.Now()
+	claim.messages <- &sarama.ConsumerMessage{Topic: retry.Topic, Offset: 0, Value: []byte("a"), Headers: headers,
+		Timestamp: start}
+	close(claim.messages)
+	siutils.AssertNilFail(t, c.ConsumeClaim(session, claim))
+	assert.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+
+	dlq := <-sent
+	assert.Equal(t, "orders.dlq", dlq.Topic)
+	assert.Equal(t, "4", headerValue(dlq, sikafka.HeaderAttempts))
+	assert.Equal(t, "7", headerValue(dlq, sikafka.HeaderOriginalOffset))
+	assert.Equal(t, "t1", headerValue(dlq, "trace-id"))
+}
+
+func TestCgConsumer_forwardFailed(t *testing.T) {
+	producer := mocks.NewSyncProducer(t, mocks.NewTestConfig())
+	defer producer.Close()
+	producer.ExpectSendMessageAndFail(sarama.ErrNotLeaderForPartition)
+
+	c, err := sikafka.NewCgConsumerWithOptions(handlerFunc(func(msg *sarama.ConsumerMessage) error {
+		if msg.Offset == 1 {
+			return errors.New("permanent")
+		}
+		return nil
+	}), sikafka.WithDeadLetterTopic(producer, ""))
+	siutils.AssertNilFail(t, err)
+
+	// the session ends at the message not forwarded, so the message after it is not marked
+	session := newFakeSession(context.Background())
+	err = c.ConsumeClaim(session, newFakeClaim("orders", 0, nil, []string{"a", "b", "c"}))
+	assert.ErrorIs(t, err, sikafka.ErrForwardFailed)
+	assert.EqualValues(t, 1, session.Marked("orders", 0))
+}
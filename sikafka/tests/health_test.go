@@ -0,0 +1,69 @@
+package sikafka_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/go-wonk/si/v2/sikafka"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncProducer_HealthCheck(t *testing.T) {
+	mp := mocks.NewSyncProducer(t, mocks.NewTestConfig())
+	mp.ExpectSendMessageAndFail(sarama.ErrMessageSizeTooLarge)
+	mp.ExpectSendMessageAndFail(sarama.ErrOutOfBrokers)
+	mp.ExpectSendMessageAndSucceed()
+	p := sikafka.NewSyncProducer(mp, "orders")
+
+	// failures of messages do not make the producer unhealthy
+	_, _, err := p.Produce(nil, []byte("v"))
+	assert.ErrorIs(t, err, sarama.ErrMessageSizeTooLarge)
+	assert.Nil(t, p.HealthCheck(context.Background()))
+
+	_, _, err = p.Produce(nil, []byte("v"))
+	assert.ErrorIs(t, err, sarama.ErrOutOfBrokers)
+	assert.ErrorIs(t, p.HealthCheck(context.Background()), sarama.ErrOutOfBrokers)
+
+	_, _, err = p.Produce(nil, []byte("v"))
+	siutils.AssertNilFail(t, err)
+	assert.Nil(t, p.HealthCheck(context.Background()))
+
+	siutils.AssertNilFail(t, p.Close())
+	assert.ErrorIs(t, p.HealthCheck(context.Background()), sikafka.ErrProducerClosed)
+}
+
+func TestManagedAsyncProducer_HealthCheck(t *testing.T) {
+	mp := newMockAsyncProducer(t)
+	mp.ExpectInputAndFail(errors.New("invalid record"))
+	mp.ExpectInputAndFail(sarama.ErrNotLeaderForPartition)
+	mp.ExpectInputAndSucceed()
+	p, err := sikafka.NewManagedAsyncProducer(mp, "orders")
+	siutils.AssertNilFail(t, err)
+
+	ctx := context.Background()
+	produce := func() {
+		d, err := p.Produce(ctx, nil, []byte("v"))
+		siutils.AssertNilFail(t, err)
+		<-d.Done()
+	}
+	produce()
+	assert.Nil(t, p.HealthCheck(ctx))
+	produce()
+	assert.ErrorIs(t, p.HealthCheck(ctx), sarama.ErrNotLeaderForPartition)
+	produce()
+	assert.Nil(t, p.HealthCheck(ctx))
+
+	siutils.AssertNilFail(t, p.Close(ctx))
+	assert.ErrorIs(t, p.HealthCheck(ctx), sikafka.ErrProducerClosed)
+}
+
+func TestAsyncProducer_HealthCheck(t *testing.T) {
+	p := sikafka.NewAsyncProducer(newMockAsyncProducer(t), "orders")
+	assert.Nil(t, p.HealthCheck(context.Background()))
+	siutils.AssertNilFail(t, p.Close())
+	assert.ErrorIs(t, p.HealthCheck(context.Background()), sikafka.ErrProducerClosed)
+}
@@ -0,0 +1,102 @@
+package sikafka_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/go-wonk/si/v2/sikafka"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockAsyncProducer(t *testing.T) *mocks.AsyncProducer {
+	config := mocks.NewTestConfig()
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	return mocks.NewAsyncProducer(t, config)
+}
+
+func TestManagedAsyncProducer_Delivery(t *testing.T) {
+	mp := newMockAsyncProducer(t)
+	errSend := errors.New("send failed")
+	mp.ExpectInputAndSucceed()
+	mp.ExpectInputAndFail(errSend)
+
+	var reports atomic.Int64
+	p, err := sikafka.NewManagedAsyncProducer(mp, "tp-test",
+		sikafka.WithDeliveryCallback(func(d *sikafka.Delivery) { reports.Add(1) }))
+	siutils.AssertNilFail(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	d, err := p.Produce(ctx, []byte("k"), []byte("v"))
+	siutils.AssertNilFail(t, err)
+	_, offset, err := d.Wait(ctx)
+	siutils.AssertNilFail(t, err)
+	assert.EqualValues(t, 1, offset)
+	assert.Equal(t, "tp-test", d.Message.Topic)
+
+	failed := make(chan error, 1)
+	msg := &sarama.ProducerMessage{Value: sarama.StringEncoder("v"), Metadata: "mine"}
+	err = p.ProduceWithCallback(ctx, msg, func(d *sikafka.Delivery) {
+		failed <- d.Err
+	})
+	siutils.AssertNilFail(t, err)
+	assert.ErrorIs(t, <-failed, errSend)
+	assert.Equal(t, "mine", msg.Metadata)
+
+	siutils.AssertNilFail(t, p.Flush(ctx))
+	assert.EqualValues(t, 0, p.InFlight())
+	assert.EqualValues(t, 2, reports.Load())
+
+	siutils.AssertNilFail(t, p.Close(ctx))
+	_, err = p.Produce(ctx, nil, []byte("v"))
+	assert.ErrorIs(t, err, sikafka.ErrProducerClosed)
+}
+
+func TestManagedAsyncProducer_CloseFlushes(t *testing.T) {
+	mp := newMockAsyncProducer(t)
+	n := 100
+	for i := 0; i < n; i++ {
+		mp.ExpectInputAndSucceed()
+	}
+	p, err := sikafka.NewManagedAsyncProducer(mp, "tp-test")
+	siutils.AssertNilFail(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	deliveries := make([]*sikafka.Delivery, n)
+	for i := 0; i < n; i++ {
+		d, err := p.Produce(ctx, nil, []byte("v"))
+		siutils.AssertNilFail(t, err)
+		deliveries[i] = d
+	}
+	siutils.AssertNilFail(t, p.Close(ctx))
+
+	for _, d := range deliveries {
+		select {
+		case <-d.Done():
+			assert.Nil(t, d.Err)
+		default:
+			t.Fatal("delivery is not reported")
+		}
+	}
+}
+
+func TestNewManagedAsyncProducer_OptionError(t *testing.T) {
+	mp := newMockAsyncProducer(t)
+	defer mp.Close()
+
+	errOption := errors.New("option failed")
+	p, err := sikafka.NewManagedAsyncProducer(mp, "tp-test",
+		sikafka.ManagedAsyncProducerOptionFunc(func(*sikafka.ManagedAsyncProducer) error { return errOption }))
+	assert.ErrorIs(t, err, errOption)
+	assert.Nil(t, p)
+}
@@ -3,7 +3,9 @@ package sikafka_test
 import (
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/IBM/sarama"
 	"github.com/go-wonk/si/v2/sikafka"
 	"github.com/go-wonk/si/v2/siutils"
 )
@@ -35,3 +37,34 @@ func TestProducer_ProduceWithTopic(t *testing.T) {
 	siutils.AssertNilFail(t, err)
 	fmt.Println(p, o)
 }
+
+func TestRetryableAsyncProducer_drainsErrors(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"ApiVersionsRequest": sarama.NewMockApiVersionsResponse(t),
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("orders", 0, broker.BrokerID()),
+		"InitProducerIDRequest": sarama.NewMockInitProducerIDResponse(t),
+		"ProduceRequest": sarama.NewMockProduceResponse(t).
+			SetError("orders", 0, sarama.ErrMessageSizeTooLarge),
+	})
+
+	producer, err := sikafka.RetryableAsyncProducer([]string{broker.Addr()}, "2.8.0", "orders")
+	siutils.AssertNilFail(t, err)
+
+	// more failures than the Errors channel can buffer
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 2100; i++ {
+			producer.Produce(nil, []byte("v"))
+		}
+		done <- producer.Close()
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("producer is blocked")
+	}
+}
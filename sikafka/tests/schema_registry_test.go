@@ -0,0 +1,179 @@
+package sikafka_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-wonk/si/v2/sihttp"
+	"github.com/go-wonk/si/v2/sikafka"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const studentAvroSchemaV2 = `{
+	"type": "record",
+	"name": "Student",
+	"fields": [
+		{"name": "name", "type": "string"},
+		{"name": "age", "type": "int"},
+		{"name": "email", "type": ["null", "string"], "default": null},
+		{"name": "grade", "type": "int", "default": 1}
+	]
+}`
+
+type serdeStudentV2 struct {
+	Name  string `json:"name"`
+	Age   int    `json:"age"`
+	Grade int    `json:"grade"`
+}
+
+func schemaRegistryTestServer(calls *int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(calls, 1)
+		w.Header().Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/subjects/tp-test-value/versions":
+			var s sikafka.Schema
+			json.NewDecoder(r.Body).Decode(&s)
+			if s.Schema == "" {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				w.Write([]byte(`{"error_code":42201,"message":"Invalid schema"}`))
+				return
+			}
+			w.Write([]byte(`{"id":11}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/schemas/ids/11":
+			w.Write([]byte(`{"schema":"{\"type\":\"string\"}"}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/subjects/tp-test-value/versions/latest":
+			w.Write([]byte(`{"subject":"tp-test-value","id":11,"version":2,"schema":"{\"type\":\"string\"}"}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/compatibility/subjects/tp-test-value/versions/latest":
+			w.Write([]byte(`{"is_compatible":true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error_code":40403,"message":"Schema not found"}`))
+		}
+	}))
+}
+
+func TestSchemaRegistryClient(t *testing.T) {
+	var calls int64
+	ts := schemaRegistryTestServer(&calls)
+	defer ts.Close()
+
+	ctx := context.Background()
+	client := sikafka.NewSchemaRegistryClient(sihttp.NewClient(sihttp.DefaultStandardClient(nil), sihttp.WithBaseUrl(ts.URL)))
+
+	id, err := client.Register(ctx, "tp-test-value", &sikafka.Schema{Schema: `{"type":"string"}`})
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, 11, id)
+
+	s, err := client.SchemaByID(ctx, 11)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, `{"type":"string"}`, s.Schema)
+	assert.Equal(t, 11, s.ID)
+
+	s, err = client.LatestSchema(ctx, "tp-test-value")
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, 2, s.Version)
+
+	ok, err := client.CheckCompatibility(ctx, "tp-test-value", &sikafka.Schema{Schema: `{"type":"string"}`})
+	siutils.AssertNilFail(t, err)
+	assert.True(t, ok)
+
+	_, err = client.SchemaByID(ctx, 12)
+	assert.ErrorIs(t, err, sikafka.ErrSchemaNotFound)
+
+	_, err = client.Register(ctx, "tp-test-value", &sikafka.Schema{})
+	regErr, isRegErr := err.(*sikafka.SchemaRegistryError)
+	assert.True(t, isRegErr)
+	assert.Equal(t, 42201, regErr.ErrorCode)
+
+	// immutable results are cached
+	cached := sikafka.NewCachedSchemaRegistry(client)
+	atomic.StoreInt64(&calls, 0)
+	for i := 0; i < 3; i++ {
+		_, err := cached.SchemaByID(ctx, 11)
+		siutils.AssertNilFail(t, err)
+		_, err = cached.Register(ctx, "tp-test-value", &sikafka.Schema{Schema: `{"type":"string"}`})
+		siutils.AssertNilFail(t, err)
+	}
+	assert.EqualValues(t, 2, atomic.LoadInt64(&calls))
+}
+
+func TestMemorySchemaRegistry(t *testing.T) {
+	ctx := context.Background()
+	registry := sikafka.NewMemorySchemaRegistry()
+
+	id1, err := registry.Register(ctx, "tp-test-value", &sikafka.Schema{Schema: studentAvroSchema})
+	siutils.AssertNilFail(t, err)
+	again, err := registry.Register(ctx, "tp-test-value", &sikafka.Schema{Schema: strings.ReplaceAll(studentAvroSchema, "\t", "")})
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, id1, again)
+
+	id2, err := registry.Register(ctx, "tp-test-value", &sikafka.Schema{Schema: studentAvroSchemaV2})
+	siutils.AssertNilFail(t, err)
+	assert.NotEqual(t, id1, id2)
+
+	versions, err := registry.Versions(ctx, "tp-test-value")
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, []int{1, 2}, versions)
+
+	// a field without default cannot be added
+	incompatible := strings.Replace(studentAvroSchemaV2, `{"name": "grade", "type": "int", "default": 1}`,
+		`{"name": "grade", "type": "int", "default": 1}, {"name": "phone", "type": "string"}`, 1)
+	ok, err := registry.CheckCompatibility(ctx, "tp-test-value", &sikafka.Schema{Schema: incompatible})
+	siutils.AssertNilFail(t, err)
+	assert.False(t, ok)
+	_, err = registry.Register(ctx, "tp-test-value", &sikafka.Schema{Schema: incompatible})
+	assert.Error(t, err)
+
+	_, err = registry.LatestSchema(ctx, "unknown-value")
+	assert.ErrorIs(t, err, sikafka.ErrSchemaNotFound)
+}
+
+func TestAvroRegistrySerde(t *testing.T) {
+	registry := sikafka.NewCachedSchemaRegistry(sikafka.NewMemorySchemaRegistry())
+
+	v1, err := sikafka.NewAvroRegistrySerde[serdeStudent](registry, studentAvroSchema)
+	siutils.AssertNilFail(t, err)
+	v2, err := sikafka.NewAvroRegistrySerde[serdeStudentV2](registry, studentAvroSchemaV2)
+	siutils.AssertNilFail(t, err)
+
+	b, err := v1.Serialize("tp-test", serdeStudent{Name: "wonk", Age: 20})
+	siutils.AssertNilFail(t, err)
+	b2, err := v2.Serialize("tp-test", serdeStudentV2{Name: "sandy", Age: 21, Grade: 3})
+	siutils.AssertNilFail(t, err)
+
+	// messages of both versions are decoded with their writer schemas
+	s, err := v2.Deserialize("tp-test", b)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, serdeStudentV2{Name: "wonk", Age: 20}, s)
+	s1, err := v1.Deserialize("tp-test", b2)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "sandy", s1.Name)
+
+	latest, err := registry.LatestSchema(context.Background(), "tp-test-value")
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, 2, latest.Version)
+}
+
+func TestProtobufRegistrySerde(t *testing.T) {
+	registry := sikafka.NewMemorySchemaRegistry()
+	serde, err := sikafka.NewProtobufRegistrySerde[*wrapperspb.StringValue](registry,
+		`syntax = "proto3"; message StringValue { string value = 1; }`, sikafka.WithKeySerde())
+	siutils.AssertNilFail(t, err)
+
+	b, err := serde.Serialize("tp-test", wrapperspb.String("wonk"))
+	siutils.AssertNilFail(t, err)
+	v, err := serde.Deserialize("tp-test", b)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "wonk", v.GetValue())
+
+	subjects, _ := registry.Subjects(context.Background())
+	assert.Equal(t, []string{"tp-test-key"}, subjects)
+}
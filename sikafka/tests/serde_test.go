@@ -0,0 +1,112 @@
+package sikafka_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/go-wonk/si/v2/sikafka"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type serdeStudent struct {
+	Name  string  `json:"name"`
+	Age   int     `json:"age"`
+	Email *string `json:"email"`
+}
+
+const studentAvroSchema = `{
+	"type": "record",
+	"name": "Student",
+	"fields": [
+		{"name": "name", "type": "string"},
+		{"name": "age", "type": "int"},
+		{"name": "email", "type": ["null", "string"], "default": null}
+	]
+}`
+
+func TestWireFormat(t *testing.T) {
+	b := sikafka.EncodeWireFormat(42, []byte("payload"))
+	assert.Equal(t, []byte{0, 0, 0, 0, 42}, b[:5])
+
+	id, payload, err := sikafka.DecodeWireFormat(b)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, 42, id)
+	assert.Equal(t, "payload", string(payload))
+
+	_, _, err = sikafka.DecodeWireFormat([]byte{1, 0, 0, 0, 42})
+	assert.ErrorIs(t, err, sikafka.ErrInvalidWireFormat)
+}
+
+func TestAvroSerde(t *testing.T) {
+	serde, err := sikafka.NewAvroSerde[serdeStudent](7, studentAvroSchema)
+	siutils.AssertNilFail(t, err)
+
+	email := "wonk@example.com"
+	for _, s := range []serdeStudent{{Name: "wonk", Age: 20, Email: &email}, {Name: "sandy", Age: 21}} {
+		b, err := serde.Serialize("tp-test", s)
+		siutils.AssertNilFail(t, err)
+		id, _, _ := sikafka.DecodeWireFormat(b)
+		assert.Equal(t, 7, id)
+
+		decoded, err := serde.Deserialize("tp-test", b)
+		siutils.AssertNilFail(t, err)
+		assert.Equal(t, s, decoded)
+	}
+
+	_, err = serde.Deserialize("tp-test", sikafka.EncodeWireFormat(8, nil))
+	assert.ErrorIs(t, err, sikafka.ErrUnknownSchemaID)
+}
+
+func TestProtobufSerde(t *testing.T) {
+	serde := sikafka.NewProtobufSerde[*wrapperspb.StringValue](3)
+
+	b, err := serde.Serialize("tp-test", wrapperspb.String("wonk"))
+	siutils.AssertNilFail(t, err)
+	// magic byte, schema id and message indexes [0]
+	assert.Equal(t, []byte{0, 0, 0, 0, 3, 0}, b[:6])
+
+	v, err := serde.Deserialize("tp-test", b)
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "wonk", v.GetValue())
+}
+
+func TestTypedProducer(t *testing.T) {
+	mp := mocks.NewSyncProducer(t, mocks.NewTestConfig())
+	mp.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		k, _ := msg.Key.Encode()
+		v, _ := msg.Value.Encode()
+		if string(k) != "10" || string(v) != `{"name":"wonk","age":20,"email":null}` {
+			return errors.New("unexpected message " + string(k) + " " + string(v))
+		}
+		return nil
+	})
+	defer mp.Close()
+
+	p := sikafka.NewTypedProducer[string, serdeStudent](sikafka.NewSyncProducer(mp, "tp-test"),
+		sikafka.StringSerde{}, sikafka.NewJSONSerde[serdeStudent]())
+	_, _, err := p.Produce("10", serdeStudent{Name: "wonk", Age: 20})
+	siutils.AssertNilFail(t, err)
+}
+
+func TestTypedHandler(t *testing.T) {
+	var got *sikafka.TypedMessage[string, serdeStudent]
+	h := sikafka.NewTypedHandler[string, serdeStudent](sikafka.StringSerde{}, sikafka.NewJSONSerde[serdeStudent](),
+		func(msg *sikafka.TypedMessage[string, serdeStudent]) error {
+			got = msg
+			return nil
+		})
+
+	err := h.Handle(&sarama.ConsumerMessage{Topic: "tp-test", Key: []byte("10"), Value: []byte(`{"name":"wonk","age":20}`)})
+	siutils.AssertNilFail(t, err)
+	assert.Equal(t, "10", got.Key)
+	assert.Equal(t, "wonk", got.Value.Name)
+
+	err = h.Handle(&sarama.ConsumerMessage{Topic: "tp-test", Value: []byte(`{`)})
+	var serdeErr *sikafka.SerdeError
+	assert.True(t, errors.As(err, &serdeErr))
+	assert.False(t, serdeErr.Key)
+}
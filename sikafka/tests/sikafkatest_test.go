@@ -0,0 +1,171 @@
+package sikafka_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/go-wonk/si/v2/sikafka"
+	"github.com/go-wonk/si/v2/sikafka/sikafkatest"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func oldestConfig() *sarama.Config {
+	config := sarama.NewConfig()
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	return config
+}
+
+// collector is a MessageHandler collecting values.
+type collector struct {
+	mu     sync.Mutex
+	values []string
+}
+
+func (c *collector) Handle(msg *sarama.ConsumerMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values = append(c.values, string(msg.Value))
+	return nil
+}
+
+func (c *collector) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.values)
+}
+
+// produceValues produces values with keys to topic of broker with sikafka.SyncProducer built on a mock producer.
+func produceValues(t *testing.T, broker *sikafkatest.Broker, topic string, keys, values []string) {
+	mp := broker.NewSyncProducer(t, nil)
+	for range values {
+		mp.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(broker.Deliver)
+	}
+	sp := sikafka.NewSyncProducer(mp, topic)
+	for i, v := range values {
+		var key []byte
+		if keys != nil {
+			key = []byte(keys[i])
+		}
+		_, _, err := sp.Produce(key, []byte(v))
+		siutils.AssertNilFail(t, err)
+	}
+	siutils.AssertNilFail(t, mp.Close())
+}
+
+func TestSikafkatest_producers(t *testing.T) {
+	broker := sikafkatest.NewBroker()
+	broker.CreateTopic("orders", 3)
+
+	produceValues(t, broker, "orders", []string{"k1", "k1"}, []string{"v1", "v2"})
+	partition := broker.Messages("orders")[0].Partition
+	assert.EqualValues(t, 2, broker.HighWaterMark("orders", partition))
+
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	ap := broker.NewAsyncProducer(t, config)
+	ap.ExpectInputWithMessageCheckerFunctionAndSucceed(broker.Deliver)
+	mp, err := sikafka.NewManagedAsyncProducer(ap, "orders")
+	siutils.AssertNilFail(t, err)
+	d, err := mp.Produce(context.Background(), []byte("k1"), []byte("v3"))
+	siutils.AssertNilFail(t, err)
+	_, _, err = d.Wait(context.Background())
+	siutils.AssertNilFail(t, err)
+	siutils.AssertNilFail(t, mp.Close(context.Background()))
+
+	var values []string
+	for _, msg := range broker.Messages("orders") {
+		assert.Equal(t, partition, msg.Partition)
+		values = append(values, string(msg.Value))
+	}
+	assert.Equal(t, []string{"v1", "v2", "v3"}, values)
+
+	// errors are injected with the mock producers
+	errBroker := errors.New("not leader for partition")
+	sp := broker.NewSyncProducer(t, nil)
+	sp.ExpectSendMessageAndFail(errBroker)
+	_, _, err = sp.SendMessage(&sarama.ProducerMessage{Topic: "orders", Value: sarama.StringEncoder("v4")})
+	assert.ErrorIs(t, err, errBroker)
+	assert.Len(t, broker.Messages("orders"), 3)
+}
+
+func TestSikafkatest_consumerGroup(t *testing.T) {
+	broker := sikafkatest.NewBroker()
+	broker.CreateTopic("orders", 4)
+	keys, values := make([]string, 40), make([]string, 40)
+	for i := range values {
+		keys[i], values[i] = "key-"+strconv.Itoa(i), strconv.Itoa(i)
+	}
+	produceValues(t, broker, "orders", keys[:20], values[:20])
+
+	handler1, handler2 := &collector{}, &collector{}
+	consumer1 := sikafka.NewCgConsumer(handler1)
+	cg1 := sikafka.NewConsumerGroup(broker.NewConsumerGroup("grp", oldestConfig()), consumer1, []string{"orders"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done1 := make(chan error)
+	go func() {
+		done1 <- cg1.Run(ctx)
+	}()
+	assert.Eventually(t, func() bool { return handler1.Len() == 20 }, time.Second, time.Millisecond)
+	assert.Equal(t, map[string][]int32{"orders": {0, 1, 2, 3}}, cg1.Health().Assignments)
+
+	// the second member rebalances the group
+	consumer2 := sikafka.NewCgConsumer(handler2)
+	cg2 := sikafka.NewConsumerGroup(broker.NewConsumerGroup("grp", oldestConfig()), consumer2, []string{"orders"})
+	done2 := make(chan error)
+	go func() {
+		done2 <- cg2.Run(ctx)
+	}()
+	assert.Eventually(t, func() bool {
+		return len(cg1.Health().Assignments["orders"]) == 2 && len(cg2.Health().Assignments["orders"]) == 2
+	}, time.Second, time.Millisecond)
+	assert.Len(t, broker.Assignments("grp"), 2)
+
+	// messages are consumed by the member assigned their partitions from the committed offsets
+	produceValues(t, broker, "orders", keys[20:], values[20:])
+	assert.Eventually(t, func() bool { return handler1.Len()+handler2.Len() == 40 }, time.Second, time.Millisecond)
+	assert.Greater(t, handler2.Len(), 0)
+	for p := int32(0); p < 4; p++ {
+		assert.Equal(t, broker.HighWaterMark("orders", p), broker.CommittedOffset("grp", "orders", p))
+	}
+
+	cancel()
+	siutils.AssertNilFail(t, <-done1)
+	siutils.AssertNilFail(t, <-done2)
+}
+
+func TestSikafkatest_consumeErrorsAndPause(t *testing.T) {
+	broker := sikafkatest.NewBroker()
+	errCoordinator := errors.New("coordinator not available")
+	broker.FailConsume("grp", errCoordinator)
+
+	handler := &collector{}
+	consumer := sikafka.NewCgConsumer(handler)
+	cg, err := sikafka.NewConsumerGroupWithOptions(broker.NewConsumerGroup("grp", oldestConfig()), consumer,
+		[]string{"orders"}, sikafka.WithConsumeRetry(3, time.Millisecond, time.Millisecond))
+	siutils.AssertNilFail(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- cg.Run(ctx)
+	}()
+	assert.Eventually(t, func() bool { return cg.Health().Assignments["orders"] != nil }, time.Second, time.Millisecond)
+
+	cg.PauseTopics("orders")
+	produceValues(t, broker, "orders", nil, []string{"a"})
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 0, handler.Len())
+	assert.EqualValues(t, 1, cg.Health().TotalLag())
+
+	cg.ResumeTopics("orders")
+	assert.Eventually(t, func() bool { return handler.Len() == 1 }, time.Second, time.Millisecond)
+
+	cancel()
+	siutils.AssertNilFail(t, <-done)
+}
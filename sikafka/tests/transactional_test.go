@@ -0,0 +1,229 @@
+package sikafka_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/go-wonk/si/v2/sikafka"
+	"github.com/go-wonk/si/v2/siutils"
+	"github.com/stretchr/testify/assert"
+)
+
+var flushMarker = &sarama.ProducerMessage{}
+
+// fakeTxnProducer is a transactional sarama.AsyncProducer keeping messages and offsets of committed transactions.
+type fakeTxnProducer struct {
+	id        string
+	input     chan *sarama.ProducerMessage
+	successes chan *sarama.ProducerMessage
+	errors    chan *sarama.ProducerError
+	flushed   chan struct{}
+
+	mu             sync.Mutex
+	status         sarama.ProducerTxnStatusFlag
+	pending        []string
+	pendingOffsets []int64
+	committed      []string
+	offsets        []int64
+	aborts         int
+}
+
+func newFakeTxnProducer(id string) *fakeTxnProducer {
+	p := &fakeTxnProducer{
+		id:        id,
+		input:     make(chan *sarama.ProducerMessage),
+		successes: make(chan *sarama.ProducerMessage),
+		errors:    make(chan *sarama.ProducerError),
+		flushed:   make(chan struct{}),
+		status:    sarama.ProducerTxnFlagReady,
+	}
+	go func() {
+		defer close(p.successes)
+		defer close(p.errors)
+		for msg := range p.input {
+			if msg == flushMarker {
+				p.flushed <- struct{}{}
+				continue
+			}
+			v, _ := msg.Value.Encode()
+			p.mu.Lock()
+			p.pending = append(p.pending, msg.Topic+":"+string(v))
+			p.mu.Unlock()
+		}
+	}()
+	return p
+}
+
+func (p *fakeTxnProducer) flush() {
+	p.input <- flushMarker
+	<-p.flushed
+}
+
+func (p *fakeTxnProducer) AsyncClose()                               { close(p.input) }
+func (p *fakeTxnProducer) Close() error                              { p.AsyncClose(); return nil }
+func (p *fakeTxnProducer) Input() chan<- *sarama.ProducerMessage     { return p.input }
+func (p *fakeTxnProducer) Successes() <-chan *sarama.ProducerMessage { return p.successes }
+func (p *fakeTxnProducer) Errors() <-chan *sarama.ProducerError      { return p.errors }
+func (p *fakeTxnProducer) IsTransactional() bool                     { return true }
+
+func (p *fakeTxnProducer) TxnStatus() sarama.ProducerTxnStatusFlag {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+func (p *fakeTxnProducer) BeginTxn() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status = sarama.ProducerTxnFlagInTransaction
+	return nil
+}
+
+func (p *fakeTxnProducer) CommitTxn() error {
+	p.flush()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.committed = append(p.committed, p.pending...)
+	p.offsets = append(p.offsets, p.pendingOffsets...)
+	p.pending, p.pendingOffsets = nil, nil
+	p.status = sarama.ProducerTxnFlagReady
+	return nil
+}
+
+func (p *fakeTxnProducer) AbortTxn() error {
+	p.flush()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending, p.pendingOffsets = nil, nil
+	p.status = sarama.ProducerTxnFlagReady
+	p.aborts++
+	return nil
+}
+
+func (p *fakeTxnProducer) AddOffsetsToTxn(offsets map[string][]*sarama.PartitionOffsetMetadata, groupId string) error {
+	return nil
+}
+
+func (p *fakeTxnProducer) AddMessageToTxn(msg *sarama.ConsumerMessage, groupId string, metadata *string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pendingOffsets = append(p.pendingOffsets, msg.Offset+1)
+	return nil
+}
+
+type transformFunc func(msg *sarama.ConsumerMessage) ([]*sarama.ProducerMessage, error)
+
+func (f transformFunc) Transform(msg *sarama.ConsumerMessage) ([]*sarama.ProducerMessage, error) {
+	return f(msg)
+}
+
+func upperTransform(msg *sarama.ConsumerMessage) ([]*sarama.ProducerMessage, error) {
+	if string(msg.Value) == "bad" {
+		return nil, errors.New("invalid value")
+	}
+	return []*sarama.ProducerMessage{
+		{Topic: "orders-upper", Value: sarama.StringEncoder(strings.ToUpper(string(msg.Value)))},
+	}, nil
+}
+
+func TestTransactionalProcessor(t *testing.T) {
+	var producer *fakeTxnProducer
+	p, err := sikafka.NewTransactionalProcessor("grp", func(transactionalID string) (sarama.AsyncProducer, error) {
+		producer = newFakeTxnProducer(transactionalID)
+		return producer, nil
+	}, transformFunc(upperTransform), sikafka.WithTransactionMaxMessages(2))
+	siutils.AssertNilFail(t, err)
+
+	err = p.ConsumeClaim(newFakeSession(context.Background()), newFakeClaim("orders", 3, nil, []string{"a", "b", "c"}))
+	assert.Nil(t, err)
+	assert.Equal(t, "grp-orders-3", producer.id)
+	assert.Equal(t, []string{"orders-upper:A", "orders-upper:B", "orders-upper:C"}, producer.committed)
+	assert.Equal(t, []int64{1, 2, 3}, producer.offsets)
+	assert.Equal(t, 0, producer.aborts)
+}
+
+func TestTransactionalProcessor_abort(t *testing.T) {
+	var producer *fakeTxnProducer
+	p, err := sikafka.NewTransactionalProcessor("grp", func(transactionalID string) (sarama.AsyncProducer, error) {
+		producer = newFakeTxnProducer(transactionalID)
+		return producer, nil
+	}, transformFunc(upperTransform), sikafka.WithTransactionalID(func(topic string, partition int32) string {
+		return "pipeline-" + topic
+	}))
+	siutils.AssertNilFail(t, err)
+
+	err = p.ConsumeClaim(newFakeSession(context.Background()), newFakeClaim("orders", 0, nil, []string{"a", "bad", "c"}))
+	assert.ErrorContains(t, err, "invalid value")
+	assert.Equal(t, "pipeline-orders", producer.id)
+	assert.Empty(t, producer.committed)
+	assert.Empty(t, producer.offsets)
+	assert.Equal(t, 1, producer.aborts)
+}
+
+func TestTransactionalProcessor_failurePolicy(t *testing.T) {
+	var producer *fakeTxnProducer
+	factory := func(transactionalID string) (sarama.AsyncProducer, error) {
+		producer = newFakeTxnProducer(transactionalID)
+		return producer, nil
+	}
+
+	// retried in the session
+	calls := 0
+	p, err := sikafka.NewTransactionalProcessor("grp", factory, transformFunc(func(msg *sarama.ConsumerMessage) ([]*sarama.ProducerMessage, error) {
+		if calls++; calls == 1 {
+			return nil, errors.New("temporary")
+		}
+		return upperTransform(msg)
+	}), sikafka.WithTransformRetry(2, time.Millisecond, 0))
+	siutils.AssertNilFail(t, err)
+	err = p.ConsumeClaim(newFakeSession(context.Background()), newFakeClaim("orders", 0, nil, []string{"a"}))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"orders-upper:A"}, producer.committed)
+
+	// produced to the dead letter topic in the transaction
+	p, err = sikafka.NewTransactionalProcessor("grp", factory, transformFunc(upperTransform),
+		sikafka.WithTransformRetry(2, time.Millisecond, 0), sikafka.WithTransformDeadLetterTopic(""))
+	siutils.AssertNilFail(t, err)
+	err = p.ConsumeClaim(newFakeSession(context.Background()), newFakeClaim("orders", 0, nil, []string{"a", "bad", "c"}))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"orders-upper:A", "orders.dlq:bad", "orders-upper:C"}, producer.committed)
+	assert.Equal(t, []int64{1, 2, 3}, producer.offsets)
+	assert.Equal(t, 0, producer.aborts)
+
+	// skipped
+	p, err = sikafka.NewTransactionalProcessor("grp", factory, transformFunc(upperTransform), sikafka.WithSkipFailedTransform())
+	siutils.AssertNilFail(t, err)
+	err = p.ConsumeClaim(newFakeSession(context.Background()), newFakeClaim("orders", 0, nil, []string{"a", "bad", "c"}))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"orders-upper:A", "orders-upper:C"}, producer.committed)
+	assert.Equal(t, []int64{1, 2, 3}, producer.offsets)
+}
+
+func TestNewTransactionalProcessor_invalidOption(t *testing.T) {
+	factory := func(transactionalID string) (sarama.AsyncProducer, error) {
+		return newFakeTxnProducer(transactionalID), nil
+	}
+	for _, opts := range [][]sikafka.TransactionalProcessorOption{
+		{sikafka.WithTransactionalID(nil)},
+		{sikafka.WithTransformRetry(3, -time.Second, 0)},
+		{sikafka.WithTransformDeadLetterTopic(""), sikafka.WithSkipFailedTransform()},
+	} {
+		p, err := sikafka.NewTransactionalProcessor("grp", factory, transformFunc(upperTransform), opts...)
+		assert.NotNil(t, err)
+		assert.Nil(t, p)
+	}
+}
+
+func TestTransactionalConfig(t *testing.T) {
+	config, err := sikafka.TransactionalConfig("3.1.0")
+	assert.Nil(t, err)
+	assert.Equal(t, sarama.ReadCommitted, config.Consumer.IsolationLevel)
+
+	config.Producer.Transaction.ID = "grp-orders-0"
+	assert.Nil(t, config.Validate())
+}
@@ -0,0 +1,260 @@
+package sikafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+// TransformHandler transforms a consumed message to messages to produce.
+type TransformHandler interface {
+	Transform(msg *sarama.ConsumerMessage) ([]*sarama.ProducerMessage, error)
+}
+
+// TransactionalProducerFactory returns a transactional producer with transactionalID.
+type TransactionalProducerFactory func(transactionalID string) (sarama.AsyncProducer, error)
+
+// TransactionalConfig returns config for exactly-once pipelines, with an idempotent producer and a consumer reading
+// committed messages only. Producer.Transaction.ID is set by NewTransactionalProducerFactory.
+func TransactionalConfig(version string) (*sarama.Config, error) {
+	parsedVersion, err := sarama.ParseKafkaVersion(version)
+	if err != nil {
+		return nil, errors.New("sikafka: cannot parse kafka version: " + err.Error())
+	}
+
+	config := sarama.NewConfig()
+	config.Version = parsedVersion
+	config.Producer.Idempotent = true
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Retry.Max = 10
+	config.Producer.Return.Errors = true
+	config.Net.MaxOpenRequests = 1
+	config.Consumer.IsolationLevel = sarama.ReadCommitted
+	config.Metadata.RefreshFrequency = 5 * time.Minute
+	return config, nil
+}
+
+// NewTransactionalProducerFactory returns TransactionalProducerFactory creating producers to brokers with a copy of
+// config, see TransactionalConfig. The copy is shallow, so producers share what config refers to such as
+// MetricRegistry, Net.TLS.Config and Producer.Interceptors, and config must not be modified after it is passed.
+func NewTransactionalProducerFactory(brokers []string, config *sarama.Config) TransactionalProducerFactory {
+	return func(transactionalID string) (sarama.AsyncProducer, error) {
+		c := *config
+		c.Producer.Transaction.ID = transactionalID
+		return sarama.NewAsyncProducer(brokers, &c)
+	}
+}
+
+// DefaultTransactionalID returns `<groupID>-<topic>-<partition>`.
+func DefaultTransactionalID(groupID, topic string, partition int32) string {
+	return groupID + "-" + topic + "-" + strconv.Itoa(int(partition))
+}
+
+// TransactionalProcessor is a Consumer of ConsumerGroup that transforms consumed messages and produces the results
+// in transactions along with the offsets of the consumed messages, so that both are committed atomically. Each
+// claimed partition has its own producer with a transactional ID of the partition, which fences producers of the
+// same partition left by previous assignments.
+//
+// A failed transformation is retried in the session with WithTransformRetry. If it still fails, the message is
+// produced to a dead letter topic in the transaction with WithTransformDeadLetterTopic, or skipped with
+// WithSkipFailedTransform. Otherwise, or if the transaction fails, the transaction is aborted and the session ends,
+// so that messages are consumed again from the last committed offset. Consumers of the produced topics should read
+// committed messages only, see TransactionalConfig.
+type TransactionalProcessor struct {
+	ready       chan bool
+	groupID     string
+	newProducer TransactionalProducerFactory
+	handler     TransformHandler
+
+	transactionalID func(topic string, partition int32) string
+	maxMessages     int
+
+	retry           handlerRetry
+	deadLetter      bool
+	deadLetterTopic string
+	skipFailed      bool
+}
+
+// NewTransactionalProcessor returns TransactionalProcessor of consumer group groupID. It fails if an option fails or
+// both WithTransformDeadLetterTopic and WithSkipFailedTransform are given.
+func NewTransactionalProcessor(groupID string, newProducer TransactionalProducerFactory, handler TransformHandler, opts ...TransactionalProcessorOption) (*TransactionalProcessor, error) {
+	p := &TransactionalProcessor{
+		groupID:     groupID,
+		newProducer: newProducer,
+		handler:     handler,
+		transactionalID: func(topic string, partition int32) string {
+			return DefaultTransactionalID(groupID, topic, partition)
+		},
+		maxMessages: 100,
+	}
+	p.MakeReady()
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		if err := o.apply(p); err != nil {
+			return nil, err
+		}
+	}
+	if p.deadLetter && p.skipFailed {
+		return nil, errors.New("sikafka: failed transformations cannot be both sent to a dead letter topic and skipped")
+	}
+	return p, nil
+}
+
+func (p *TransactionalProcessor) Setup(sarama.ConsumerGroupSession) error {
+	p.CloseReady()
+	return nil
+}
+
+func (p *TransactionalProcessor) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim processes messages of claim in transactions of up to maxMessages messages. A transaction is also
+// committed when no more message has been received.
+func (p *TransactionalProcessor) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	producer, err := p.newProducer(p.transactionalID(claim.Topic(), claim.Partition()))
+	if err != nil {
+		return fmt.Errorf("sikafka: failed to create transactional producer: %w", err)
+	}
+	// failures are reported by CommitTxn
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for range producer.Successes() {
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range producer.Errors() {
+		}
+	}()
+	defer func() {
+		producer.AsyncClose()
+		wg.Wait()
+	}()
+
+	inTxn := false
+	n := 0
+	for {
+		select {
+		case message, ok := <-claim.Messages():
+			if !ok {
+				if inTxn {
+					return p.commit(producer)
+				}
+				return nil
+			}
+			if !inTxn {
+				if err := producer.BeginTxn(); err != nil {
+					return fmt.Errorf("sikafka: failed to begin transaction: %w", err)
+				}
+				inTxn = true
+			}
+			if err := p.process(session.Context(), producer, message); err != nil {
+				return abortTxn(producer, err)
+			}
+			n++
+			if n >= p.maxMessages || len(claim.Messages()) == 0 {
+				if err := p.commit(producer); err != nil {
+					return err
+				}
+				inTxn = false
+				n = 0
+			}
+
+		case <-session.Context().Done():
+			if inTxn {
+				return abortTxn(producer, nil)
+			}
+			return nil
+		}
+	}
+}
+
+func (p *TransactionalProcessor) process(ctx context.Context, producer sarama.AsyncProducer, msg *sarama.ConsumerMessage) error {
+	outs, err := p.transform(ctx, msg)
+	if err != nil {
+		return fmt.Errorf("sikafka: failed to transform message %s/%d/%d: %w", msg.Topic, msg.Partition, msg.Offset, err)
+	}
+	for _, out := range outs {
+		producer.Input() <- out
+	}
+	return producer.AddMessageToTxn(msg, p.groupID, nil)
+}
+
+// transform transforms msg with retries. If it still fails, it returns the message to the dead letter topic, or
+// nothing to skip msg, as configured.
+func (p *TransactionalProcessor) transform(ctx context.Context, msg *sarama.ConsumerMessage) ([]*sarama.ProducerMessage, error) {
+	attempts := p.retry.maxAttempts()
+	backoff := p.retry.backoff
+
+	var outs []*sarama.ProducerMessage
+	var err error
+	for i := 1; i <= attempts; i++ {
+		if outs, err = p.handler.Transform(msg); err == nil {
+			return outs, nil
+		}
+		if i == attempts {
+			break
+		}
+		if serr := sleepContext(ctx, backoff); serr != nil {
+			return nil, err
+		}
+		backoff = p.retry.nextBackoff(backoff)
+	}
+
+	switch {
+	case p.deadLetter:
+		st := readFailureState(msg)
+		st.attempts += attempts
+		topic := p.deadLetterTopic
+		if topic == "" {
+			topic = st.originalTopic + defaultDeadLetterSuffix
+		}
+		return []*sarama.ProducerMessage{failedMessage(msg, topic, st, err)}, nil
+	case p.skipFailed:
+		return nil, nil
+	}
+	return nil, err
+}
+
+func (p *TransactionalProcessor) commit(producer sarama.AsyncProducer) error {
+	if err := producer.CommitTxn(); err != nil {
+		return abortTxn(producer, fmt.Errorf("sikafka: failed to commit transaction: %w", err))
+	}
+	return nil
+}
+
+// abortTxn aborts the transaction of producer if it can be aborted and returns err.
+func abortTxn(producer sarama.AsyncProducer, err error) error {
+	if producer.TxnStatus()&sarama.ProducerTxnFlagFatalError != 0 {
+		return err
+	}
+	if aerr := producer.AbortTxn(); aerr != nil {
+		if err == nil {
+			return fmt.Errorf("sikafka: failed to abort transaction: %w", aerr)
+		}
+		return fmt.Errorf("%w; failed to abort transaction: %v", err, aerr)
+	}
+	return err
+}
+
+func (p *TransactionalProcessor) MakeReady() {
+	p.ready = make(chan bool)
+}
+
+func (p *TransactionalProcessor) WaitReady() <-chan bool {
+	return p.ready
+}
+
+func (p *TransactionalProcessor) CloseReady() {
+	close(p.ready)
+}
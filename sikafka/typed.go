@@ -0,0 +1,111 @@
+package sikafka
+
+import (
+	"fmt"
+
+	"github.com/IBM/sarama"
+)
+
+// TypedProducer produces keys of K and values of V encoded with serializers.
+type TypedProducer[K, V any] struct {
+	producer *SyncProducer
+	key      Serializer[K]
+	value    Serializer[V]
+}
+
+func NewTypedProducer[K, V any](producer *SyncProducer, key Serializer[K], value Serializer[V]) *TypedProducer[K, V] {
+	return &TypedProducer[K, V]{producer, key, value}
+}
+
+// Produce sends value with key to the default topic of the producer.
+func (tp *TypedProducer[K, V]) Produce(key K, value V) (partition int32, offset int64, err error) {
+	return tp.ProduceWithTopic(tp.producer.topic, key, value)
+}
+
+func (tp *TypedProducer[K, V]) ProduceWithTopic(topic string, key K, value V) (partition int32, offset int64, err error) {
+	msg, err := tp.NewMessage(topic, key, value)
+	if err != nil {
+		return 0, 0, err
+	}
+	return tp.producer.ProduceWithMessage(msg)
+}
+
+// NewMessage returns a message with key and value encoded, eg. to add headers or to send it with
+// ManagedAsyncProducer.
+func (tp *TypedProducer[K, V]) NewMessage(topic string, key K, value V) (*sarama.ProducerMessage, error) {
+	k, err := tp.key.Serialize(topic, key)
+	if err != nil {
+		return nil, &SerdeError{Topic: topic, Key: true, Err: err}
+	}
+	v, err := tp.value.Serialize(topic, value)
+	if err != nil {
+		return nil, &SerdeError{Topic: topic, Err: err}
+	}
+
+	msg := &sarama.ProducerMessage{
+		Topic: topic,
+		Value: sarama.ByteEncoder(v),
+	}
+	if k != nil {
+		msg.Key = sarama.ByteEncoder(k)
+	}
+	return msg, nil
+}
+
+// SerdeError is returned when a key or a value fails to be serialized or deserialized.
+type SerdeError struct {
+	Topic string
+	// Key is true if the error is of the key.
+	Key bool
+	Err error
+}
+
+func (e *SerdeError) Error() string {
+	part := "value"
+	if e.Key {
+		part = "key"
+	}
+	return fmt.Sprintf("sikafka: serde of %s of topic %s: %v", part, e.Topic, e.Err)
+}
+
+func (e *SerdeError) Unwrap() error {
+	return e.Err
+}
+
+// TypedMessage is a consumed message with its key and value decoded.
+type TypedMessage[K, V any] struct {
+	Key     K
+	Value   V
+	Message *sarama.ConsumerMessage
+}
+
+// TypedHandler is MessageHandler decoding keys of K and values of V with deserializers before calling handle. Empty
+// keys are not decoded and left zero.
+type TypedHandler[K, V any] struct {
+	key    Deserializer[K]
+	value  Deserializer[V]
+	handle func(msg *TypedMessage[K, V]) error
+}
+
+func NewTypedHandler[K, V any](key Deserializer[K], value Deserializer[V], handle func(msg *TypedMessage[K, V]) error) *TypedHandler[K, V] {
+	return &TypedHandler[K, V]{key, value, handle}
+}
+
+// Handle decodes msg and calls the handler. It returns *SerdeError if msg cannot be decoded.
+func (th *TypedHandler[K, V]) Handle(msg *sarama.ConsumerMessage) error {
+	tm := &TypedMessage[K, V]{Message: msg}
+	if len(msg.Key) > 0 {
+		k, err := th.key.Deserialize(msg.Topic, msg.Key)
+		if err != nil {
+			return &SerdeError{Topic: msg.Topic, Key: true, Err: err}
+		}
+		tm.Key = k
+	}
+	v, err := th.value.Deserialize(msg.Topic, msg.Value)
+	if err != nil {
+		return &SerdeError{Topic: msg.Topic, Err: err}
+	}
+	tm.Value = v
+
+	return th.handle(tm)
+}
@@ -1,7 +1,9 @@
 package sirabbitmq
 
 import (
+	"context"
 	"errors"
+	"sync"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -24,12 +26,14 @@ type Conn struct {
 	reconnectDelay time.Duration
 
 	// logger          *log.Logger
-	connection      *amqp.Connection
 	done            chan bool
 	notifyConnClose chan *amqp.Error
 
-	isReady bool
-	ready   chan bool
+	// mu guards connection and isReady, which are replaced by handleReconnect
+	mu         sync.RWMutex
+	connection *amqp.Connection
+	isReady    bool
+	ready      chan bool
 }
 
 // NewConn creates a new consumer state instance, and automatically
@@ -52,7 +56,7 @@ func NewConn(addr string, prefetch int) *Conn {
 // notifyConnClose, and then continuously attempt to reconnect.
 func (c *Conn) handleReconnect(addr string) {
 	for {
-		c.isReady = false
+		c.setReady(false)
 		conn, err := c.connect(addr)
 		if err != nil {
 			Error("failed to connect")
@@ -68,7 +72,7 @@ func (c *Conn) handleReconnect(addr string) {
 
 		Infof("connection(%s) has been initialized\n", c.id)
 
-		c.isReady = true
+		c.setReady(true)
 		close(c.ready)
 		c.ready = make(chan bool)
 
@@ -104,29 +108,52 @@ func (c *Conn) handleClose(conn *amqp.Connection) bool {
 // changeConnection takes a new connection to the queue,
 // and updates the close listener to reflect this.
 func (c *Conn) changeConnection(connection *amqp.Connection) {
+	c.mu.Lock()
 	c.connection = connection
+	c.mu.Unlock()
 	c.notifyConnClose = make(chan *amqp.Error, 1)
-	c.connection.NotifyClose(c.notifyConnClose)
+	connection.NotifyClose(c.notifyConnClose)
+}
+
+func (c *Conn) setReady(ready bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.isReady = ready
 }
 
 // Close will cleanly shut down the channel and connection.
 func (c *Conn) Close() error {
-	if !c.isReady {
+	c.mu.RLock()
+	isReady, connection := c.isReady, c.connection
+	c.mu.RUnlock()
+	if !isReady {
 		return errAlreadyClosed
 	}
 	close(c.done)
 
-	err := c.connection.Close()
+	err := connection.Close()
 	if err != nil {
 		return err
 	}
 
-	c.isReady = false
+	c.setReady(false)
 	Infof("closing connection, %s\n", c.id)
 	return nil
 }
 
+// HealthCheck returns an error if c is not connected to the server.
+func (c *Conn) HealthCheck(ctx context.Context) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.isReady || c.connection == nil || c.connection.IsClosed() {
+		return errNotConnected
+	}
+	return nil
+}
+
 func (c *Conn) GetConnection() *amqp.Connection {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 	return c.connection
 }
 
@@ -48,6 +48,11 @@ func (o *SqlDB) Begin() (*sql.Tx, error) {
 	return tx, nil
 }
 
+// HealthCheck pings the database.
+func (o *SqlDB) HealthCheck(ctx context.Context) error {
+	return o.db.PingContext(ctx)
+}
+
 func (o *SqlDB) Close() error {
 	return o.db.Close()
 }
@@ -192,6 +192,16 @@ func (h *Hub) Stop() error {
 	return nil
 }
 
+// HealthCheck returns ErrHubClosed once h has started stopping.
+func (h *Hub) HealthCheck(ctx context.Context) error {
+	select {
+	case <-h.clientDone:
+		return ErrHubClosed
+	default:
+		return nil
+	}
+}
+
 // Wait waits until h is completely finished.
 func (h *Hub) Wait() {
 	<-h.terminated